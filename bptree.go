@@ -16,27 +16,47 @@ const (
 
 // BPTree represents a B+ tree.
 type BPTree struct {
-	maxDegree   int
-	keyComparer KeyComparer
-	leafList    leafList
-	root        unsafe.Pointer
-	height      int
+	options         Options
+	minLeafSize     int
+	minNonLeafSize  int
+	keyKind         KeyKind
+	keyComparer     KeyComparer
+	leafList        leafList
+	root            unsafe.Pointer
+	height          int
+	counters        Counters
+	nodePool        *nodePool
+	finger          *leaf
+	fingerAtEnd     bool // whether the last record was inserted at the end of the finger
+	hasher          *hasher
+	sequenceNumber  uint64
+	mutationLog     *mutationLog
+	tracer          *tracer
+	comparerChecker *comparerChecker
+	err             error
 }
 
 // Init initializes the B+ tree with the given maximum degree
 // and key comparer and returns it.
 func (bpt *BPTree) Init(maxDegree int, keyComparer KeyComparer) *BPTree {
+	return bpt.InitWithKeyKind(maxDegree, GenericKeys, keyComparer)
+}
+
+// InitWithKeyKind initializes the B+ tree with the given maximum
+// degree, key kind and key comparer and returns it.
+// The key comparer is used only for generic keys, keys of other
+// kinds have built-in orders.
+func (bpt *BPTree) InitWithKeyKind(maxDegree int, keyKind KeyKind, keyComparer KeyComparer) *BPTree {
 	if maxDegree < 4 {
 		panic(errors.New("bptree: invalid maximum degree"))
 	}
 
-	bpt.maxDegree = maxDegree
-	bpt.keyComparer = keyComparer
-	root := leaf{}
-	bpt.leafList.Init(&root)
-	bpt.root = unsafe.Pointer(&root)
-	bpt.height = 1
-	return bpt
+	return bpt.InitWithOptions(Options{
+		LeafCapacity:    maxDegree,
+		NonLeafCapacity: maxDegree,
+		KeyKind:         keyKind,
+		KeyComparer:     keyComparer,
+	})
 }
 
 // AddRecord adds the given record to the B+ tree.
@@ -44,14 +64,43 @@ func (bpt *BPTree) Init(maxDegree int, keyComparer KeyComparer) *BPTree {
 // it adds the record then returns true, otherwise it returns
 // false and the present value of the record.
 func (bpt *BPTree) AddRecord(key, value interface{}) (interface{}, bool) {
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceAddRecord, key, value)
+	}
+
+	if recordIndex, ok, inFinger := bpt.locateRecordInFinger(key); inFinger && bpt.hasher == nil {
+		if ok {
+			return bpt.finger.Value(recordIndex), false
+		}
+
+		if !bpt.finger.IsFull(bpt.options.LeafCapacity) {
+			if bpt.comparerChecker != nil {
+				bpt.checkInsertion(bpt.finger, recordIndex, key)
+			}
+
+			bpt.finger.InsertRecord(record{key, value}, recordIndex)
+			bpt.fingerAtEnd = recordIndex == bpt.finger.NumberOfRecords()-1
+			bpt.logMutation(MutationAdd, key, value)
+			return nil, true
+		}
+	}
+
 	recordPath, ok := bpt.findRecord(key)
 
 	if ok {
 		leaf, recordIndex := recordPath.LocateRecord()
-		return leaf.Records()[recordIndex].Value, false
+		return leaf.Value(recordIndex), false
 	}
 
 	bpt.insertRecord(record{key, value}, recordPath)
+	bpt.logMutation(MutationAdd, key, value)
 	return nil, true
 }
 
@@ -61,9 +110,33 @@ func (bpt *BPTree) AddRecord(key, value interface{}) (interface{}, bool) {
 // it updates the record then returns true and the replaced
 // value of the record, otherwise it returns flase.
 func (bpt *BPTree) UpdateRecord(key, value interface{}) (interface{}, bool) {
-	if recordPath, ok := bpt.findRecord(key); ok {
-		leaf, recordIndex := recordPath.LocateRecord()
-		leaf.Records()[recordIndex].Value, value = value, leaf.Records()[recordIndex].Value
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceUpdateRecord, key, value)
+	}
+
+	if bpt.hasher != nil {
+		// the hashes of the nodes on the path have to be invalidated.
+		if recordPath, ok := bpt.findRecord(key); ok {
+			leaf, recordIndex := recordPath.LocateRecord()
+			bpt.logMutation(MutationUpdate, key, value)
+			value = leaf.SetValue(recordIndex, value)
+			recordPath.InvalidateHashes()
+			return value, true
+		}
+
+		return nil, false
+	}
+
+	if leaf, recordIndex, ok := bpt.locateRecord(key); ok {
+		bpt.logMutation(MutationUpdate, key, value)
+		value = leaf.SetValue(recordIndex, value)
 		return value, true
 	}
 
@@ -78,15 +151,48 @@ func (bpt *BPTree) UpdateRecord(key, value interface{}) (interface{}, bool) {
 // the record then returns false and the replaced value of the
 // record.
 func (bpt *BPTree) AddOrUpdateRecord(key, value interface{}) (interface{}, bool) {
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceAddOrUpdateRecord, key, value)
+	}
+
+	if recordIndex, ok, inFinger := bpt.locateRecordInFinger(key); inFinger && bpt.hasher == nil {
+		if ok {
+			bpt.logMutation(MutationUpdate, key, value)
+			value = bpt.finger.SetValue(recordIndex, value)
+			return value, false
+		}
+
+		if !bpt.finger.IsFull(bpt.options.LeafCapacity) {
+			if bpt.comparerChecker != nil {
+				bpt.checkInsertion(bpt.finger, recordIndex, key)
+			}
+
+			bpt.finger.InsertRecord(record{key, value}, recordIndex)
+			bpt.fingerAtEnd = recordIndex == bpt.finger.NumberOfRecords()-1
+			bpt.logMutation(MutationAdd, key, value)
+			return nil, true
+		}
+	}
+
 	recordPath, ok := bpt.findRecord(key)
 
 	if ok {
 		leaf, recordIndex := recordPath.LocateRecord()
-		leaf.Records()[recordIndex].Value, value = value, leaf.Records()[recordIndex].Value
+		bpt.logMutation(MutationUpdate, key, value)
+		value = leaf.SetValue(recordIndex, value)
+		recordPath.InvalidateHashes()
 		return value, false
 	}
 
 	bpt.insertRecord(record{key, value}, recordPath)
+	bpt.logMutation(MutationAdd, key, value)
 	return nil, true
 }
 
@@ -96,10 +202,22 @@ func (bpt *BPTree) AddOrUpdateRecord(key, value interface{}) (interface{}, bool)
 // it deletes the record then returns true and the removed
 // value of the record, otherwise it returns flase.
 func (bpt *BPTree) DeleteRecord(key interface{}) (interface{}, bool) {
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceDeleteRecord, key)
+	}
+
 	if recordPath, ok := bpt.findRecord(key); ok {
 		leaf, recordIndex := recordPath.LocateRecord()
-		value := leaf.Records()[recordIndex].Value
+		value := leaf.Value(recordIndex)
 		bpt.removeRecord(recordPath)
+		bpt.logMutation(MutationDelete, key, nil)
 		return value, true
 	}
 
@@ -112,20 +230,92 @@ func (bpt *BPTree) DeleteRecord(key interface{}) (interface{}, bool) {
 // it returns true and the present value of the record,
 // otherwise it returns flase.
 func (bpt *BPTree) HasRecord(key interface{}) (interface{}, bool) {
-	if recordPath, ok := bpt.findRecord(key); ok {
-		leaf, recordIndex := recordPath.LocateRecord()
-		return leaf.Records()[recordIndex].Value, true
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceHasRecord, key)
+	}
+
+	if leaf, recordIndex, ok := bpt.locateRecord(key); ok {
+		return leaf.Value(recordIndex), true
 	}
 
 	return nil, false
 }
 
+// Floor finds the record with the greatest key which is less
+// than or equal to the given key in the B+ tree.
+// If such a record exists in the B+ tree, it returns true and
+// the key and the value of the record, otherwise it returns
+// false.
+func (bpt *BPTree) Floor(key interface{}) (interface{}, interface{}, bool) {
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceFloor, key)
+	}
+
+	leaf, recordIndex, ok := bpt.locateRecord(key)
+
+	if !ok {
+		if leaf, recordIndex, ok = bpt.prevRecord(leaf, recordIndex); !ok {
+			return nil, nil, false
+		}
+	}
+
+	return leaf.Key(recordIndex), leaf.Value(recordIndex), true
+}
+
+// Ceiling finds the record with the least key which is greater
+// than or equal to the given key in the B+ tree.
+// If such a record exists in the B+ tree, it returns true and
+// the key and the value of the record, otherwise it returns
+// false.
+func (bpt *BPTree) Ceiling(key interface{}) (interface{}, interface{}, bool) {
+	bpt.lazyInit()
+
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceCeiling, key)
+	}
+
+	leaf, recordIndex, ok := bpt.locateRecord(key)
+
+	if !ok {
+		if leaf, recordIndex, ok = bpt.nextRecord(leaf, recordIndex); !ok {
+			return nil, nil, false
+		}
+	}
+
+	return leaf.Key(recordIndex), leaf.Value(recordIndex), true
+}
+
 // SearchForward searchs the the B+ tree for records with
 // keys in the given interval [maxKey, minKey].
 // It returns an iterator to iterate over the records found
 // in a ascending order.
 func (bpt *BPTree) SearchForward(maxKey, minKey interface{}) Iterator {
-	minLeaf, minRecordIndex, maxLeaf, maxRecordIndex, ok := bpt.findAndLocateRecords(maxKey, minKey)
+	bpt.lazyInit()
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceSearchForward, maxKey, minKey)
+	}
+
+	minLeaf, minRecordIndex, maxLeaf, maxRecordIndex, ok := bpt.searchRecords(maxKey, minKey)
 	return new(forwardIterator).Init(minLeaf, minRecordIndex, maxLeaf, maxRecordIndex, !ok)
 }
 
@@ -134,25 +324,141 @@ func (bpt *BPTree) SearchForward(maxKey, minKey interface{}) Iterator {
 // It returns an iterator to iterate over the records found
 // in a descending order.
 func (bpt *BPTree) SearchBackward(maxKey, minKey interface{}) Iterator {
-	minLeaf, minRecordIndex, maxLeaf, maxRecordIndex, ok := bpt.findAndLocateRecords(maxKey, minKey)
+	bpt.lazyInit()
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceSearchBackward, maxKey, minKey)
+	}
+
+	minLeaf, minRecordIndex, maxLeaf, maxRecordIndex, ok := bpt.searchRecords(maxKey, minKey)
 	return new(backwardIterator).Init(maxLeaf, maxRecordIndex, minLeaf, minRecordIndex, !ok)
 }
 
 // IsEmpty indicates whether the B+ tree is empty.
 func (bpt *BPTree) IsEmpty() bool {
-	return bpt.height == 1 && len((*leaf)(bpt.root).Records()) == 0
+	bpt.lazyInit()
+	return bpt.height == 1 && (*leaf)(bpt.root).NumberOfRecords() == 0
 }
 
-// MaxDegree returns the maximum degree of the B+ tree.
+// KeyKind returns the kind of keys of the B+ tree.
+func (bpt *BPTree) KeyKind() KeyKind {
+	return bpt.keyKind
+}
+
+// KeyComparer returns the key comparer of the B+ tree, which is
+// built-in for keys of kinds other than GenericKeys.
+func (bpt *BPTree) KeyComparer() KeyComparer {
+	bpt.lazyInit()
+	return bpt.keyComparer
+}
+
+// MaxDegree returns the maximum degree of the B+ tree, which is
+// the maximum number of children of non-leaves.
 func (bpt *BPTree) MaxDegree() int {
-	return bpt.maxDegree
+	bpt.lazyInit()
+	return bpt.options.NonLeafCapacity
 }
 
 // Height returns the height of the B+ tree.
 func (bpt *BPTree) Height() int {
+	bpt.lazyInit()
 	return bpt.height
 }
 
+// locateRecord is like findRecord but descends without recording
+// the path, for lookups without structural changes.
+func (bpt *BPTree) locateRecord(key interface{}) (*leaf, int, bool) {
+	node := bpt.root
+
+	for nodeDepth := 1; nodeDepth < bpt.height; nodeDepth++ {
+		nonLeaf := (*nonLeaf)(node)
+		i, ok := nonLeaf.LocateChild(key, bpt.keyComparer)
+
+		if bpt.comparerChecker != nil {
+			bpt.comparerChecker.Sample(nonLeaf.keys, key)
+		}
+
+		if !ok {
+			i--
+		}
+
+		node = nonLeaf.Child(i)
+	}
+
+	leaf := (*leaf)(node)
+	i, ok := leaf.LocateRecord(key, bpt.keyComparer)
+
+	if bpt.comparerChecker != nil {
+		bpt.comparerChecker.Sample(leaf.keys, key)
+	}
+
+	return leaf, i, ok
+}
+
+// locateRecordInFinger is like locateRecord but searches only the
+// finger, which is the leaf where the last record was inserted, to
+// skip the descent for keys close to each other. It returns false
+// for inFinger if the key may fall inside another leaf, or would be
+// the first key of the finger, whose separator key then has to be
+// synchronized.
+func (bpt *BPTree) locateRecordInFinger(key interface{}) (int, bool, bool) {
+	finger := bpt.finger
+
+	if finger == nil {
+		return 0, false, false
+	}
+
+	if _, ok := key.(keyMinMax); ok {
+		return 0, false, false
+	}
+
+	recordIndex, ok := finger.LocateRecord(key, bpt.keyComparer)
+
+	if bpt.comparerChecker != nil {
+		bpt.comparerChecker.Sample(finger.keys, key)
+	}
+
+	if ok {
+		return recordIndex, true, true
+	}
+
+	if recordIndex == 0 || (recordIndex == finger.NumberOfRecords() && finger != bpt.leafList.Tail()) {
+		return 0, false, false
+	}
+
+	return recordIndex, false, true
+}
+
+// nextRecord returns the record at the given position, or the
+// first record of the next leaf if the position is at the end of
+// the leaf.
+func (bpt *BPTree) nextRecord(leaf *leaf, recordIndex int) (*leaf, int, bool) {
+	if recordIndex == leaf.NumberOfRecords() {
+		if leaf == bpt.leafList.Tail() {
+			return nil, 0, false
+		}
+
+		return leaf.Next, 0, true
+	}
+
+	return leaf, recordIndex, true
+}
+
+// prevRecord returns the record before the given position, which
+// may be the last record of the previous leaf.
+func (bpt *BPTree) prevRecord(leaf *leaf, recordIndex int) (*leaf, int, bool) {
+	if recordIndex == 0 {
+		if leaf == bpt.leafList.Head() {
+			return nil, 0, false
+		}
+
+		leaf = leaf.Prev
+		return leaf, leaf.NumberOfRecords() - 1, true
+	}
+
+	return leaf, recordIndex - 1, true
+}
+
 func (bpt *BPTree) findRecord(key interface{}) (recordPath, bool) {
 	recordPath := recordPath(make([]recordPathComponent, 0, bpt.height+1))
 	node := bpt.root
@@ -161,6 +467,11 @@ func (bpt *BPTree) findRecord(key interface{}) (recordPath, bool) {
 		if nodeDepth := len(recordPath) + 1; nodeDepth == bpt.height {
 			leaf := (*leaf)(node)
 			i, ok := leaf.LocateRecord(key, bpt.keyComparer)
+
+			if bpt.comparerChecker != nil {
+				bpt.comparerChecker.Sample(leaf.keys, key)
+			}
+
 			recordPath.Append(node, i)
 			return recordPath, ok
 		}
@@ -168,20 +479,37 @@ func (bpt *BPTree) findRecord(key interface{}) (recordPath, bool) {
 		nonLeaf := (*nonLeaf)(node)
 		i, ok := nonLeaf.LocateChild(key, bpt.keyComparer)
 
+		if bpt.comparerChecker != nil {
+			bpt.comparerChecker.Sample(nonLeaf.keys, key)
+		}
+
 		if !ok {
 			i--
 		}
 
 		recordPath.Append(node, i)
-		node = nonLeaf.Children()[i].Value
+		node = nonLeaf.Child(i)
 	}
 }
 
 func (bpt *BPTree) insertRecord(record record, recordPath recordPath) {
+	// anything which may panic, such as the key comparer, has to be
+	// done before the B+ tree is restructured, so that a panic leaves
+	// the B+ tree as it was.
+	checkKey(bpt.keyKind, record.Key)
+
+	if bpt.comparerChecker != nil {
+		leaf, recordIndex := recordPath.LocateRecord()
+		bpt.checkInsertion(leaf, recordIndex, record.Key)
+	}
+
 	bpt.ensureNotFullLeaf(&recordPath)
 	leaf, recordIndex := recordPath.LocateRecord()
 	leaf.InsertRecord(record, recordIndex)
 	syncKey(recordPath)
+	recordPath.InvalidateHashes()
+	bpt.finger = leaf
+	bpt.fingerAtEnd = recordIndex == leaf.NumberOfRecords()-1
 }
 
 func (bpt *BPTree) removeRecord(recordPath recordPath) {
@@ -192,18 +520,18 @@ func (bpt *BPTree) removeRecord(recordPath recordPath) {
 	leaf, recordIndex := recordPath.LocateRecord()
 	leaf.RemoveRecord(recordIndex)
 	syncKey(recordPath)
+	recordPath.InvalidateHashes()
 }
 
 func (bpt *BPTree) ensureNotFullLeaf(recordPath *recordPath) {
 	i := len(*recordPath) - 1
 	leaf1 := (*recordPath)[i].Leaf()
 
-	if !leaf1.IsFull(bpt.maxDegree) {
+	if !leaf1.IsFull(bpt.options.LeafCapacity) {
 		return
 	}
 
 	recordIndex := (*recordPath)[i].RecordIndex()
-	numberOfRecords := bpt.maxDegree / 2
 
 	if i == 0 {
 		bpt.increaseHeight()
@@ -214,44 +542,74 @@ func (bpt *BPTree) ensureNotFullLeaf(recordPath *recordPath) {
 	leafParent := (*recordPath)[i-1].NonLeaf()
 	leafIndex := (*recordPath)[i-1].NodeChildIndex()
 
-	if leafIndex < len(leafParent.Children())-1 {
-		leafRightSibling := (*leaf)(leafParent.Children()[leafIndex+1].Value)
+	if !bpt.options.DisableSiblingShifting && leafIndex < leafParent.NumberOfChildren()-1 {
+		leafRightSibling := (*leaf)(leafParent.Child(leafIndex + 1))
 
-		if !leafRightSibling.IsFull(bpt.maxDegree) {
-			if recordIndex == len(leaf1.Records()) {
+		if !leafRightSibling.IsFull(bpt.options.LeafCapacity) {
+			if recordIndex == leaf1.NumberOfRecords() {
 				(*recordPath)[i].SetLeaf(leafRightSibling)
 				(*recordPath)[i].SetRecordIndex(0)
 				(*recordPath)[i-1].SetNodeChildIndex(leafIndex + 1)
 			} else {
 				leaf1.ShiftToRight(leafParent, leafIndex, leafRightSibling)
+				bpt.counters.NumberOfShifts++
+
+				if recordIndex == leaf1.NumberOfRecords() {
+					// the key will be the last key of the leaf, which may be not
+					// less than the truncated separator key, so let the first key
+					// of the right sibling be the separator key.
+					leafParent.SetKey(leafIndex+1, leafRightSibling.Key(0))
+				}
 			}
 
 			return
 		}
 	}
 
-	if leafIndex >= 1 {
-		leafLeftSibling := (*leaf)(leafParent.Children()[leafIndex-1].Value)
-
-		if !leafLeftSibling.IsFull(bpt.maxDegree) {
-			// if recordIndex == 0 {
-			//	(*recordPath)[i].SetLeaf(leafLeftSibling)
-			//	(*recordPath)[i].SetRecordIndex(len(leafLeftSibling.Records()))
-			//	(*recordPath)[i-1].SetNodeChildIndex(leafIndex - 1)
-			// } else {
-			leaf1.ShiftToLeft(leafParent, leafIndex, leafLeftSibling)
-			(*recordPath)[i].SetRecordIndex(recordIndex - 1)
-			// }
+	if !bpt.options.DisableSiblingShifting && leafIndex >= 1 {
+		leafLeftSibling := (*leaf)(leafParent.Child(leafIndex - 1))
+
+		if !leafLeftSibling.IsFull(bpt.options.LeafCapacity) {
+			if recordIndex == 0 {
+				// the key is less than the first key of the leaf but not less
+				// than the truncated separator key, move the insertion to the
+				// left sibling and let the first key be the separator key.
+				leafParent.SetKey(leafIndex, leaf1.Key(0))
+				(*recordPath)[i].SetLeaf(leafLeftSibling)
+				(*recordPath)[i].SetRecordIndex(leafLeftSibling.NumberOfRecords())
+				(*recordPath)[i-1].SetNodeChildIndex(leafIndex - 1)
+			} else {
+				leaf1.ShiftToLeft(leafParent, leafIndex, leafLeftSibling)
+				bpt.counters.NumberOfShifts++
+				(*recordPath)[i].SetRecordIndex(recordIndex - 1)
+			}
 
 			return
 		}
 	}
 
+	numberOfRecords := bpt.options.LeafCapacity / 2
+	// only sequential insertions at the end, rather than any random
+	// one which happens to be at the end, split the leaf there.
+	isAppending := bpt.isAppending(*recordPath) && leaf1 == bpt.finger && bpt.fingerAtEnd
+
+	if isAppending {
+		// leave the leaf full and let the record be the first one of
+		// the new sibling.
+		numberOfRecords = recordIndex
+	}
+
 	i = bpt.ensureNotFullNonLeaf(recordPath, i-1) + 1
 	leafParent = (*recordPath)[i-1].NonLeaf()
 	leafIndex = (*recordPath)[i-1].NodeChildIndex()
-	leafNewSibling := leaf1.Split(numberOfRecords, leafParent, leafIndex)
+	leafNewSibling := bpt.newLeaf()
+	leaf1.Split(numberOfRecords, leafParent, leafIndex, leafNewSibling)
 	bpt.leafList.InsertLeafAfter(leafNewSibling, leaf1)
+	bpt.counters.NumberOfSplits++
+
+	if isAppending {
+		bpt.counters.NumberOfAppendSplits++
+	}
 
 	if recordIndex >= numberOfRecords {
 		(*recordPath)[i].SetLeaf(leafNewSibling)
@@ -263,12 +621,12 @@ func (bpt *BPTree) ensureNotFullLeaf(recordPath *recordPath) {
 func (bpt *BPTree) ensureNotFullNonLeaf(recordPath *recordPath, i int) int {
 	nonLeaf1 := (*recordPath)[i].NonLeaf()
 
-	if !nonLeaf1.IsFull(bpt.maxDegree) {
+	if !nonLeaf1.IsFull(bpt.options.NonLeafCapacity) {
 		return i
 	}
 
 	nonLeafChildIndex := (*recordPath)[i].NodeChildIndex()
-	numberOfNonLeafChildren := 1 + (bpt.maxDegree-1)/2
+	numberOfNonLeafChildren := 1 + (bpt.options.NonLeafCapacity-1)/2
 
 	if i == 0 {
 		bpt.increaseHeight()
@@ -279,20 +637,22 @@ func (bpt *BPTree) ensureNotFullNonLeaf(recordPath *recordPath, i int) int {
 	nonLeafParent := (*recordPath)[i-1].NonLeaf()
 	nonLeafIndex := (*recordPath)[i-1].NodeChildIndex()
 
-	if nonLeafIndex < len(nonLeafParent.Children())-1 {
-		nonLeafRightSibling := (*nonLeaf)(nonLeafParent.Children()[nonLeafIndex+1].Value)
+	if !bpt.options.DisableSiblingShifting && nonLeafIndex < nonLeafParent.NumberOfChildren()-1 {
+		nonLeafRightSibling := (*nonLeaf)(nonLeafParent.Child(nonLeafIndex + 1))
 
-		if !nonLeafRightSibling.IsFull(bpt.maxDegree) && nonLeafChildIndex < len(nonLeaf1.Children())-1 {
+		if !nonLeafRightSibling.IsFull(bpt.options.NonLeafCapacity) && nonLeafChildIndex < nonLeaf1.NumberOfChildren()-1 {
 			nonLeaf1.ShiftToRight(nonLeafParent, nonLeafIndex, nonLeafRightSibling)
+			bpt.counters.NumberOfShifts++
 			return i
 		}
 	}
 
-	if nonLeafIndex >= 1 {
-		nonLeafLeftSibling := (*nonLeaf)(nonLeafParent.Children()[nonLeafIndex-1].Value)
+	if !bpt.options.DisableSiblingShifting && nonLeafIndex >= 1 {
+		nonLeafLeftSibling := (*nonLeaf)(nonLeafParent.Child(nonLeafIndex - 1))
 
-		if !nonLeafLeftSibling.IsFull(bpt.maxDegree) && nonLeafChildIndex >= 1 {
+		if !nonLeafLeftSibling.IsFull(bpt.options.NonLeafCapacity) && nonLeafChildIndex >= 1 {
 			nonLeaf1.ShiftToLeft(nonLeafParent, nonLeafIndex, nonLeafLeftSibling)
+			bpt.counters.NumberOfShifts++
 			(*recordPath)[i].SetNodeChildIndex(nonLeafChildIndex - 1)
 			return i
 		}
@@ -301,7 +661,9 @@ func (bpt *BPTree) ensureNotFullNonLeaf(recordPath *recordPath, i int) int {
 	i = bpt.ensureNotFullNonLeaf(recordPath, i-1) + 1
 	nonLeafParent = (*recordPath)[i-1].NonLeaf()
 	nonLeafIndex = (*recordPath)[i-1].NodeChildIndex()
-	nonLeafNewSibling := nonLeaf1.Split(numberOfNonLeafChildren, nonLeafParent, nonLeafIndex)
+	nonLeafNewSibling := bpt.newNonLeaf()
+	nonLeaf1.Split(numberOfNonLeafChildren, nonLeafParent, nonLeafIndex, nonLeafNewSibling)
+	bpt.counters.NumberOfSplits++
 
 	if nonLeafChildIndex >= numberOfNonLeafChildren {
 		(*recordPath)[i].SetNonLeaf(nonLeafNewSibling)
@@ -316,7 +678,7 @@ func (bpt *BPTree) ensureNotSparseLeaf(recordPath *recordPath) {
 	i := len(*recordPath) - 1
 	leaf1 := (*recordPath)[i].Leaf()
 
-	if !leaf1.IsSparse(bpt.maxDegree) {
+	if !leaf1.IsSparse(bpt.minLeafSize) {
 		return
 	}
 
@@ -325,11 +687,12 @@ func (bpt *BPTree) ensureNotSparseLeaf(recordPath *recordPath) {
 	leafIndex := (*recordPath)[i-1].NodeChildIndex()
 	var leafRightSibling *leaf
 
-	if leafIndex < len(leafParent.Children())-1 {
-		leafRightSibling = (*leaf)(leafParent.Children()[leafIndex+1].Value)
+	if leafIndex < leafParent.NumberOfChildren()-1 {
+		leafRightSibling = (*leaf)(leafParent.Child(leafIndex + 1))
 
-		if !leafRightSibling.IsSparse(bpt.maxDegree) {
+		if !leafRightSibling.IsSparse(bpt.minLeafSize) {
 			leaf1.UnshiftFromRight(leafParent, leafIndex, leafRightSibling)
+			bpt.counters.NumberOfShifts++
 			return
 		}
 	} else {
@@ -339,10 +702,11 @@ func (bpt *BPTree) ensureNotSparseLeaf(recordPath *recordPath) {
 	var leafLeftSibling *leaf
 
 	if leafIndex >= 1 {
-		leafLeftSibling = (*leaf)(leafParent.Children()[leafIndex-1].Value)
+		leafLeftSibling = (*leaf)(leafParent.Child(leafIndex - 1))
 
-		if !leafLeftSibling.IsSparse(bpt.maxDegree) {
+		if !leafLeftSibling.IsSparse(bpt.minLeafSize) {
 			leaf1.UnshiftFromLeft(leafParent, leafIndex, leafLeftSibling)
+			bpt.counters.NumberOfShifts++
 			(*recordPath)[i].SetRecordIndex(recordIndex + 1)
 			return
 		}
@@ -358,17 +722,19 @@ func (bpt *BPTree) ensureNotSparseLeaf(recordPath *recordPath) {
 
 	if leafRightSibling != nil {
 		leaf1.MergeFromRight(leafParent, leafIndex, leafRightSibling)
-		bpt.leafList.RemoveLeaf(leafRightSibling)
+		bpt.removeLeaf(leafRightSibling)
 	} else {
-		numberOfRecords := len(leaf1.Records())
+		numberOfRecords := leaf1.NumberOfRecords()
 		leaf1.MergeToLeft(leafParent, leafIndex, leafLeftSibling)
-		bpt.leafList.RemoveLeaf(leaf1)
+		bpt.removeLeaf(leaf1)
 		(*recordPath)[i].SetLeaf(leafLeftSibling)
-		(*recordPath)[i].SetRecordIndex(len(leafLeftSibling.Records()) - (numberOfRecords - recordIndex))
+		(*recordPath)[i].SetRecordIndex(leafLeftSibling.NumberOfRecords() - (numberOfRecords - recordIndex))
 		(*recordPath)[i-1].SetNodeChildIndex(leafIndex - 1)
 	}
 
-	if i == 1 && len(leafParent.Children()) == 1 {
+	bpt.counters.NumberOfMerges++
+
+	if i == 1 && leafParent.NumberOfChildren() == 1 {
 		bpt.decreaseHeight()
 		recordPath.Unprepend()
 	}
@@ -377,7 +743,7 @@ func (bpt *BPTree) ensureNotSparseLeaf(recordPath *recordPath) {
 func (bpt *BPTree) ensureNotSparseNonLeaf(recordPath *recordPath, i int) int {
 	nonLeaf1 := (*recordPath)[i].NonLeaf()
 
-	if !nonLeaf1.IsSparse(bpt.maxDegree) {
+	if !nonLeaf1.IsSparse(bpt.minNonLeafSize) {
 		return i
 	}
 
@@ -387,11 +753,12 @@ func (bpt *BPTree) ensureNotSparseNonLeaf(recordPath *recordPath, i int) int {
 	var nonLeafRightSibling *nonLeaf
 	var nonLeafLeftSibling *nonLeaf
 
-	if nonLeafIndex < len(nonLeafParent.Children())-1 {
-		nonLeafRightSibling = (*nonLeaf)(nonLeafParent.Children()[nonLeafIndex+1].Value)
+	if nonLeafIndex < nonLeafParent.NumberOfChildren()-1 {
+		nonLeafRightSibling = (*nonLeaf)(nonLeafParent.Child(nonLeafIndex + 1))
 
-		if !nonLeafRightSibling.IsSparse(bpt.maxDegree) {
+		if !nonLeafRightSibling.IsSparse(bpt.minNonLeafSize) {
 			nonLeaf1.UnshiftFromRight(nonLeafParent, nonLeafIndex, nonLeafRightSibling)
+			bpt.counters.NumberOfShifts++
 			return i
 		}
 	} else {
@@ -399,10 +766,11 @@ func (bpt *BPTree) ensureNotSparseNonLeaf(recordPath *recordPath, i int) int {
 	}
 
 	if nonLeafIndex >= 1 {
-		nonLeafLeftSibling = (*nonLeaf)(nonLeafParent.Children()[nonLeafIndex-1].Value)
+		nonLeafLeftSibling = (*nonLeaf)(nonLeafParent.Child(nonLeafIndex - 1))
 
-		if !nonLeafLeftSibling.IsSparse(bpt.maxDegree) {
+		if !nonLeafLeftSibling.IsSparse(bpt.minNonLeafSize) {
 			nonLeaf1.UnshiftFromLeft(nonLeafParent, nonLeafIndex, nonLeafLeftSibling)
+			bpt.counters.NumberOfShifts++
 			(*recordPath)[i].SetNodeChildIndex(nonLeafChildIndex + 1)
 			return i
 		}
@@ -418,15 +786,19 @@ func (bpt *BPTree) ensureNotSparseNonLeaf(recordPath *recordPath, i int) int {
 
 	if nonLeafRightSibling != nil {
 		nonLeaf1.MergeFromRight(nonLeafParent, nonLeafIndex, nonLeafRightSibling)
+		bpt.freeNonLeaf(nonLeafRightSibling)
 	} else {
-		numberOfNonLeafChildren := len(nonLeaf1.Children())
+		numberOfNonLeafChildren := nonLeaf1.NumberOfChildren()
 		nonLeaf1.MergeToLeft(nonLeafParent, nonLeafIndex, nonLeafLeftSibling)
+		bpt.freeNonLeaf(nonLeaf1)
 		(*recordPath)[i].SetNonLeaf(nonLeafLeftSibling)
-		(*recordPath)[i].SetNodeChildIndex(len(nonLeafLeftSibling.Children()) - (numberOfNonLeafChildren - nonLeafChildIndex))
+		(*recordPath)[i].SetNodeChildIndex(nonLeafLeftSibling.NumberOfChildren() - (numberOfNonLeafChildren - nonLeafChildIndex))
 		(*recordPath)[i-1].SetNodeChildIndex(nonLeafIndex - 1)
 	}
 
-	if i == 1 && len(nonLeafParent.Children()) == 1 {
+	bpt.counters.NumberOfMerges++
+
+	if i == 1 && nonLeafParent.NumberOfChildren() == 1 {
 		bpt.decreaseHeight()
 		recordPath.Unprepend()
 		return 0
@@ -435,16 +807,48 @@ func (bpt *BPTree) ensureNotSparseNonLeaf(recordPath *recordPath, i int) int {
 	return i
 }
 
+// isAppending reports whether the given record path points to the
+// end of the last leaf.
+func (bpt *BPTree) isAppending(recordPath recordPath) bool {
+	leaf, recordIndex := recordPath.LocateRecord()
+	return leaf == bpt.leafList.Tail() && recordIndex == leaf.NumberOfRecords()
+}
+
+func (bpt *BPTree) removeLeaf(leaf *leaf) {
+	bpt.leafList.RemoveLeaf(leaf)
+
+	if leaf == bpt.finger {
+		bpt.finger = nil
+	}
+
+	bpt.freeLeaf(leaf)
+}
+
 func (bpt *BPTree) increaseHeight() {
-	root := nonLeaf{}
-	root.InsertChild(nodeChild{nil, bpt.root}, 0)
-	bpt.root = unsafe.Pointer(&root)
+	root := bpt.newNonLeaf()
+	root.InsertChild(0, nil, bpt.root)
+	bpt.root = unsafe.Pointer(root)
 	bpt.height++
+	bpt.counters.NumberOfHeightIncreases++
 }
 
 func (bpt *BPTree) decreaseHeight() {
-	bpt.root = (*nonLeaf)(bpt.root).Children()[0].Value
+	root := (*nonLeaf)(bpt.root)
+	bpt.root = root.Child(0)
+	bpt.freeNonLeaf(root)
 	bpt.height--
+	bpt.counters.NumberOfHeightDecreases++
+}
+
+// searchRecords is like findAndLocateRecords but fails if a panic
+// is recovered, with the option RecoverPanics.
+func (bpt *BPTree) searchRecords(minKey interface{}, maxKey interface{}) (*leaf, int, *leaf, int, bool) {
+	if bpt.options.RecoverPanics {
+		bpt.err = nil
+		defer bpt.recoverPanic()
+	}
+
+	return bpt.findAndLocateRecords(minKey, maxKey)
 }
 
 func (bpt *BPTree) findAndLocateRecords(minKey interface{}, maxKey interface{}) (*leaf, int, *leaf, int, bool) {
@@ -466,17 +870,13 @@ func (bpt *BPTree) findAndLocateRecords(minKey interface{}, maxKey interface{})
 		}
 	}
 
-	minRecordPath, ok3 := bpt.findRecord(minKey)
-	minLeaf, minRecordIndex := recordPath.LocateRecord(minRecordPath)
+	minLeaf, minRecordIndex, ok3 := bpt.locateRecord(minKey)
 
 	if !ok3 {
-		if minRecordIndex == len(minLeaf.Records()) {
-			if minLeaf == bpt.leafList.Tail() {
-				return nil, 0, nil, 0, false
-			}
+		var ok bool
 
-			minLeaf = minLeaf.Next
-			minRecordIndex = 0
+		if minLeaf, minRecordIndex, ok = bpt.nextRecord(minLeaf, minRecordIndex); !ok {
+			return nil, 0, nil, 0, false
 		}
 	}
 
@@ -485,7 +885,7 @@ func (bpt *BPTree) findAndLocateRecords(minKey interface{}, maxKey interface{})
 	}
 
 	if ok1 || !ok3 {
-		minKey = minLeaf.Records()[minRecordIndex].Key
+		minKey = minLeaf.Key(minRecordIndex)
 
 		if !ok2 {
 			d = bpt.keyComparer(minKey, maxKey)
@@ -500,24 +900,18 @@ func (bpt *BPTree) findAndLocateRecords(minKey interface{}, maxKey interface{})
 		}
 	}
 
-	maxRecordPath, ok4 := bpt.findRecord(maxKey)
-	maxLeaf, maxRecordIndex := recordPath.LocateRecord(maxRecordPath)
+	maxLeaf, maxRecordIndex, ok4 := bpt.locateRecord(maxKey)
 
 	if !ok4 {
-		// if maxRecordIndex == 0 {
-		//	if maxLeaf == bpt.leafList.Head() {
-		//		return nil, 0, nil, 0, false
-		//	}
+		var ok bool
 
-		//	maxLeaf = maxLeaf.Prev
-		//	maxRecordIndex = len(maxLeaf.Records()) - 1
-		// } else {
-		maxRecordIndex--
-		// }
+		if maxLeaf, maxRecordIndex, ok = bpt.prevRecord(maxLeaf, maxRecordIndex); !ok {
+			return nil, 0, nil, 0, false
+		}
 	}
 
 	if ok2 || !ok4 {
-		maxKey = maxLeaf.Records()[maxRecordIndex].Key
+		maxKey = maxLeaf.Key(maxRecordIndex)
 		d = bpt.keyComparer(minKey, maxKey)
 
 		if d == 0 {
@@ -547,15 +941,21 @@ type leaf struct {
 	Next *leaf
 }
 
-func (l *leaf) Split(numberOfRecords int, parent *nonLeaf, index int) *leaf {
-	newSibling := leaf{
-		records: make([]record, len(l.records)-numberOfRecords),
+// Split moves the records from the given index to the given new
+// sibling. If no records are moved, the key of the new sibling is
+// a placeholder until the first record is inserted into the new
+// sibling.
+func (l *leaf) Split(numberOfRecords int, parent *nonLeaf, index int, newSibling *leaf) {
+	n := l.NumberOfRecords()
+
+	if numberOfRecords == n {
+		parent.InsertChild(index+1, l.Key(n-1), unsafe.Pointer(newSibling))
+		return
 	}
 
-	copy(newSibling.records, l.records[numberOfRecords:])
+	newSibling.AppendRecords(&l.records, numberOfRecords, n)
 	l.Truncate(numberOfRecords)
-	parent.InsertChild(nodeChild{newSibling.records[0].Key, unsafe.Pointer(&newSibling)}, index+1)
-	return &newSibling
+	parent.InsertChild(index+1, newSibling.keys.Separator(l.keys), unsafe.Pointer(newSibling))
 }
 
 func (l *leaf) MergeToLeft(parent *nonLeaf, index int, leftSibling *leaf) {
@@ -564,7 +964,7 @@ func (l *leaf) MergeToLeft(parent *nonLeaf, index int, leftSibling *leaf) {
 
 func (l *leaf) MergeFromRight(parent *nonLeaf, index int, rightSibling *leaf) {
 	parent.RemoveChild(index + 1)
-	l.records = append(l.records, rightSibling.records...)
+	l.AppendRecords(&rightSibling.records, 0, rightSibling.NumberOfRecords())
 	rightSibling.Truncate(0)
 }
 
@@ -577,25 +977,26 @@ func (l *leaf) UnshiftFromRight(parent *nonLeaf, index int, rightSibling *leaf)
 }
 
 func (l *leaf) ShiftToLeft(parent *nonLeaf, index int, leftSibling *leaf) {
-	record := l.RemoveRecord(0)
-	parent.Children()[index].Key = l.records[0].Key
-	leftSibling.InsertRecord(record, len(leftSibling.records))
+	leftSibling.InsertRecordFrom(leftSibling.NumberOfRecords(), &l.records, 0)
+	l.RemoveRecord(0)
+	parent.SetKey(index, l.keys.Separator(leftSibling.keys))
 }
 
 func (l *leaf) ShiftToRight(parent *nonLeaf, index int, rightSibling *leaf) {
-	record := l.RemoveRecord(len(l.records) - 1)
-	rightSibling.InsertRecord(record, 0)
-	parent.Children()[index+1].Key = record.Key
+	recordIndex := l.NumberOfRecords() - 1
+	rightSibling.InsertRecordFrom(0, &l.records, recordIndex)
+	l.RemoveRecord(recordIndex)
+	parent.SetKey(index+1, rightSibling.keys.Separator(l.keys))
 }
 
-func (l *leaf) Records() []record {
-	return l.records
+type records struct {
+	keys   keys
+	values []interface{}
+	digest *digest // the cached digest, see EnableHashing
 }
 
-type records []record
-
-func (rs records) LocateRecord(key interface{}, keyComparer KeyComparer) (int, bool) {
-	n := len(rs)
+func (rs *records) LocateRecord(key interface{}, keyComparer KeyComparer) (int, bool) {
+	n := len(rs.values)
 
 	if n == 0 {
 		return 0, false
@@ -613,63 +1014,92 @@ func (rs records) LocateRecord(key interface{}, keyComparer KeyComparer) (int, b
 		return i, true
 	}
 
-	i, j := 0, n-1
+	return rs.keys.Locate(key, keyComparer)
+}
 
-	for i < j {
-		k := (i + j) / 2
-		// i <= k < j
+func (rs *records) InsertRecord(record record, recordIndex int) {
+	rs.digest = nil
+	rs.keys.Insert(recordIndex, record.Key)
+	rs.values = append(rs.values, nil)
+	copy(rs.values[recordIndex+1:], rs.values[recordIndex:])
+	rs.values[recordIndex] = record.Value
+}
 
-		if keyComparer(rs[k].Key, key) < 0 {
-			i = k + 1
-			// i <= j
-		} else {
-			j = k
-			// j >= i
-		}
-	}
-	// i == j
+func (rs *records) InsertRecordFrom(recordIndex int, other *records, otherRecordIndex int) {
+	rs.digest = nil
+	rs.keys.InsertFrom(recordIndex, other.keys, otherRecordIndex)
+	rs.values = append(rs.values, nil)
+	copy(rs.values[recordIndex+1:], rs.values[recordIndex:])
+	rs.values[recordIndex] = other.values[otherRecordIndex]
+}
 
-	d := keyComparer(rs[i].Key, key)
+func (rs *records) RemoveRecord(recordIndex int) {
+	rs.digest = nil
+	rs.keys.Remove(recordIndex)
+	copy(rs.values[recordIndex:], rs.values[recordIndex+1:])
+	rs.values[len(rs.values)-1] = nil
+	rs.values = rs.values[:len(rs.values)-1]
+}
 
-	if d == 0 {
-		return i, true
+// RemoveRecords removes the records in the given range
+// [firstRecordIndex, lastRecordIndex) with one shift.
+func (rs *records) RemoveRecords(firstRecordIndex, lastRecordIndex int) {
+	rs.digest = nil
+	rs.keys.RemoveRange(firstRecordIndex, lastRecordIndex)
+	n := copy(rs.values[firstRecordIndex:], rs.values[lastRecordIndex:])
+
+	for i := firstRecordIndex + n; i < len(rs.values); i++ {
+		rs.values[i] = nil
 	}
 
-	if d < 0 && i == n-1 {
-		i = n
+	rs.values = rs.values[:firstRecordIndex+n]
+}
+
+func (rs *records) AppendRecords(other *records, firstRecordIndex, lastRecordIndex int) {
+	rs.digest = nil
+	rs.keys.AppendFrom(other.keys, firstRecordIndex, lastRecordIndex)
+	rs.values = append(rs.values, other.values[firstRecordIndex:lastRecordIndex]...)
+}
+
+func (rs *records) Truncate(length int) {
+	rs.digest = nil
+	rs.keys.Truncate(length)
+
+	for i := len(rs.values) - 1; i >= length; i-- {
+		rs.values[i] = nil
 	}
 
-	return i, false
+	rs.values = rs.values[:length]
 }
 
-func (rs *records) InsertRecord(record1 record, recordIndex int) {
-	*rs = append(*rs, record{})
-	copy((*rs)[recordIndex+1:], (*rs)[recordIndex:])
-	(*rs)[recordIndex] = record1
+func (rs *records) NumberOfRecords() int {
+	return len(rs.values)
 }
 
-func (rs *records) RemoveRecord(recordIndex int) record {
-	record1 := (*rs)[recordIndex]
-	copy((*rs)[recordIndex:], (*rs)[recordIndex+1:])
-	(*rs)[len(*rs)-1] = record{}
-	*rs = (*rs)[:len(*rs)-1]
-	return record1
+func (rs *records) Key(recordIndex int) interface{} {
+	return rs.keys.Get(recordIndex)
 }
 
-func (rs *records) Truncate(length int) {
-	for i := len(*rs) - 1; i >= length; i-- {
-		(*rs)[i] = record{}
-	}
+func (rs *records) Value(recordIndex int) interface{} {
+	return rs.values[recordIndex]
+}
+
+func (rs *records) SetValue(recordIndex int, value interface{}) interface{} {
+	rs.digest = nil
+	rs.values[recordIndex], value = value, rs.values[recordIndex]
+	return value
+}
 
-	*rs = (*rs)[:length]
+func (rs *records) MemoryUsage() int64 {
+	return rs.keys.MemoryUsage() + int64(cap(rs.values))*int64(unsafe.Sizeof(interface{}(nil)))
 }
 
-func (rs records) IsSparse(maxDegree int) bool {
-	return len(rs)*2 <= maxDegree
+func (rs *records) IsSparse(minSize int) bool {
+	return len(rs.values) <= minSize
 }
 
-func (rs records) IsFull(maxDegree int) bool {
-	return len(rs) == maxDegree
+func (rs *records) IsFull(capacity int) bool {
+	return len(rs.values) == capacity
 }
 
 type record struct {
@@ -681,17 +1111,13 @@ type nonLeaf struct {
 	nodeChildren
 }
 
-func (nl *nonLeaf) Split(numberOfChildren int, parent *nonLeaf, index int) *nonLeaf {
-	newSibling := nonLeaf{
-		nodeChildren: make([]nodeChild, len(nl.nodeChildren)-numberOfChildren),
-	}
-
-	copy(newSibling.nodeChildren, nl.nodeChildren[numberOfChildren:])
-	key := newSibling.nodeChildren[0].Key
-	newSibling.nodeChildren[0].Key = nil
+func (nl *nonLeaf) Split(numberOfChildren int, parent *nonLeaf, index int, newSibling *nonLeaf) {
+	n := nl.NumberOfChildren()
+	newSibling.keys.AppendFrom(nl.keys, numberOfChildren, n-1)
+	newSibling.children = append(newSibling.children, nl.children[numberOfChildren:]...)
+	parent.keys.InsertFrom(index, nl.keys, numberOfChildren-1)
+	parent.insertChild(index+1, unsafe.Pointer(newSibling))
 	nl.Truncate(numberOfChildren)
-	parent.InsertChild(nodeChild{key, unsafe.Pointer(&newSibling)}, index+1)
-	return &newSibling
 }
 
 func (nl *nonLeaf) MergeToLeft(parent *nonLeaf, index int, leftSibling *nonLeaf) {
@@ -699,9 +1125,11 @@ func (nl *nonLeaf) MergeToLeft(parent *nonLeaf, index int, leftSibling *nonLeaf)
 }
 
 func (nl *nonLeaf) MergeFromRight(parent *nonLeaf, index int, rightSibling *nonLeaf) {
-	rightSibling.nodeChildren[0].Key = parent.nodeChildren[index+1].Key
+	nl.digest = nil
+	nl.keys.InsertFrom(nl.keys.Len(), parent.keys, index)
+	nl.keys.AppendFrom(rightSibling.keys, 0, rightSibling.keys.Len())
+	nl.children = append(nl.children, rightSibling.children...)
 	parent.RemoveChild(index + 1)
-	nl.nodeChildren = append(nl.nodeChildren, rightSibling.nodeChildren...)
 	rightSibling.Truncate(0)
 }
 
@@ -714,29 +1142,32 @@ func (nl *nonLeaf) UnshiftFromRight(parent *nonLeaf, index int, rightSibling *no
 }
 
 func (nl *nonLeaf) ShiftToLeft(parent *nonLeaf, index int, leftSibling *nonLeaf) {
-	child := nl.RemoveChild(0)
-	child.Key = parent.nodeChildren[index].Key
-	parent.nodeChildren[index].Key = nl.nodeChildren[0].Key
-	nl.nodeChildren[0].Key = nil
-	leftSibling.InsertChild(child, len(leftSibling.nodeChildren))
+	leftSibling.keys.InsertFrom(leftSibling.keys.Len(), parent.keys, index-1)
+	leftSibling.insertChild(leftSibling.NumberOfChildren(), nl.children[0])
+	parent.digest = nil
+	parent.keys.SetFrom(index-1, nl.keys, 0)
+	nl.RemoveChild(0)
 }
 
 func (nl *nonLeaf) ShiftToRight(parent *nonLeaf, index int, rightSibling *nonLeaf) {
-	child := nl.RemoveChild(len(nl.nodeChildren) - 1)
-	rightSibling.nodeChildren[0].Key = parent.nodeChildren[index+1].Key
-	parent.nodeChildren[index+1].Key = child.Key
-	child.Key = nil
-	rightSibling.InsertChild(child, 0)
+	childIndex := nl.NumberOfChildren() - 1
+	rightSibling.keys.InsertFrom(0, parent.keys, index)
+	rightSibling.insertChild(0, nl.children[childIndex])
+	parent.digest = nil
+	parent.keys.SetFrom(index, nl.keys, childIndex-1)
+	nl.RemoveChild(childIndex)
 }
 
-func (nl *nonLeaf) Children() []nodeChild {
-	return nl.nodeChildren
+// nodeChildren holds the children of a non-leaf, and the keys of
+// the children except the first one.
+type nodeChildren struct {
+	keys     keys
+	children []unsafe.Pointer
+	digest   *digest // the cached digest, see EnableHashing
 }
 
-type nodeChildren []nodeChild
-
-func (nc nodeChildren) LocateChild(key interface{}, keyComparer KeyComparer) (int, bool) {
-	n := len(nc)
+func (nc *nodeChildren) LocateChild(key interface{}, keyComparer KeyComparer) (int, bool) {
+	n := len(nc.children)
 
 	if x, ok := key.(keyMinMax); ok {
 		var i int
@@ -750,77 +1181,106 @@ func (nc nodeChildren) LocateChild(key interface{}, keyComparer KeyComparer) (in
 		return i, true
 	}
 
-	i, j := 1 /* skip the first child whose key is dummy */, n-1
+	i, ok := nc.keys.Locate(key, keyComparer)
+	return i + 1 /* skip the first child which has no key */, ok
+}
+
+// InsertChild inserts the given child with the given key. The
+// first child has no key, it can be inserted only if there are no
+// children.
+func (nc *nodeChildren) InsertChild(nodeChildIndex int, key interface{}, child unsafe.Pointer) {
+	nc.digest = nil
+
+	if nodeChildIndex >= 1 {
+		nc.keys.Insert(nodeChildIndex-1, key)
+	}
+
+	nc.insertChild(nodeChildIndex, child)
+}
 
-	for i < j {
-		k := (i + j) / 2
-		// i <= k < j
+// RemoveChild removes the child at the given index along with its
+// key. If the first child is removed, the key of the second child
+// is removed instead.
+func (nc *nodeChildren) RemoveChild(nodeChildIndex int) {
+	nc.digest = nil
 
-		if keyComparer(nc[k].Key, key) < 0 {
-			i = k + 1
-			// i <= j
+	if nc.keys.Len() >= 1 {
+		if nodeChildIndex >= 1 {
+			nc.keys.Remove(nodeChildIndex - 1)
 		} else {
-			j = k
-			// j >= i
+			nc.keys.Remove(0)
 		}
 	}
-	// i == j
 
-	d := keyComparer(nc[i].Key, key)
+	copy(nc.children[nodeChildIndex:], nc.children[nodeChildIndex+1:])
+	nc.children[len(nc.children)-1] = nil
+	nc.children = nc.children[:len(nc.children)-1]
+}
 
-	if d == 0 {
-		return i, true
+func (nc *nodeChildren) Truncate(length int) {
+	nc.digest = nil
+
+	if length >= 1 {
+		nc.keys.Truncate(length - 1)
+	} else {
+		nc.keys.Truncate(0)
 	}
 
-	if d < 0 && i == n-1 {
-		i = n
+	for i := len(nc.children) - 1; i >= length; i-- {
+		nc.children[i] = nil
 	}
 
-	return i, false
+	nc.children = nc.children[:length]
 }
 
-func (nc *nodeChildren) InsertChild(nodeChild1 nodeChild, nodeChildIndex int) {
-	*nc = append(*nc, nodeChild{})
-	copy((*nc)[nodeChildIndex+1:], (*nc)[nodeChildIndex:])
-	(*nc)[nodeChildIndex] = nodeChild1
+func (nc *nodeChildren) NumberOfChildren() int {
+	return len(nc.children)
 }
 
-func (nc *nodeChildren) RemoveChild(nodeChildIndex int) nodeChild {
-	nodeChild1 := (*nc)[nodeChildIndex]
-	copy((*nc)[nodeChildIndex:], (*nc)[nodeChildIndex+1:])
-	(*nc)[len(*nc)-1] = nodeChild{}
-	*nc = (*nc)[:len(*nc)-1]
-	return nodeChild1
+func (nc *nodeChildren) Child(nodeChildIndex int) unsafe.Pointer {
+	return nc.children[nodeChildIndex]
 }
 
-func (nc *nodeChildren) Truncate(length int) {
-	for i := len(*nc) - 1; i >= length; i-- {
-		(*nc)[i] = nodeChild{}
-	}
+// Key returns the key of the child at the given index, which
+// must not be the first child.
+func (nc *nodeChildren) Key(nodeChildIndex int) interface{} {
+	return nc.keys.Get(nodeChildIndex - 1)
+}
 
-	*nc = (*nc)[:length]
+// SetKey replaces the key of the child at the given index, which
+// must not be the first child.
+func (nc *nodeChildren) SetKey(nodeChildIndex int, key interface{}) {
+	nc.digest = nil
+	nc.keys.Set(nodeChildIndex-1, key)
 }
 
-func (nc nodeChildren) IsSparse(maxDegree int) bool {
-	return len(nc)*2 <= maxDegree
+func (nc *nodeChildren) MemoryUsage() int64 {
+	return nc.keys.MemoryUsage() + int64(cap(nc.children))*int64(unsafe.Sizeof(unsafe.Pointer(nil)))
 }
 
-func (nc nodeChildren) IsFull(maxDegree int) bool {
-	return len(nc) == maxDegree
+func (nc *nodeChildren) IsSparse(minSize int) bool {
+	return len(nc.children) <= minSize
 }
 
-type nodeChild struct {
-	Key   interface{}
-	Value unsafe.Pointer
+func (nc *nodeChildren) IsFull(capacity int) bool {
+	return len(nc.children) == capacity
+}
+
+func (nc *nodeChildren) insertChild(nodeChildIndex int, child unsafe.Pointer) {
+	nc.digest = nil
+	nc.children = append(nc.children, nil)
+	copy(nc.children[nodeChildIndex+1:], nc.children[nodeChildIndex:])
+	nc.children[nodeChildIndex] = child
 }
 
 func syncKey(recordPath recordPath) {
-	if leaf, recordIndex := recordPath.LocateRecord(); recordIndex == 0 && len(leaf.Records()) >= 1 {
+	if leaf, recordIndex := recordPath.LocateRecord(); recordIndex == 0 && leaf.NumberOfRecords() >= 1 {
 		for i := len(recordPath) - 2; i >= 0; i-- {
 			if recordPath[i].NodeChildIndex() >= 1 {
 				nonLeaf := recordPath[i].NonLeaf()
 				nonLeafChildIndex := recordPath[i].NodeChildIndex()
-				nonLeaf.Children()[nonLeafChildIndex].Key = leaf.Records()[0].Key
+				// the leaf is not the first leaf, so it has a previous leaf.
+				nonLeaf.SetKey(nonLeafChildIndex, leaf.keys.Separator(leaf.Prev.keys))
 				return
 			}
 		}
@@ -379,6 +379,11 @@ func MakeBPTree(t *testing.T, maxDegree int) *bptree.BPTree {
 	}
 
 	bpt.Walk(BPTreeValidator{t, bpt.MaxDegree()}.Validate)
+
+	if !assert.NoError(t, bpt.Check()) {
+		t.FailNow()
+	}
+
 	t.Logf("b+ tree height: %d", bpt.Height())
 	return bpt
 }
@@ -0,0 +1,269 @@
+package bptree
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// bytesKeys stores []byte keys with the common prefix of them
+// once, and the suffixes of them in one contiguous buffer.
+type bytesKeys struct {
+	prefix []byte
+	buffer []byte
+	ends   []int32 // the end offsets of suffixes in the buffer
+}
+
+func (bk *bytesKeys) Len() int {
+	return len(bk.ends)
+}
+
+func (bk *bytesKeys) Get(i int) interface{} {
+	suffix := bk.suffix(i)
+	key := make([]byte, len(bk.prefix)+len(suffix))
+	copy(key[copy(key, bk.prefix):], suffix)
+	return key
+}
+
+func (bk *bytesKeys) Set(i int, key interface{}) {
+	bk.Remove(i)
+	bk.Insert(i, key)
+}
+
+func (bk *bytesKeys) SetFrom(i int, other keys, j int) {
+	bk.Remove(i)
+	bk.InsertFrom(i, other, j)
+}
+
+func (bk *bytesKeys) Locate(key interface{}, _ KeyComparer) (int, bool) {
+	key2 := key.([]byte)
+
+	if !bytes.HasPrefix(key2, bk.prefix) {
+		// all keys have the prefix, so the given key is either less
+		// than all keys or greater than all keys.
+		if bytes.Compare(key2, bk.prefix) < 0 {
+			return 0, false
+		}
+
+		return len(bk.ends), false
+	}
+
+	suffix := key2[len(bk.prefix):]
+	i, j := 0, len(bk.ends)
+
+	for i < j {
+		k := (i + j) / 2
+		// i <= k < j
+
+		if bytes.Compare(bk.suffix(k), suffix) < 0 {
+			i = k + 1
+			// i <= j
+		} else {
+			j = k
+			// j >= i
+		}
+	}
+	// i == j
+
+	return i, i < len(bk.ends) && bytes.Equal(bk.suffix(i), suffix)
+}
+
+func (bk *bytesKeys) Insert(i int, key interface{}) {
+	bk.insert(i, key.([]byte))
+}
+
+func (bk *bytesKeys) InsertFrom(i int, other keys, j int) {
+	otherBK := other.(*bytesKeys)
+
+	if bytes.HasPrefix(otherBK.prefix, bk.prefix) || len(bk.ends) == 0 {
+		bk.insertParts(i, otherBK.prefix, otherBK.suffix(j))
+		return
+	}
+
+	bk.insert(i, otherBK.Get(j).([]byte))
+}
+
+func (bk *bytesKeys) Remove(i int) {
+	bk.RemoveRange(i, i+1)
+}
+
+func (bk *bytesKeys) RemoveRange(i, j int) {
+	if i == j {
+		return
+	}
+
+	start, end := bk.start(i), bk.ends[j-1]
+	bk.buffer = append(bk.buffer[:start], bk.buffer[end:]...)
+	copy(bk.ends[i:], bk.ends[j:])
+	bk.ends = bk.ends[:len(bk.ends)-(j-i)]
+
+	for k := i; k < len(bk.ends); k++ {
+		bk.ends[k] -= end - start
+	}
+
+	if len(bk.ends) == 0 {
+		bk.prefix = nil
+	}
+}
+
+func (bk *bytesKeys) AppendFrom(other keys, i, j int) {
+	if i == j {
+		return
+	}
+
+	otherBK := other.(*bytesKeys)
+	var first []byte
+
+	if len(bk.ends) == 0 {
+		first = otherBK.Get(i).([]byte)
+	} else {
+		first = bk.Get(0).([]byte)
+	}
+
+	last := otherBK.Get(j - 1).([]byte)
+	// keys are sorted, so the common prefix of the first key and
+	// the last key is the common prefix of all keys.
+	bk.setPrefix(first[:commonPrefixLength(first, last)])
+
+	for k := i; k < j; k++ {
+		prefix, suffix := trimKeyParts(otherBK.prefix, otherBK.suffix(k), len(bk.prefix))
+		bk.buffer = append(append(bk.buffer, prefix...), suffix...)
+		bk.ends = append(bk.ends, int32(len(bk.buffer)))
+	}
+}
+
+func (bk *bytesKeys) Truncate(i int) {
+	bk.buffer = bk.buffer[:bk.start(i)]
+	bk.ends = bk.ends[:i]
+
+	if i == 0 {
+		bk.prefix = nil
+		return
+	}
+
+	first, last := bk.suffix(0), bk.suffix(i-1)
+	bk.setPrefix(append(bk.prefix[:len(bk.prefix):len(bk.prefix)], first[:commonPrefixLength(first, last)]...))
+}
+
+func (bk *bytesKeys) Separator(prev keys) interface{} {
+	prevBK := prev.(*bytesKeys)
+	last := prevBK.Get(prevBK.Len() - 1).([]byte)
+	first := bk.Get(0).([]byte)
+	return first[:commonPrefixLength(last, first)+1]
+}
+
+func (bk *bytesKeys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*bk)) + int64(cap(bk.prefix)+cap(bk.buffer)) + int64(cap(bk.ends))*4
+}
+
+func (bk *bytesKeys) insert(i int, key []byte) {
+	if len(bk.ends) >= 1 && !bytes.HasPrefix(key, bk.prefix) {
+		bk.setPrefix(bk.prefix[:commonPrefixLength(bk.prefix, key)])
+	}
+
+	bk.insertParts(i, key, nil)
+}
+
+// insertParts inserts a key which is the concatenation of the
+// given prefix and suffix, the prefix of the keys must be a
+// prefix of the key.
+func (bk *bytesKeys) insertParts(i int, prefix, suffix []byte) {
+	if len(bk.ends) == 0 {
+		bk.prefix = append(append([]byte(nil), prefix...), suffix...)
+		prefix, suffix = nil, nil
+	} else {
+		prefix, suffix = trimKeyParts(prefix, suffix, len(bk.prefix))
+	}
+
+	n := len(prefix) + len(suffix)
+	start := bk.start(i)
+	bk.buffer = append(bk.buffer, make([]byte, n)...)
+	copy(bk.buffer[start+int32(n):], bk.buffer[start:])
+	copy(bk.buffer[start+int32(copy(bk.buffer[start:], prefix)):], suffix)
+	bk.ends = append(bk.ends, 0)
+	copy(bk.ends[i+1:], bk.ends[i:])
+	bk.ends[i] = start
+
+	for k := i; k < len(bk.ends); k++ {
+		bk.ends[k] += int32(n)
+	}
+}
+
+// setPrefix replaces the prefix of the keys with the given one,
+// either of which must be a prefix of the other.
+func (bk *bytesKeys) setPrefix(prefix []byte) {
+	if len(prefix) == len(bk.prefix) {
+		return
+	}
+
+	if len(bk.ends) == 0 {
+		bk.prefix = append([]byte(nil), prefix...)
+		return
+	}
+
+	var buffer []byte
+	ends := make([]int32, 0, len(bk.ends))
+
+	if len(prefix) < len(bk.prefix) {
+		prefixTail := bk.prefix[len(prefix):]
+		buffer = make([]byte, 0, len(bk.buffer)+len(bk.ends)*len(prefixTail))
+
+		for i := range bk.ends {
+			buffer = append(append(buffer, prefixTail...), bk.suffix(i)...)
+			ends = append(ends, int32(len(buffer)))
+		}
+	} else {
+		n := len(prefix) - len(bk.prefix)
+		buffer = make([]byte, 0, len(bk.buffer)-len(bk.ends)*n)
+
+		for i := range bk.ends {
+			buffer = append(buffer, bk.suffix(i)[n:]...)
+			ends = append(ends, int32(len(buffer)))
+		}
+	}
+
+	bk.prefix = append([]byte(nil), prefix...)
+	bk.buffer = buffer
+	bk.ends = ends
+}
+
+func (bk *bytesKeys) suffix(i int) []byte {
+	return bk.buffer[bk.start(i):bk.ends[i]]
+}
+
+func (bk *bytesKeys) start(i int) int32 {
+	if i == 0 {
+		return 0
+	}
+
+	return bk.ends[i-1]
+}
+
+// trimKeyParts removes the first n bytes from a key which is the
+// concatenation of the given prefix and suffix.
+func trimKeyParts(prefix, suffix []byte, n int) ([]byte, []byte) {
+	if n <= len(prefix) {
+		return prefix[n:], suffix
+	}
+
+	return nil, suffix[n-len(prefix):]
+}
+
+func commonPrefixLength(a, b []byte) int {
+	n := len(a)
+
+	if n > len(b) {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return n
+}
+
+func compareBytes(key1, key2 interface{}) int64 {
+	return int64(bytes.Compare(key1.([]byte), key2.([]byte)))
+}
@@ -0,0 +1,139 @@
+package bptree
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Check checks the invariants of the B+ tree, which are the sizes
+// of nodes, the order of keys, the bounds set by separator keys
+// and the consistency of the leaf list. If any insertions at the end
+// of the B+ tree have split leaves (see Counters.NumberOfAppendSplits),
+// the last leaf, which may be left with few records, is exempt from
+// the minimum size.
+// It returns an error describing the first violation found, or
+// nil if the B+ tree is healthy.
+func (bpt *BPTree) Check() error {
+	bpt.lazyInit()
+
+	checker := checker{
+		bpt:         bpt,
+		NextLeaf:    bpt.leafList.Head(),
+		IsFirstLeaf: true,
+	}
+
+	if err := checker.CheckNode(bpt.root, 1, nil, nil, "n"); err != nil {
+		return err
+	}
+
+	if checker.LastLeaf != bpt.leafList.Tail() {
+		return errors.New("bptree: tail of leaf list mismatch")
+	}
+
+	if checker.LastLeaf.Next != bpt.leafList.Head() {
+		return errors.New("bptree: leaf list not circular")
+	}
+
+	return nil
+}
+
+type checker struct {
+	bpt         *BPTree
+	NextLeaf    *leaf
+	LastLeaf    *leaf
+	IsFirstLeaf bool
+}
+
+func (c *checker) CheckNode(node unsafe.Pointer, nodeDepth int, minKey, maxKey interface{}, nodeName string) error {
+	if nodeDepth == c.bpt.height {
+		return c.checkLeaf((*leaf)(node), minKey, maxKey, nodeName)
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+	numberOfChildren := nonLeaf.NumberOfChildren()
+
+	if n := numberOfChildren; n > c.bpt.options.NonLeafCapacity || n < 2 || (nodeDepth >= 2 && n < c.bpt.minNonLeafSize) {
+		return fmt.Errorf("bptree: invalid number of children of node %v: %v", nodeName, n)
+	}
+
+	for i := 1; i < numberOfChildren; i++ {
+		key := nonLeaf.Key(i)
+
+		if err := c.checkKey(key, minKey, maxKey, nodeName); err != nil {
+			return err
+		}
+
+		if i >= 2 && c.bpt.keyComparer(nonLeaf.Key(i-1), key) >= 0 {
+			return fmt.Errorf("bptree: keys of node %v out of order: %v >= %v", nodeName, nonLeaf.Key(i-1), key)
+		}
+	}
+
+	for i := 0; i < numberOfChildren; i++ {
+		childMinKey, childMaxKey := minKey, maxKey
+
+		if i >= 1 {
+			childMinKey = nonLeaf.Key(i)
+		}
+
+		if i < numberOfChildren-1 {
+			childMaxKey = nonLeaf.Key(i + 1)
+		}
+
+		if err := c.CheckNode(nonLeaf.Child(i), nodeDepth+1, childMinKey, childMaxKey, fmt.Sprintf("%s_%d", nodeName, i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *checker) checkLeaf(leaf *leaf, minKey, maxKey interface{}, nodeName string) error {
+	numberOfRecords := leaf.NumberOfRecords()
+	isExempt := leaf == c.bpt.leafList.Tail() && c.bpt.counters.NumberOfAppendSplits >= 1
+
+	if n := numberOfRecords; n > c.bpt.options.LeafCapacity || (c.bpt.height >= 2 && (n < 1 || (!isExempt && n < c.bpt.minLeafSize))) {
+		return fmt.Errorf("bptree: invalid number of records of node %v: %v", nodeName, n)
+	}
+
+	for i := 0; i < numberOfRecords; i++ {
+		key := leaf.Key(i)
+
+		if err := c.checkKey(key, minKey, maxKey, nodeName); err != nil {
+			return err
+		}
+
+		if i >= 1 && c.bpt.keyComparer(leaf.Key(i-1), key) >= 0 {
+			return fmt.Errorf("bptree: keys of node %v out of order: %v >= %v", nodeName, leaf.Key(i-1), key)
+		}
+	}
+
+	if leaf != c.NextLeaf {
+		return fmt.Errorf("bptree: node %v out of leaf list", nodeName)
+	}
+
+	if !c.IsFirstLeaf && leaf.Prev != c.LastLeaf {
+		return fmt.Errorf("bptree: invalid previous leaf of node %v", nodeName)
+	}
+
+	c.NextLeaf = leaf.Next
+	c.LastLeaf = leaf
+	c.IsFirstLeaf = false
+	return nil
+}
+
+func (c *checker) checkKey(key, minKey, maxKey interface{}, nodeName string) error {
+	if _, ok := key.(keyMinMax); ok {
+		return fmt.Errorf("bptree: invalid key in node %v: %v", nodeName, key)
+	}
+
+	if minKey != nil && c.bpt.keyComparer(key, minKey) < 0 {
+		return fmt.Errorf("bptree: key of node %v out of bounds: %v < %v", nodeName, key, minKey)
+	}
+
+	if maxKey != nil && c.bpt.keyComparer(key, maxKey) >= 0 {
+		return fmt.Errorf("bptree: key of node %v out of bounds: %v >= %v", nodeName, key, maxKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package bptree
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Clone returns a deep copy of the B+ tree with the identical
+// structure. Values are copied with the given value copier, or
+// shared if the value copier is nil. Keys of generic kind are
+// shared, and must not be modified by the user.
+// Node pooling of the copy is enabled with an empty pool if it is
+// enabled for the B+ tree. Hashing of the copy is enabled if it is
+// enabled for the B+ tree, in which case the hashes of the B+ tree
+// are computed first and shared with the copy, so that Diff can skip
+// the subtrees of both left untouched since then.
+func (bpt *BPTree) Clone(valueCopier func(value interface{}) interface{}) *BPTree {
+	bpt.lazyInit()
+
+	clone := BPTree{
+		options:        bpt.options,
+		minLeafSize:    bpt.minLeafSize,
+		minNonLeafSize: bpt.minNonLeafSize,
+		keyKind:        bpt.keyKind,
+		keyComparer:    bpt.keyComparer,
+		height:         bpt.height,
+		counters:       bpt.counters,
+		hasher:         bpt.hasher,
+		sequenceNumber: bpt.sequenceNumber,
+	}
+
+	clone.comparerChecker = newComparerChecker(clone.options)
+
+	if bpt.nodePool != nil {
+		// not EnableNodePooling, which would initialize the copy as
+		// a zero value since it has no root yet.
+		clone.nodePool = &nodePool{maxNumberOfFreeNodes: bpt.nodePool.maxNumberOfFreeNodes}
+	}
+
+	if bpt.hasher != nil {
+		bpt.nodeDigest(bpt.root, 1)
+	}
+
+	clone.root = clone.cloneNode(bpt.root, 1, valueCopier)
+	return &clone
+}
+
+func (bpt *BPTree) cloneNode(node unsafe.Pointer, nodeDepth int, valueCopier func(interface{}) interface{}) unsafe.Pointer {
+	if nodeDepth == bpt.height {
+		leaf1 := (*leaf)(node)
+		leaf2 := bpt.newLeaf()
+		n := leaf1.NumberOfRecords()
+		leaf2.AppendRecords(&leaf1.records, 0, n)
+
+		if valueCopier != nil {
+			for i := 0; i < n; i++ {
+				leaf2.SetValue(i, valueCopier(leaf2.Value(i)))
+			}
+		}
+
+		// digests are never modified once computed, so they can be
+		// shared.
+		leaf2.digest = leaf1.digest
+
+		if bpt.leafList.Head() == nil {
+			bpt.leafList.Init(leaf2)
+		} else {
+			bpt.leafList.InsertLeafAfter(leaf2, bpt.leafList.Tail())
+		}
+
+		return unsafe.Pointer(leaf2)
+	}
+
+	nonLeaf1 := (*nonLeaf)(node)
+	nonLeaf2 := bpt.newNonLeaf()
+	nonLeaf2.keys.AppendFrom(nonLeaf1.keys, 0, nonLeaf1.keys.Len())
+
+	for i := 0; i < nonLeaf1.NumberOfChildren(); i++ {
+		nonLeaf2.insertChild(i, bpt.cloneNode(nonLeaf1.Child(i), nodeDepth+1, valueCopier))
+	}
+
+	nonLeaf2.digest = nonLeaf1.digest
+
+	return unsafe.Pointer(nonLeaf2)
+}
+
+// Equal reports whether the B+ tree and the given one have the
+// same records, regardless of their structures. Keys are compared
+// with the key comparer of the B+ tree, and values are compared
+// with the given value comparer, or reflect.DeepEqual if the value
+// comparer is nil.
+func (bpt *BPTree) Equal(other *BPTree, valueEqual func(value1, value2 interface{}) bool) bool {
+	bpt.lazyInit()
+	other.lazyInit()
+
+	if valueEqual == nil {
+		valueEqual = reflect.DeepEqual
+	}
+
+	leaf1, recordIndex1, ok1 := bpt.nextRecord(bpt.leafList.Head(), 0)
+	leaf2, recordIndex2, ok2 := other.nextRecord(other.leafList.Head(), 0)
+
+	for ok1 && ok2 {
+		if bpt.keyComparer(leaf1.Key(recordIndex1), leaf2.Key(recordIndex2)) != 0 {
+			return false
+		}
+
+		if !valueEqual(leaf1.Value(recordIndex1), leaf2.Value(recordIndex2)) {
+			return false
+		}
+
+		leaf1, recordIndex1, ok1 = bpt.nextRecord(leaf1, recordIndex1+1)
+		leaf2, recordIndex2, ok2 = other.nextRecord(leaf2, recordIndex2+1)
+	}
+
+	return ok1 == ok2
+}
+
+// EqualShape reports whether the B+ tree and the given one have
+// the identical structure, which means the same height, and nodes
+// with the same keys at the same positions. Values are ignored.
+// Keys are compared with the key comparer of the B+ tree.
+func (bpt *BPTree) EqualShape(other *BPTree) bool {
+	bpt.lazyInit()
+	other.lazyInit()
+	return bpt.height == other.height && bpt.equalNodeShape(bpt.root, other.root, 1)
+}
+
+func (bpt *BPTree) equalNodeShape(node1, node2 unsafe.Pointer, nodeDepth int) bool {
+	if nodeDepth == bpt.height {
+		leaf1, leaf2 := (*leaf)(node1), (*leaf)(node2)
+		return bpt.equalKeys(leaf1.keys, leaf2.keys)
+	}
+
+	nonLeaf1, nonLeaf2 := (*nonLeaf)(node1), (*nonLeaf)(node2)
+
+	if !bpt.equalKeys(nonLeaf1.keys, nonLeaf2.keys) {
+		return false
+	}
+
+	for i := 0; i < nonLeaf1.NumberOfChildren(); i++ {
+		if !bpt.equalNodeShape(nonLeaf1.Child(i), nonLeaf2.Child(i), nodeDepth+1) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (bpt *BPTree) equalKeys(keys1, keys2 keys) bool {
+	n := keys1.Len()
+
+	if keys2.Len() != n {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		if bpt.keyComparer(keys1.Get(i), keys2.Get(i)) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
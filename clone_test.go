@@ -0,0 +1,119 @@
+package bptree_test
+
+import (
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeClone(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	bpt2 := bpt.Clone(nil)
+
+	if !assert.NoError(t, bpt2.Check()) {
+		t.FailNow()
+	}
+
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.EqualShape(bpt2))
+	stats, stats2 := bpt.Stats(), bpt2.Stats()
+	// the copy allocates no spare capacity.
+	assert.True(t, stats2.EstimatedMemoryUsage <= stats.EstimatedMemoryUsage)
+	stats2.EstimatedMemoryUsage = stats.EstimatedMemoryUsage
+	assert.Equal(t, stats, stats2)
+
+	for _, k := range Keywords[:1000] {
+		bpt2.DeleteRecord(k)
+	}
+
+	assert.NoError(t, bpt2.Check())
+	assert.NoError(t, bpt.Check())
+	assert.False(t, bpt.Equal(bpt2, nil))
+	assert.False(t, bpt.EqualShape(bpt2))
+	assert.Equal(t, len(Keywords), bpt.Stats().NumberOfRecords)
+
+	for i, k := range Keywords[:1000] {
+		bpt2.AddRecord(k, i)
+	}
+
+	assert.True(t, bpt.Equal(bpt2, nil))
+}
+
+func TestBPTreeCloneWithNodePooling(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(5, bptree.Int64Keys, nil)
+	bpt.EnableNodePooling(10)
+	bpt.EnableHashing(nil, nil)
+
+	for i := int64(0); i < 100; i++ {
+		bpt.AddRecord(i, "x")
+	}
+
+	bpt2 := bpt.Clone(nil)
+
+	if !assert.NoError(t, bpt2.Check()) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, bptree.Int64Keys, bpt2.KeyKind())
+	assert.Equal(t, 5, bpt2.Options().LeafCapacity)
+	assert.Equal(t, 5, bpt2.Options().NonLeafCapacity)
+	assert.Equal(t, bpt.RootHash(), bpt2.RootHash())
+	assert.Equal(t, bpt.Counters(), bpt2.Counters())
+	assert.True(t, bpt.EqualShape(bpt2))
+
+	for i := int64(0); i < 100; i++ {
+		bpt2.DeleteRecord(i)
+	}
+
+	assert.NoError(t, bpt2.Check())
+	assert.Equal(t, 10, bpt2.Stats().NumberOfFreeNodes)
+	assert.Equal(t, 0, bpt.Stats().NumberOfFreeNodes)
+}
+
+func TestBPTreeCloneWithValueCopier(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.BytesKeys, nil)
+
+	for i, k := range Keywords[:100] {
+		bpt.AddRecord([]byte(k), []int{i})
+	}
+
+	bpt2 := bpt.Clone(func(value interface{}) interface{} {
+		return append([]int(nil), value.([]int)...)
+	})
+
+	assert.NoError(t, bpt2.Check())
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.EqualShape(bpt2))
+
+	value, _ := bpt2.HasRecord([]byte(Keywords[0]))
+	value.([]int)[0] = -1
+	assert.False(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.Equal(bpt2, func(value1, value2 interface{}) bool { return true }))
+	value, _ = bpt.HasRecord([]byte(Keywords[0]))
+	assert.Equal(t, []int{0}, value)
+}
+
+func TestBPTreeEqualShape(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	bpt2 := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.EqualShape(bpt2))
+
+	for i := int64(0); i < 100; i++ {
+		bpt.AddRecord(i, nil)
+		bpt2.AddRecord(99-i, nil)
+	}
+
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.False(t, bpt.EqualShape(bpt2))
+	bpt.Compact(1)
+	bpt2.Compact(1)
+	assert.True(t, bpt.EqualShape(bpt2))
+	bpt2.UpdateRecord(int64(0), 0)
+	assert.True(t, bpt.EqualShape(bpt2))
+	assert.False(t, bpt.Equal(bpt2, nil))
+	bpt2.DeleteRecord(int64(99))
+	assert.False(t, bpt.Equal(bpt2, nil))
+	assert.False(t, bpt2.Equal(bpt, nil))
+}
@@ -0,0 +1,58 @@
+// Command bptree-resp serves sorted sets kept in B+ trees over
+// the Redis protocol, so that Redis clients like redis-cli can
+// work against it.
+//
+// Usage:
+//
+//	bptree-resp [-addr ADDRESS] [-degree N]
+//
+// See package resp for the supported commands. The server shuts
+// down on SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roy2220/bptree/resp"
+)
+
+func main() {
+	address := flag.String("addr", "127.0.0.1:6379", "address to listen on")
+	maxDegree := flag.Int("degree", 64, "maximum degree of the B+ trees")
+	flag.Parse()
+
+	if err := run(*address, *maxDegree); err != nil {
+		fmt.Fprintf(os.Stderr, "bptree-resp: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(address string, maxDegree int) error {
+	if maxDegree < 4 {
+		return fmt.Errorf("invalid maximum degree: %d", maxDegree)
+	}
+
+	listener, err := net.Listen("tcp", address)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	fmt.Fprintf(os.Stderr, "bptree-resp: listening on %v\n", listener.Addr())
+	return new(resp.Server).Init(resp.Options{MaxDegree: maxDegree}).Serve(ctx, listener)
+}
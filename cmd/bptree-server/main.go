@@ -0,0 +1,57 @@
+// Command bptree-server serves a B+ tree as an ordered key-value
+// service over HTTP/JSON.
+//
+// Usage:
+//
+//	bptree-server [-addr ADDRESS] [-degree N]
+//
+// See package server for the endpoints. The server shuts down
+// gracefully on SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roy2220/bptree/server"
+)
+
+func main() {
+	address := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	maxDegree := flag.Int("degree", 64, "maximum degree of the B+ tree")
+	flag.Parse()
+
+	if err := run(*address, *maxDegree); err != nil {
+		fmt.Fprintf(os.Stderr, "bptree-server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(address string, maxDegree int) error {
+	if maxDegree < 4 {
+		return fmt.Errorf("invalid maximum degree: %d", maxDegree)
+	}
+
+	listener, err := net.Listen("tcp", address)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	fmt.Fprintf(os.Stderr, "bptree-server: listening on %v\n", listener.Addr())
+	return new(server.Server).Init(server.Options{MaxDegree: maxDegree}).Serve(ctx, listener)
+}
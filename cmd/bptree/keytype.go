@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/roy2220/bptree"
+)
+
+type keyType struct {
+	Name  string
+	Kind  bptree.KeyKind
+	Parse func(s string) (key interface{}, err error)
+}
+
+func parseKeyType(name string) (keyType, error) {
+	for _, keyType := range keyTypes {
+		if keyType.Name == name {
+			return keyType, nil
+		}
+	}
+
+	return keyType{}, fmt.Errorf("invalid key type: %q", name)
+}
+
+var keyTypes = []keyType{
+	{
+		Name: "string",
+		Kind: bptree.StringKeys,
+
+		Parse: func(s string) (interface{}, error) {
+			return s, nil
+		},
+	},
+	{
+		Name: "int",
+		Kind: bptree.Int64Keys,
+
+		Parse: func(s string) (interface{}, error) {
+			return strconv.ParseInt(s, 10, 64)
+		},
+	},
+	{
+		Name: "float",
+		Kind: bptree.Float64Keys,
+
+		Parse: func(s string) (interface{}, error) {
+			x, err := strconv.ParseFloat(s, 64)
+
+			if err == nil && math.IsNaN(x) {
+				err = errors.New("not a number")
+			}
+
+			return x, err
+		},
+	},
+}
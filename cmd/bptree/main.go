@@ -0,0 +1,105 @@
+// Command bptree is an interactive shell for exploring B+ trees.
+//
+// Usage:
+//
+//	bptree [-degree N] [-keytype string|int|float] [script-file]
+//	bptree replay trace-file
+//
+// Commands are read from the given script file, or from the
+// standard input if no script file is given. Type "help" for
+// a list of commands.
+//
+// The replay subcommand re-runs a trace recorded by
+// BPTree.StartTrace with bptree.GobMutationEncoder against a fresh
+// B+ tree, and stops at the first step after which the B+ tree is
+// corrupted. Generic keys are compared by the default key comparer
+// of bptree, which orders keys of well-known types naturally, so
+// traces of generic keys in custom orders can only be replayed with
+// bptree.Replay and the custom key comparer.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/roy2220/bptree"
+)
+
+func main() {
+	maxDegree := flag.Int("degree", 32, "maximum degree of the B+ tree")
+	keyTypeName := flag.String("keytype", "string", "type of keys: string, int or float")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [script-file]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s replay trace-file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+	var err error
+
+	if args := flag.Args(); len(args) >= 1 && args[0] == "replay" {
+		err = runReplay(args[1:], os.Stdout)
+	} else {
+		err = run(*maxDegree, *keyTypeName, args)
+	}
+
+	if err != nil {
+		if err == errUsage {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		fmt.Fprintf(os.Stderr, "bptree: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage is returned for invalid command-line arguments.
+var errUsage = errors.New("usage")
+
+func run(maxDegree int, keyTypeName string, args []string) error {
+	if maxDegree < 4 {
+		return fmt.Errorf("invalid maximum degree: %d", maxDegree)
+	}
+
+	keyType, err := parseKeyType(keyTypeName)
+
+	if err != nil {
+		return err
+	}
+
+	shell := shell{
+		BPTree:  new(bptree.BPTree).InitWithKeyKind(maxDegree, keyType.Kind, nil),
+		KeyType: keyType,
+		Output:  os.Stdout,
+	}
+
+	var input io.Reader
+	var prompt string
+
+	switch len(args) {
+	case 0:
+		input = os.Stdin
+
+		if fileInfo, err := os.Stdin.Stat(); err == nil && fileInfo.Mode()&os.ModeCharDevice != 0 {
+			prompt = "bptree> "
+		}
+	case 1:
+		file, err := os.Open(args[0])
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		input = file
+		shell.StopOnError = true
+	default:
+		return errUsage
+	}
+
+	return shell.Run(input, prompt)
+}
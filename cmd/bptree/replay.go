@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/roy2220/bptree"
+)
+
+// runReplay replays the trace file recorded by BPTree.StartTrace
+// with the gob encoder, checking the B+ tree after each step.
+func runReplay(args []string, output io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	file, err := os.Open(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	bpt, n, err := bptree.Replay(file, bptree.GobMutationEncoder{}, nil)
+
+	if err != nil {
+		var replayError *bptree.ReplayError
+
+		if errors.As(err, &replayError) {
+			fmt.Fprintf(output, "violation after %d steps\n", n)
+		}
+
+		return err
+	}
+
+	stats := bpt.Stats()
+	fmt.Fprintf(output, "replayed %d steps without violations: %d records, height %d\n", n, stats.NumberOfRecords, bpt.Height())
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "bptree")
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dirName)
+	fileName := filepath.Join(dirName, "trace")
+	file, err := os.Create(fileName)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	bpt.StartTrace(file, bptree.GobMutationEncoder{})
+
+	for _, k := range []string{"c", "a", "b", "d", "e"} {
+		bpt.AddRecord(k, k)
+	}
+
+	bpt.DeleteRecord("d")
+	bpt.SearchForward("a", "c")
+	assert.NoError(t, bpt.StopTrace())
+	assert.NoError(t, file.Close())
+
+	output := bytes.NewBuffer(nil)
+
+	if assert.NoError(t, runReplay([]string{fileName}, output)) {
+		assert.Equal(t, "replayed 7 steps without violations: 4 records, height 2\n", output.String())
+	}
+
+	assert.Equal(t, errUsage, runReplay(nil, output))
+	assert.Equal(t, errUsage, runReplay([]string{fileName, fileName}, output))
+	assert.Error(t, runReplay([]string{filepath.Join(dirName, "missing")}, output))
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("garbage"), 0644))
+	assert.Error(t, runReplay([]string{fileName}, output))
+}
+
+func TestReplayGenericKeys(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "bptree")
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dirName)
+	fileName := filepath.Join(dirName, "trace")
+	file, err := os.Create(fileName)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	bpt, err := bptree.New(bptree.WithMaxDegree(4))
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	bpt.StartTrace(file, bptree.GobMutationEncoder{})
+
+	for i := 0; i < 20; i++ {
+		bpt.AddRecord(i*7%20, i)
+	}
+
+	bpt.DeleteRecord(13)
+	assert.NoError(t, bpt.StopTrace())
+	assert.NoError(t, file.Close())
+	output := bytes.NewBuffer(nil)
+
+	if assert.NoError(t, runReplay([]string{fileName}, output)) {
+		assert.Equal(t, fmt.Sprintf("replayed 21 steps without violations: 19 records, height %d\n", bpt.Height()), output.String())
+	}
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/roy2220/bptree"
+)
+
+type shell struct {
+	BPTree      *bptree.BPTree
+	KeyType     keyType
+	Output      io.Writer
+	StopOnError bool
+}
+
+func (s *shell) Run(input io.Reader, prompt string) error {
+	scanner := bufio.NewScanner(input)
+	lineNumber := 0
+
+	for {
+		if prompt != "" {
+			fmt.Fprint(s.Output, prompt)
+		}
+
+		if !scanner.Scan() {
+			break
+		}
+
+		lineNumber++
+		err := s.Execute(scanner.Text())
+
+		if err == errQuit {
+			return nil
+		}
+
+		if err != nil {
+			if s.StopOnError {
+				return fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+
+			fmt.Fprintf(s.Output, "error: %v\n", err)
+		}
+	}
+
+	if prompt != "" {
+		fmt.Fprintln(s.Output)
+	}
+
+	return scanner.Err()
+}
+
+func (s *shell) Execute(line string) error {
+	args, err := splitLine(line)
+
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return nil
+	}
+
+	for _, command := range commands {
+		if command.Name != args[0] {
+			continue
+		}
+
+		if n := len(args) - 1; n < command.MinNumberOfArgs || n > command.MaxNumberOfArgs {
+			return fmt.Errorf("usage: %s %s", command.Name, command.Usage)
+		}
+
+		return command.Execute(s, args[1:])
+	}
+
+	return fmt.Errorf("unknown command: %q, type \"help\" for a list of commands", args[0])
+}
+
+func (s *shell) parseKey(arg string) (interface{}, error) {
+	key, err := s.KeyType.Parse(arg)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %q", arg)
+	}
+
+	return key, nil
+}
+
+func (s *shell) parseBoundKey(arg string) (interface{}, error) {
+	switch arg {
+	case "-":
+		return bptree.KeyMin, nil
+	case "+":
+		return bptree.KeyMax, nil
+	default:
+		return s.parseKey(arg)
+	}
+}
+
+func (s *shell) search(args []string, search func(minKey, maxKey interface{}) bptree.Iterator) error {
+	minKeyArg, maxKeyArg := "-", "+"
+	limit := -1
+
+	switch len(args) {
+	case 3:
+		var err error
+		limit, err = strconv.Atoi(args[2])
+
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid limit: %q", args[2])
+		}
+
+		fallthrough
+	case 2:
+		minKeyArg, maxKeyArg = args[0], args[1]
+	}
+
+	minKey, err := s.parseBoundKey(minKeyArg)
+
+	if err != nil {
+		return err
+	}
+
+	maxKey, err := s.parseBoundKey(maxKeyArg)
+
+	if err != nil {
+		return err
+	}
+
+	for it := search(minKey, maxKey); !it.IsAtEnd() && limit != 0; it.Advance() {
+		key, value := it.Record()
+		s.printRecord(key, value)
+		limit--
+	}
+
+	return nil
+}
+
+func (s *shell) printRecord(key, value interface{}) {
+	if value == nil {
+		fmt.Fprintf(s.Output, "%v\n", key)
+	} else {
+		fmt.Fprintf(s.Output, "%v\t%v\n", key, value)
+	}
+}
+
+func (s *shell) load(fileName string) error {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	numberOfRecords := 0
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+
+		if line == "" {
+			continue
+		}
+
+		var value interface{}
+
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			rawValue, err := unquoteField(line[i+1:])
+
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", fileName, lineNumber, err)
+			}
+
+			line, value = line[:i], rawValue
+		}
+
+		rawKey, err := unquoteField(line)
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", fileName, lineNumber, err)
+		}
+
+		key, err := s.parseKey(rawKey)
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", fileName, lineNumber, err)
+		}
+
+		s.BPTree.AddOrUpdateRecord(key, value)
+		numberOfRecords++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.Output, "%d records loaded\n", numberOfRecords)
+	return nil
+}
+
+func (s *shell) save(fileName string) error {
+	file, err := os.Create(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	numberOfRecords := 0
+
+	for it := s.BPTree.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+		key, value := it.Record()
+
+		// keys and values are quoted, so that they can be loaded back
+		// even if they contain tabs or newlines.
+		if value == nil {
+			fmt.Fprintf(writer, "%s\n", strconv.Quote(fmt.Sprint(key)))
+		} else {
+			fmt.Fprintf(writer, "%s\t%s\n", strconv.Quote(fmt.Sprint(key)), strconv.Quote(fmt.Sprint(value)))
+		}
+
+		numberOfRecords++
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.Output, "%d records saved\n", numberOfRecords)
+	return nil
+}
+
+type command struct {
+	Name            string
+	Usage           string
+	Description     string
+	MinNumberOfArgs int
+	MaxNumberOfArgs int
+	Execute         func(s *shell, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			Name:            "add",
+			Usage:           "KEY [VALUE]",
+			Description:     "add a record",
+			MinNumberOfArgs: 1,
+			MaxNumberOfArgs: 2,
+
+			Execute: func(s *shell, args []string) error {
+				key, err := s.parseKey(args[0])
+
+				if err != nil {
+					return err
+				}
+
+				var value interface{}
+
+				if len(args) == 2 {
+					value = args[1]
+				}
+
+				if presentValue, ok := s.BPTree.AddRecord(key, value); !ok {
+					return fmt.Errorf("record exists: %v", presentValue)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:            "update",
+			Usage:           "KEY VALUE",
+			Description:     "update the value of a record",
+			MinNumberOfArgs: 2,
+			MaxNumberOfArgs: 2,
+
+			Execute: func(s *shell, args []string) error {
+				key, err := s.parseKey(args[0])
+
+				if err != nil {
+					return err
+				}
+
+				if _, ok := s.BPTree.UpdateRecord(key, args[1]); !ok {
+					return errRecordNotFound
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:            "del",
+			Usage:           "KEY",
+			Description:     "delete a record",
+			MinNumberOfArgs: 1,
+			MaxNumberOfArgs: 1,
+
+			Execute: func(s *shell, args []string) error {
+				key, err := s.parseKey(args[0])
+
+				if err != nil {
+					return err
+				}
+
+				if _, ok := s.BPTree.DeleteRecord(key); !ok {
+					return errRecordNotFound
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:            "get",
+			Usage:           "KEY",
+			Description:     "print a record",
+			MinNumberOfArgs: 1,
+			MaxNumberOfArgs: 1,
+
+			Execute: func(s *shell, args []string) error {
+				key, err := s.parseKey(args[0])
+
+				if err != nil {
+					return err
+				}
+
+				value, ok := s.BPTree.HasRecord(key)
+
+				if !ok {
+					return errRecordNotFound
+				}
+
+				s.printRecord(key, value)
+				return nil
+			},
+		},
+		{
+			Name:            "range",
+			Usage:           "[MIN MAX [LIMIT]]",
+			Description:     "print records with keys in [MIN, MAX] in ascending order, \"-\" and \"+\" stand for the minimum and maximum keys",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 3,
+
+			Execute: func(s *shell, args []string) error {
+				if len(args) == 1 {
+					return errors.New("usage: range [MIN MAX [LIMIT]]")
+				}
+
+				return s.search(args, s.BPTree.SearchForward)
+			},
+		},
+		{
+			Name:            "rrange",
+			Usage:           "[MIN MAX [LIMIT]]",
+			Description:     "print records with keys in [MIN, MAX] in descending order",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 3,
+
+			Execute: func(s *shell, args []string) error {
+				if len(args) == 1 {
+					return errors.New("usage: rrange [MIN MAX [LIMIT]]")
+				}
+
+				return s.search(args, s.BPTree.SearchBackward)
+			},
+		},
+		{
+			Name:            "print",
+			Usage:           "[MAX-DEPTH [MAX-KEYS-PER-NODE]]",
+			Description:     "print the B+ tree",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 2,
+
+			Execute: func(s *shell, args []string) error {
+				options := bptree.FprintOptions{ShowSummary: true}
+
+				for i, arg := range args {
+					n, err := strconv.Atoi(arg)
+
+					if err != nil {
+						return fmt.Errorf("invalid number: %q", arg)
+					}
+
+					if i == 0 {
+						options.MaxDepth = n
+					} else {
+						options.MaxKeysPerNode = n
+					}
+				}
+
+				if err := s.BPTree.FprintWithOptions(s.Output, options); err != nil {
+					return err
+				}
+
+				fmt.Fprintln(s.Output)
+				return nil
+			},
+		},
+		{
+			Name:            "stats",
+			Description:     "print the statistics of the B+ tree",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 0,
+
+			Execute: func(s *shell, _ []string) error {
+				stats := s.BPTree.Stats()
+				fmt.Fprintf(s.Output, "records: %d\n", stats.NumberOfRecords)
+				fmt.Fprintf(s.Output, "height: %d\n", stats.Height)
+				fmt.Fprintf(s.Output, "leaves: %d\n", stats.NumberOfLeaves)
+				fmt.Fprintf(s.Output, "non-leaves: %d\n", stats.NumberOfNonLeaves)
+				fmt.Fprintf(s.Output, "average leaf fill: %.1f%%\n", stats.AverageLeafFillFactor*100)
+				fmt.Fprintf(s.Output, "estimated memory usage: %d bytes\n", stats.EstimatedMemoryUsage)
+				fmt.Fprintf(s.Output, "splits: %d\n", stats.NumberOfSplits)
+				fmt.Fprintf(s.Output, "merges: %d\n", stats.NumberOfMerges)
+				fmt.Fprintf(s.Output, "shifts: %d\n", stats.NumberOfShifts)
+				fmt.Fprintf(s.Output, "height increases: %d\n", stats.NumberOfHeightIncreases)
+				fmt.Fprintf(s.Output, "height decreases: %d\n", stats.NumberOfHeightDecreases)
+
+				for i, fillFactorHistogram := range stats.FillFactorHistograms {
+					fmt.Fprintf(s.Output, "fill factor histogram of level %d: %v\n", i+1, fillFactorHistogram)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:            "check",
+			Description:     "check the invariants of the B+ tree",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 0,
+
+			Execute: func(s *shell, _ []string) error {
+				if err := s.BPTree.Check(); err != nil {
+					return err
+				}
+
+				fmt.Fprintln(s.Output, "ok")
+				return nil
+			},
+		},
+		{
+			Name:            "load",
+			Usage:           "FILE",
+			Description:     "add or update records from a file with a KEY or KEY<tab>VALUE per line, either of which may be quoted",
+			MinNumberOfArgs: 1,
+			MaxNumberOfArgs: 1,
+
+			Execute: func(s *shell, args []string) error {
+				return s.load(args[0])
+			},
+		},
+		{
+			Name:            "save",
+			Usage:           "FILE",
+			Description:     "save records to a file with a quoted KEY or KEY<tab>VALUE per line",
+			MinNumberOfArgs: 1,
+			MaxNumberOfArgs: 1,
+
+			Execute: func(s *shell, args []string) error {
+				return s.save(args[0])
+			},
+		},
+		{
+			Name:            "help",
+			Description:     "print this help",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 0,
+
+			Execute: func(s *shell, _ []string) error {
+				for _, command := range commands {
+					fmt.Fprintf(s.Output, "%s\n\t%s\n", strings.TrimSpace(command.Name+" "+command.Usage), command.Description)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:            "quit",
+			Description:     "quit the shell",
+			MinNumberOfArgs: 0,
+			MaxNumberOfArgs: 0,
+
+			Execute: func(*shell, []string) error {
+				return errQuit
+			},
+		},
+	}
+}
+
+var (
+	errQuit           = errors.New("quit")
+	errRecordNotFound = errors.New("record not found")
+)
+
+// unquoteField unquotes the given field of a line in a file of
+// records if it is quoted, and returns it as is otherwise.
+func unquoteField(field string) (string, error) {
+	if !strings.HasPrefix(field, "\"") {
+		return field, nil
+	}
+
+	s, err := strconv.Unquote(field)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted string: %s", field)
+	}
+
+	return s, nil
+}
+
+func splitLine(line string) ([]string, error) {
+	var args []string
+
+	for {
+		line = strings.TrimLeft(line, " \t")
+
+		if line == "" {
+			return args, nil
+		}
+
+		if line[0] != '"' {
+			i := strings.IndexAny(line, " \t")
+
+			if i < 0 {
+				i = len(line)
+			}
+
+			args = append(args, line[:i])
+			line = line[i:]
+			continue
+		}
+
+		i := 1
+
+		for i < len(line) && line[i] != '"' {
+			if line[i] == '\\' {
+				i++
+			}
+
+			i++
+		}
+
+		if i >= len(line) {
+			return nil, fmt.Errorf("unterminated quoted string: %s", line)
+		}
+
+		arg, err := strconv.Unquote(line[:i+1])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string: %s", line[:i+1])
+		}
+
+		args = append(args, arg)
+		line = line[i+1:]
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func MakeShell(t *testing.T, keyTypeName string, maxDegree int) (*shell, *bytes.Buffer) {
+	keyType, err := parseKeyType(keyTypeName)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	output := bytes.NewBuffer(nil)
+
+	return &shell{
+		BPTree:      new(bptree.BPTree).InitWithKeyKind(maxDegree, keyType.Kind, nil),
+		KeyType:     keyType,
+		Output:      output,
+		StopOnError: true,
+	}, output
+}
+
+func TestShellCommands(t *testing.T) {
+	s, output := MakeShell(t, "int", 4)
+
+	err := s.Run(strings.NewReader(`# comment
+add 3 c
+add 1 a
+add 2
+add 5 "e e"
+add 4 d
+update 2 b
+get 2
+del 4
+range
+rrange - 2
+range 2 + 1
+check
+`), "")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `2	b
+1	a
+2	b
+3	c
+5	e e
+2	b
+1	a
+2	b
+ok
+`, output.String())
+	}
+
+	for _, line := range []string{
+		"add 1",
+		"add x",
+		"update 9 z",
+		"del 9",
+		"get 9",
+		"range 1",
+		"range 1 2 x",
+		"print x",
+		"stats 1",
+		"add \"1",
+		"unknown",
+	} {
+		assert.Error(t, s.Execute(line), line)
+	}
+
+	assert.Equal(t, errQuit, s.Execute("quit"))
+}
+
+func TestShellEmptyKeyBound(t *testing.T) {
+	s, output := MakeShell(t, "string", 4)
+
+	err := s.Run(strings.NewReader(`add "" a
+add b b
+range "" ""
+rrange - ""
+range "" + 1
+`), "")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "\ta\n\ta\n\ta\n", output.String())
+	}
+}
+
+func TestShellLoadAndSave(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "bptree")
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dirName)
+	fileName := filepath.Join(dirName, "records.txt")
+	s, output := MakeShell(t, "string", 32)
+	err = s.Run(strings.NewReader("load ../../test/data/bitquark-subdomains-top100000.txt\nsave "+fileName+"\ncheck\n"), "")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "100000 records loaded\n100000 records saved\nok\n", output.String())
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+
+	if assert.NoError(t, err) {
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		assert.Len(t, lines, 100000)
+
+		for i, line := range lines {
+			lines[i], err = strconv.Unquote(line)
+			assert.NoError(t, err)
+		}
+
+		assert.True(t, sortedStrings(lines))
+	}
+
+	output.Reset()
+	err = s.Run(strings.NewReader("print 2 3\nstats\n"), "")
+
+	if assert.NoError(t, err) {
+		assert.Contains(t, output.String(), "records: 100000, height: ")
+		assert.Contains(t, output.String(), "records: 100000\n")
+	}
+}
+
+func TestShellSaveAndLoadSpecialCharacters(t *testing.T) {
+	dirName, err := ioutil.TempDir("", "bptree")
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dirName)
+	fileName := filepath.Join(dirName, "records.txt")
+	s, output := MakeShell(t, "string", 4)
+	err = s.Run(strings.NewReader(`add "a\tb" "c\td"
+add "e\nf"
+add "\"g\"" h
+save `+fileName+"\n"), "")
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	s2, output2 := MakeShell(t, "string", 4)
+	err = s2.Run(strings.NewReader("load "+fileName+"\nrange\n"), "")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "3 records saved\n", output.String())
+		assert.Equal(t, "3 records loaded\n\"g\"\th\na\tb\tc\td\ne\nf\n", output2.String())
+		assert.True(t, s.BPTree.Equal(s2.BPTree, nil))
+	}
+}
+
+func sortedStrings(ss []string) bool {
+	for i := 1; i < len(ss); i++ {
+		if ss[i-1] >= ss[i] {
+			return false
+		}
+	}
+
+	return true
+}
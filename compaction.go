@@ -0,0 +1,217 @@
+package bptree
+
+import (
+	"errors"
+	"math"
+	"unsafe"
+)
+
+// Compact repacks the records of the B+ tree into leaves filled to
+// the given target fill factor, in (0, 1], and rebuilds non-leaves
+// over them likewise, which may lower the height of the B+ tree.
+// Records are moved between the leaves along the leaf list, and
+// nodes no longer needed are recycled if node pooling is enabled.
+// Nodes are never filled below the minimum fill factor, unless the
+// B+ tree has too few records.
+func (bpt *BPTree) Compact(targetFillFactor float64) {
+	bpt.lazyInit()
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceCompact, targetFillFactor)
+	}
+
+	if !(targetFillFactor > 0 && targetFillFactor <= 1) {
+		panic(errors.New("bptree: invalid target fill factor"))
+	}
+
+	bpt.rebuild(targetFillFactor)
+}
+
+// ChangeDegree changes the maximum degree of the B+ tree, which is
+// both the capacity of leaves and the capacity of non-leaves, then
+// rebuilds the B+ tree with full nodes as Compact(1) does.
+func (bpt *BPTree) ChangeDegree(maxDegree int) {
+	bpt.lazyInit()
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceChangeDegree, maxDegree)
+	}
+
+	if maxDegree < 4 {
+		panic(errors.New("bptree: invalid maximum degree"))
+	}
+
+	options := bpt.options
+	options.LeafCapacity = maxDegree
+	options.NonLeafCapacity = maxDegree
+	bpt.setOptions(options)
+	bpt.rebuild(1)
+}
+
+func (bpt *BPTree) rebuild(targetFillFactor float64) {
+	var freeNonLeaves []*nonLeaf
+
+	if bpt.height >= 2 {
+		freeNonLeaves = bpt.collectNonLeaves(bpt.root, 1, nil)
+	}
+
+	leaves := bpt.packLeaves(targetFillFactor)
+	nodes := make([]unsafe.Pointer, len(leaves))
+	keys := make([]interface{}, len(leaves))
+
+	for i, leaf := range leaves {
+		nodes[i] = unsafe.Pointer(leaf)
+
+		if i >= 1 {
+			keys[i] = leaf.keys.Separator(leaves[i-1].keys)
+		}
+	}
+
+	height := 1
+
+	for len(nodes) >= 2 {
+		n := len(nodes)
+		m := numberOfPackedNodes(n, bpt.options.NonLeafCapacity, bpt.minNonLeafSize, targetFillFactor)
+		j := 0
+
+		for i := 0; i < m; i++ {
+			var nonLeaf *nonLeaf
+
+			if k := len(freeNonLeaves); k >= 1 {
+				nonLeaf = freeNonLeaves[k-1]
+				freeNonLeaves = freeNonLeaves[:k-1]
+			} else {
+				nonLeaf = bpt.newNonLeaf()
+			}
+
+			nonLeaf.InsertChild(0, nil, nodes[j])
+			key := keys[j]
+			j++
+
+			for k := 1; k < packedNodeSize(n, m, i); k++ {
+				nonLeaf.InsertChild(k, keys[j], nodes[j])
+				j++
+			}
+
+			nodes[i] = unsafe.Pointer(nonLeaf)
+			keys[i] = key
+		}
+
+		nodes = nodes[:m]
+		keys = keys[:m]
+		height++
+	}
+
+	for _, nonLeaf := range freeNonLeaves {
+		bpt.freeNonLeaf(nonLeaf)
+	}
+
+	if height > bpt.height {
+		bpt.counters.NumberOfHeightIncreases += int64(height - bpt.height)
+	} else {
+		bpt.counters.NumberOfHeightDecreases += int64(bpt.height - height)
+	}
+
+	bpt.root = nodes[0]
+	bpt.height = height
+}
+
+// packLeaves moves records along the leaf list so that records are
+// spread evenly over as many leaves as the target fill factor needs,
+// and removes the leaves left empty.
+func (bpt *BPTree) packLeaves(targetFillFactor float64) []*leaf {
+	numberOfRecords := 0
+
+	for leaf := bpt.leafList.Head(); ; leaf = leaf.Next {
+		numberOfRecords += leaf.NumberOfRecords()
+
+		if leaf == bpt.leafList.Tail() {
+			break
+		}
+	}
+
+	m := numberOfPackedNodes(numberOfRecords, bpt.options.LeafCapacity, bpt.minLeafSize, targetFillFactor)
+	leaves := make([]*leaf, m)
+	leaf := bpt.leafList.Head()
+
+	for i := 0; i < m; i++ {
+		leafSize := packedNodeSize(numberOfRecords, m, i)
+
+		for leaf.NumberOfRecords() < leafSize {
+			// the rest records are in the following leaves.
+			nextLeaf := leaf.Next
+			n := nextLeaf.NumberOfRecords()
+
+			if m := leafSize - leaf.NumberOfRecords(); m < n {
+				leaf.AppendRecords(&nextLeaf.records, 0, m)
+				nextLeaf.RemoveRecords(0, m)
+			} else {
+				leaf.AppendRecords(&nextLeaf.records, 0, n)
+				bpt.removeLeaf(nextLeaf)
+			}
+		}
+
+		if n := leaf.NumberOfRecords(); n > leafSize {
+			// move the excess records to a new leaf rather than the next
+			// leaf, which may have excess records in turn.
+			newLeaf := bpt.newLeaf()
+			newLeaf.AppendRecords(&leaf.records, leafSize, n)
+			leaf.Truncate(leafSize)
+			bpt.leafList.InsertLeafAfter(newLeaf, leaf)
+		}
+
+		leaves[i] = leaf
+		leaf = leaf.Next
+	}
+
+	// the rest leaves are empty.
+	for leaves[m-1] != bpt.leafList.Tail() {
+		bpt.removeLeaf(bpt.leafList.Tail())
+	}
+
+	bpt.finger = nil
+	return leaves
+}
+
+func (bpt *BPTree) collectNonLeaves(node unsafe.Pointer, nodeDepth int, nonLeaves []*nonLeaf) []*nonLeaf {
+	nonLeaf := (*nonLeaf)(node)
+
+	if nodeDepth+1 < bpt.height {
+		for i := 0; i < nonLeaf.NumberOfChildren(); i++ {
+			nonLeaves = bpt.collectNonLeaves(nonLeaf.Child(i), nodeDepth+1, nonLeaves)
+		}
+	}
+
+	nonLeaf.Truncate(0)
+	return append(nonLeaves, nonLeaf)
+}
+
+// numberOfPackedNodes returns the number of nodes for the given
+// number of records or children, so that the nodes are filled to
+// the target fill factor but not below the minimum size.
+func numberOfPackedNodes(numberOfItems int, capacity int, minSize int, targetFillFactor float64) int {
+	m := int(math.Ceil(float64(numberOfItems) / (float64(capacity) * targetFillFactor)))
+
+	if m2 := numberOfItems / minSize; m > m2 {
+		m = m2
+	}
+
+	if m < 1 {
+		m = 1
+	}
+
+	return m
+}
+
+// packedNodeSize returns the size of the i-th node of the given
+// number of nodes, over which the given number of records or
+// children are spread evenly.
+func packedNodeSize(numberOfItems int, numberOfNodes int, i int) int {
+	size := numberOfItems / numberOfNodes
+
+	if i < numberOfItems%numberOfNodes {
+		size++
+	}
+
+	return size
+}
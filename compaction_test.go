@@ -0,0 +1,154 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeCompact(t *testing.T) {
+	for _, keyKind := range []bptree.KeyKind{bptree.GenericKeys, bptree.StringKeys, bptree.BytesKeys} {
+		for _, targetFillFactor := range []float64{1, 0.75, 0.5, 0.1} {
+			bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+				LeafCapacity:    8,
+				NonLeafCapacity: 5,
+				KeyKind:         keyKind,
+			})
+
+			makeKey := func(k string) interface{} {
+				if keyKind == bptree.BytesKeys {
+					return []byte(k)
+				}
+
+				return k
+			}
+
+			records := map[string]int{}
+
+			for i, k := range Keywords[:5000] {
+				bpt.AddRecord(makeKey(k), i)
+				records[k] = i
+			}
+
+			for _, i := range rand.Perm(5000)[:4000] {
+				k := Keywords[i]
+				bpt.DeleteRecord(makeKey(k))
+				delete(records, k)
+			}
+
+			stats := bpt.Stats()
+			bpt.Compact(targetFillFactor)
+
+			if !assert.NoError(t, bpt.Check(), "%v %v", keyKind, targetFillFactor) {
+				t.FailNow()
+			}
+
+			stats2 := bpt.Stats()
+			assert.Equal(t, stats.NumberOfRecords, stats2.NumberOfRecords)
+
+			switch targetFillFactor {
+			case 1:
+				assert.Equal(t, (1000+7)/8, stats2.NumberOfLeaves)
+				assert.True(t, stats2.Height <= stats.Height)
+				assert.True(t, stats2.EstimatedMemoryUsage < stats.EstimatedMemoryUsage)
+			case 0.75:
+				assert.Equal(t, (1000+5)/6, stats2.NumberOfLeaves)
+			default:
+				// nodes are not filled below the minimum fill factor.
+				assert.Equal(t, 1000/4, stats2.NumberOfLeaves)
+			}
+
+			n := 0
+
+			for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+				k, v := it.Record()
+
+				if keyKind == bptree.BytesKeys {
+					k = string(k.([]byte))
+				}
+
+				assert.Equal(t, records[k.(string)], v)
+				n++
+			}
+
+			assert.Equal(t, len(records), n)
+
+			for i, k := range Keywords[5000:6000] {
+				bpt.AddRecord(makeKey(k), i)
+				bpt.DeleteRecord(makeKey(Keywords[i]))
+			}
+
+			assert.NoError(t, bpt.Check())
+		}
+	}
+}
+
+func TestBPTreeCompactSmallTrees(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	bpt.EnableNodePooling(100)
+	bpt.Compact(1)
+	assert.NoError(t, bpt.Check())
+	assert.Equal(t, 1, bpt.Height())
+
+	for i := int64(0); i < 100; i++ {
+		bpt.AddRecord(i, nil)
+	}
+
+	for i := int64(0); i < 100; i++ {
+		if i != 42 {
+			bpt.DeleteRecord(i)
+		}
+	}
+
+	bpt.Compact(0.5)
+	assert.NoError(t, bpt.Check())
+	assert.Equal(t, 1, bpt.Height())
+	_, ok := bpt.HasRecord(int64(42))
+	assert.True(t, ok)
+	bpt.DeleteRecord(int64(42))
+	bpt.Compact(0.5)
+	assert.NoError(t, bpt.Check())
+	assert.True(t, bpt.SearchForward(bptree.KeyMin, bptree.KeyMax).IsAtEnd())
+
+	assert.Panics(t, func() { bpt.Compact(0) })
+	assert.Panics(t, func() { bpt.Compact(1.1) })
+}
+
+func TestBPTreeChangeDegree(t *testing.T) {
+	bpt := MakeBPTree(t, 4)
+	height := bpt.Height()
+
+	for _, maxDegree := range []int{64, 5, 4, 33} {
+		bpt.ChangeDegree(maxDegree)
+
+		if !assert.NoError(t, bpt.Check(), "%v", maxDegree) {
+			t.FailNow()
+		}
+
+		assert.Equal(t, maxDegree, bpt.MaxDegree())
+		assert.Equal(t, maxDegree, bpt.Options().LeafCapacity)
+		i := 0
+
+		for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+			k, v := it.Record()
+			assert.Equal(t, Keywords[SortedKeywordIndexes[i]], k)
+			assert.Equal(t, SortedKeywordIndexes[i], v)
+			i++
+		}
+
+		assert.Equal(t, len(Keywords), i)
+
+		if maxDegree == 64 {
+			assert.True(t, bpt.Height() < height)
+		}
+	}
+
+	for _, k := range Keywords[:1000] {
+		bpt.DeleteRecord(k)
+	}
+
+	assert.NoError(t, bpt.Check())
+	assert.Panics(t, func() { bpt.ChangeDegree(3) })
+}
@@ -0,0 +1,184 @@
+package bptree
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// ComparerError represents a violation of the properties of a key
+// comparer, found by the checks enabled with the option
+// ComparerCheckInterval.
+type ComparerError struct {
+	// Property is the violated property, which is "reflexivity",
+	// "antisymmetry", "transitivity" or "neighbor order".
+	Property string
+
+	// Keys holds the offending keys.
+	Keys []interface{}
+
+	// Results holds the results of comparing the offending keys,
+	// such as "compare(k1, k2) = -1".
+	Results []string
+}
+
+// Error implements error.Error.
+func (ce *ComparerError) Error() string {
+	return fmt.Sprintf("bptree: key comparer violates %s: keys %v: %v", ce.Property, ce.Keys, ce.Results)
+}
+
+type comparerChecker struct {
+	Interval      int
+	Comparer      KeyComparer
+	ErrorHandler  func(*ComparerError)
+	numberOfCalls int
+	rand          *rand.Rand
+}
+
+func newComparerChecker(options Options) *comparerChecker {
+	if options.ComparerCheckInterval == 0 {
+		return nil
+	}
+
+	return &comparerChecker{
+		Interval:     options.ComparerCheckInterval,
+		Comparer:     options.KeyComparer,
+		ErrorHandler: options.ComparerErrorHandler,
+		rand:         rand.New(rand.NewSource(1)),
+	}
+}
+
+// Sample checks the key comparer with the given key and some of the
+// given keys around the position of the key, for every Interval-th
+// call.
+func (cc *comparerChecker) Sample(keys keys, key interface{}) {
+	cc.numberOfCalls++
+
+	if cc.numberOfCalls%cc.Interval != 0 {
+		return
+	}
+
+	n := keys.Len()
+
+	if _, ok := key.(keyMinMax); ok || n == 0 {
+		return
+	}
+
+	i, _ := keys.Locate(key, cc.Comparer)
+	var otherKeys []interface{}
+
+	for _, j := range [...]int{i - 1, i, i + 1, cc.rand.Intn(n)} {
+		if j >= 0 && j < n {
+			otherKeys = append(otherKeys, keys.Get(j))
+		}
+	}
+
+	if !cc.checkReflexivity(key) {
+		return
+	}
+
+	for _, otherKey := range otherKeys {
+		if !cc.checkAntisymmetry(key, otherKey) {
+			return
+		}
+	}
+
+	for j := 1; j < len(otherKeys); j++ {
+		if !cc.checkTransitivity(key, otherKeys[j-1], otherKeys[j]) {
+			return
+		}
+	}
+}
+
+// CheckOrder checks whether the given key is less than the other
+// one, which are neighbors after an insertion, in both directions.
+func (cc *comparerChecker) CheckOrder(key1, key2 interface{}) {
+	if d12, d21 := cc.Comparer(key1, key2), cc.Comparer(key2, key1); d12 >= 0 || d21 <= 0 {
+		cc.report("neighbor order", []interface{}{key1, key2}, cc.result(key1, key2, d12), cc.result(key2, key1, d21))
+	}
+}
+
+func (cc *comparerChecker) checkReflexivity(key interface{}) bool {
+	if d := cc.Comparer(key, key); d != 0 {
+		cc.report("reflexivity", []interface{}{key}, cc.result(key, key, d))
+		return false
+	}
+
+	return true
+}
+
+func (cc *comparerChecker) checkAntisymmetry(key1, key2 interface{}) bool {
+	d12, d21 := cc.Comparer(key1, key2), cc.Comparer(key2, key1)
+
+	if sign(d12) != -sign(d21) {
+		cc.report("antisymmetry", []interface{}{key1, key2}, cc.result(key1, key2, d12), cc.result(key2, key1, d21))
+		return false
+	}
+
+	return true
+}
+
+func (cc *comparerChecker) checkTransitivity(key1, key2, key3 interface{}) bool {
+	keys := [3]interface{}{key1, key2, key3}
+
+	for _, order := range [...][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}} {
+		a, b, c := keys[order[0]], keys[order[1]], keys[order[2]]
+		dab, dbc := cc.Comparer(a, b), cc.Comparer(b, c)
+		sab, sbc := sign(dab), sign(dbc)
+
+		// a <= b and b <= c implies a <= c, and a < c if either is
+		// strict.
+		if sab > 0 || sbc > 0 {
+			continue
+		}
+
+		dac := cc.Comparer(a, c)
+
+		if sac := sign(dac); sac > 0 || (sac == 0 && sab+sbc < 0) || (sac < 0 && sab+sbc == 0) {
+			cc.report("transitivity", []interface{}{a, b, c}, cc.result(a, b, dab), cc.result(b, c, dbc), cc.result(a, c, dac))
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cc *comparerChecker) report(property string, keys []interface{}, results ...string) {
+	err := ComparerError{
+		Property: property,
+		Keys:     keys,
+		Results:  results,
+	}
+
+	if cc.ErrorHandler == nil {
+		panic(&err)
+	}
+
+	cc.ErrorHandler(&err)
+}
+
+func (cc *comparerChecker) result(key1, key2 interface{}, d int64) string {
+	return fmt.Sprintf("compare(%v, %v) = %d", key1, key2, d)
+}
+
+// checkInsertion checks the order of the given key to insert at
+// the given position and its neighbors.
+func (bpt *BPTree) checkInsertion(leaf *leaf, recordIndex int, key interface{}) {
+	if prevLeaf, i, ok := bpt.prevRecord(leaf, recordIndex); ok {
+		bpt.comparerChecker.CheckOrder(prevLeaf.Key(i), key)
+	}
+
+	if nextLeaf, i, ok := bpt.nextRecord(leaf, recordIndex); ok {
+		bpt.comparerChecker.CheckOrder(key, nextLeaf.Key(i))
+	}
+}
+
+func sign(d int64) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	default:
+		return 0
+	}
+}
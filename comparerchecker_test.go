@@ -0,0 +1,168 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeComparerCheck(t *testing.T) {
+	var errs []*bptree.ComparerError
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:          4,
+		NonLeafCapacity:       4,
+		KeyComparer:           compareInts, // panics on KeyMin and KeyMax
+		ComparerCheckInterval: 1,
+		ComparerErrorHandler:  func(err *bptree.ComparerError) { errs = append(errs, err) },
+	})
+
+	for i := 0; i < 3000; i++ {
+		k := rand.Intn(1000)
+
+		switch rand.Intn(3) {
+		case 0:
+			bpt.AddOrUpdateRecord(k, nil)
+		case 1:
+			bpt.DeleteRecord(k)
+		default:
+			bpt.Floor(k)
+			bpt.SearchForward(bptree.KeyMin, k)
+			bpt.SearchBackward(k, bptree.KeyMax)
+		}
+	}
+
+	assert.Empty(t, errs)
+	assert.NoError(t, bpt.Check())
+	bpt2 := bpt.Clone(nil)
+	bpt2.AddRecord(-1, nil)
+	assert.Empty(t, errs)
+}
+
+func TestBPTreeComparerCheckViolations(t *testing.T) {
+	for _, tc := range []struct {
+		Comparer      bptree.KeyComparer
+		CheckInterval int
+		Keys          []int
+		Property      string
+	}{
+		{
+			// 5 is not equal to itself.
+			Comparer: func(key1, key2 interface{}) int64 {
+				if key1 == 5 && key2 == 5 {
+					return 1
+				}
+
+				return compareInts(key1, key2)
+			},
+			Keys:          []int{1, 2, 3, 4, 5, 6},
+			CheckInterval: 1,
+			Property:      "reflexivity",
+		},
+		{
+			// 5 is less than any other key, and any other key is less
+			// than 5.
+			Comparer: func(key1, key2 interface{}) int64 {
+				if key1 == 5 && key2 != 5 || key1 != 5 && key2 == 5 {
+					return -1
+				}
+
+				return compareInts(key1, key2)
+			},
+			Keys:          []int{1, 2, 3, 4, 5, 6},
+			CheckInterval: 1,
+			Property:      "antisymmetry",
+		},
+		{
+			// 0 < 1 < 2 < 0.
+			Comparer: func(key1, key2 interface{}) int64 {
+				x, y := key1.(int), key2.(int)
+
+				switch {
+				case x == y:
+					return 0
+				case (x+1)%3 == y:
+					return -1
+				default:
+					return 1
+				}
+			},
+			Keys:          []int{0, 1, 2, 0, 1, 2},
+			CheckInterval: 1,
+			Property:      "transitivity",
+		},
+		{
+			// 5 is less than any other key, but only when it is the
+			// first key.
+			Comparer: func(key1, key2 interface{}) int64 {
+				if key1 == 5 && key2 != 5 {
+					return -1
+				}
+
+				return compareInts(key1, key2)
+			},
+			Keys:          []int{1, 2, 3, 4, 5, 6},
+			CheckInterval: 1000, // no sampling
+			Property:      "neighbor order",
+		},
+	} {
+		var errs []*bptree.ComparerError
+		bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+			LeafCapacity:          8,
+			NonLeafCapacity:       4,
+			KeyComparer:           tc.Comparer,
+			ComparerCheckInterval: tc.CheckInterval,
+			ComparerErrorHandler:  func(err *bptree.ComparerError) { errs = append(errs, err) },
+		})
+
+		for _, k := range tc.Keys {
+			bpt.AddRecord(k, nil)
+		}
+
+		if assert.NotEmpty(t, errs, tc.Property) {
+			var properties []string
+
+			for _, err := range errs {
+				properties = append(properties, err.Property)
+			}
+
+			assert.Equal(t, tc.Property, properties[0])
+			t.Log(errs[0])
+		}
+	}
+}
+
+func TestBPTreeComparerCheckPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		new(bptree.BPTree).InitWithOptions(bptree.Options{
+			LeafCapacity:          4,
+			NonLeafCapacity:       4,
+			KeyComparer:           compareInts,
+			ComparerCheckInterval: -1,
+		})
+	})
+
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:    4,
+		NonLeafCapacity: 4,
+		KeyComparer: func(key1, key2 interface{}) int64 {
+			return -1
+		},
+		ComparerCheckInterval: 100,
+	})
+
+	bpt.AddRecord(1, nil)
+
+	defer func() {
+		err, ok := recover().(*bptree.ComparerError)
+
+		if assert.True(t, ok) {
+			assert.Equal(t, "neighbor order", err.Property)
+			assert.Equal(t, []interface{}{1, 2}, err.Keys)
+			assert.Equal(t, "bptree: key comparer violates neighbor order: keys [1 2]: [compare(1, 2) = -1 compare(2, 1) = -1]", err.Error())
+		}
+	}()
+
+	bpt.AddRecord(2, nil)
+}
@@ -0,0 +1,294 @@
+package bptree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+// Diff returns an iteration over the differences from the old B+
+// tree to the new one in key order. Keys are compared with the key
+// comparer of the old B+ tree, and values are compared with the
+// given value comparer, or reflect.DeepEqual if the value comparer
+// is nil.
+// It walks both leaf lists in step. If the B+ trees share hashing,
+// namely one is a clone of the other made with hashing enabled (see
+// EnableHashing and Clone), subtrees with identical cached hashes in
+// both B+ trees are skipped without being visited, which are the
+// subtrees left untouched since the clone was made. Hashes are not
+// computed by Diff itself.
+// The B+ trees must not be modified during the iteration.
+func Diff(oldBPTree, newBPTree *BPTree, valueEqual func(value1, value2 interface{}) bool) DiffIterator {
+	oldBPTree.lazyInit()
+	newBPTree.lazyInit()
+
+	if valueEqual == nil {
+		valueEqual = reflect.DeepEqual
+	}
+
+	di := diffIterator{
+		oldBPTree:  oldBPTree,
+		newBPTree:  newBPTree,
+		valueEqual: valueEqual,
+	}
+
+	di.oldLeaf, di.oldRecordIndex, di.hasOldRecord = oldBPTree.nextRecord(oldBPTree.leafList.Head(), 0)
+	di.newLeaf, di.newRecordIndex, di.hasNewRecord = newBPTree.nextRecord(newBPTree.leafList.Head(), 0)
+	di.Advance()
+	return &di
+}
+
+// DiffIterator represents an iteration over differences between
+// two B+ trees.
+type DiffIterator interface {
+	// IsAtEnd indicates if the iteration has no more differences.
+	IsAtEnd() (hasNoMoreDifferences bool)
+
+	// Difference returns the current difference in the iteration.
+	Difference() Difference
+
+	// Advance advances the iteration to the next difference.
+	Advance()
+}
+
+// Difference represents a record which differs between two B+
+// trees.
+type Difference struct {
+	Kind DifferenceKind
+	Key  interface{}
+
+	// OldValue is the value in the old B+ tree, which is nil for
+	// added records.
+	OldValue interface{}
+
+	// NewValue is the value in the new B+ tree, which is nil for
+	// removed records.
+	NewValue interface{}
+}
+
+// DifferenceKind is the kind of a difference.
+type DifferenceKind int
+
+const (
+	// RecordAdded means the record exists only in the new B+ tree.
+	RecordAdded = DifferenceKind(1 + iota)
+
+	// RecordRemoved means the record exists only in the old B+
+	// tree.
+	RecordRemoved
+
+	// RecordChanged means the record exists in both B+ trees with
+	// different values.
+	RecordChanged
+)
+
+// String returns the name of the difference kind.
+func (dk DifferenceKind) String() string {
+	switch dk {
+	case RecordAdded:
+		return "added"
+	case RecordRemoved:
+		return "removed"
+	case RecordChanged:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+type diffIterator struct {
+	oldBPTree      *BPTree
+	newBPTree      *BPTree
+	valueEqual     func(interface{}, interface{}) bool
+	oldLeaf        *leaf
+	oldRecordIndex int
+	hasOldRecord   bool
+	newLeaf        *leaf
+	newRecordIndex int
+	hasNewRecord   bool
+	difference     Difference
+	isAtEnd        bool
+}
+
+func (di *diffIterator) IsAtEnd() bool {
+	return di.isAtEnd
+}
+
+func (di *diffIterator) Difference() Difference {
+	if di.isAtEnd {
+		panic(errors.New("bptree: end of iteration"))
+	}
+
+	return di.difference
+}
+
+func (di *diffIterator) Advance() {
+	if di.isAtEnd {
+		panic(errors.New("bptree: end of iteration"))
+	}
+
+	for di.hasOldRecord || di.hasNewRecord {
+		if di.hasOldRecord && di.hasNewRecord && di.oldRecordIndex == 0 && di.newRecordIndex == 0 && di.skipIdenticalSubtrees() {
+			continue
+		}
+
+		var d int64
+
+		switch {
+		case !di.hasNewRecord:
+			d = -1
+		case !di.hasOldRecord:
+			d = 1
+		default:
+			d = di.oldBPTree.keyComparer(di.oldLeaf.Key(di.oldRecordIndex), di.newLeaf.Key(di.newRecordIndex))
+		}
+
+		if d < 0 {
+			di.difference = Difference{
+				Kind:     RecordRemoved,
+				Key:      di.oldLeaf.Key(di.oldRecordIndex),
+				OldValue: di.oldLeaf.Value(di.oldRecordIndex),
+			}
+
+			di.advanceOld()
+			return
+		}
+
+		if d > 0 {
+			di.difference = Difference{
+				Kind:     RecordAdded,
+				Key:      di.newLeaf.Key(di.newRecordIndex),
+				NewValue: di.newLeaf.Value(di.newRecordIndex),
+			}
+
+			di.advanceNew()
+			return
+		}
+
+		oldValue, newValue := di.oldLeaf.Value(di.oldRecordIndex), di.newLeaf.Value(di.newRecordIndex)
+
+		if !di.valueEqual(oldValue, newValue) {
+			di.difference = Difference{
+				Kind:     RecordChanged,
+				Key:      di.newLeaf.Key(di.newRecordIndex),
+				OldValue: oldValue,
+				NewValue: newValue,
+			}
+
+			di.advanceOld()
+			di.advanceNew()
+			return
+		}
+
+		di.advanceOld()
+		di.advanceNew()
+	}
+
+	di.difference = Difference{}
+	di.isAtEnd = true
+}
+
+// skipIdenticalSubtrees skips the largest subtrees which the
+// current leaves are the first leaves of and have identical cached
+// hashes, and reports whether any subtrees are skipped.
+func (di *diffIterator) skipIdenticalSubtrees() bool {
+	if hasher := di.oldBPTree.hasher; hasher == nil || hasher != di.newBPTree.hasher {
+		return false
+	}
+
+	key := di.oldLeaf.Key(0)
+
+	if di.oldBPTree.keyComparer(key, di.newLeaf.Key(0)) != 0 {
+		return false
+	}
+
+	oldSubtree, oldSubtreeHeight := di.oldBPTree.firstLeafSubtree(key)
+	newSubtree, newSubtreeHeight := di.newBPTree.firstLeafSubtree(key)
+
+	for ; oldSubtreeHeight > newSubtreeHeight; oldSubtreeHeight-- {
+		oldSubtree = (*nonLeaf)(oldSubtree).Child(0)
+	}
+
+	for ; newSubtreeHeight > oldSubtreeHeight; newSubtreeHeight-- {
+		newSubtree = (*nonLeaf)(newSubtree).Child(0)
+	}
+
+	for subtreeHeight := oldSubtreeHeight; ; subtreeHeight-- {
+		oldDigest := cachedDigest(oldSubtree, subtreeHeight)
+		newDigest := cachedDigest(newSubtree, subtreeHeight)
+
+		if oldDigest != nil && newDigest != nil && bytes.Equal(oldDigest.Hash, newDigest.Hash) {
+			oldLeaf, newLeaf := lastLeaf(oldSubtree, subtreeHeight), lastLeaf(newSubtree, subtreeHeight)
+			di.oldLeaf, di.oldRecordIndex, di.hasOldRecord = di.oldBPTree.nextRecord(oldLeaf, oldLeaf.NumberOfRecords())
+			di.newLeaf, di.newRecordIndex, di.hasNewRecord = di.newBPTree.nextRecord(newLeaf, newLeaf.NumberOfRecords())
+			return true
+		}
+
+		if subtreeHeight == 0 {
+			return false
+		}
+
+		oldSubtree = (*nonLeaf)(oldSubtree).Child(0)
+		newSubtree = (*nonLeaf)(newSubtree).Child(0)
+	}
+}
+
+func (di *diffIterator) advanceOld() {
+	di.oldLeaf, di.oldRecordIndex, di.hasOldRecord = di.oldBPTree.nextRecord(di.oldLeaf, di.oldRecordIndex+1)
+}
+
+func (di *diffIterator) advanceNew() {
+	di.newLeaf, di.newRecordIndex, di.hasNewRecord = di.newBPTree.nextRecord(di.newLeaf, di.newRecordIndex+1)
+}
+
+// firstLeafSubtree returns the largest subtree, and its height,
+// which the leaf with the given key is the first leaf of, which is
+// the leaf itself at height 0 if there is no such non-leaf. Like
+// locateRecord, it descends from the root without allocations.
+func (bpt *BPTree) firstLeafSubtree(key interface{}) (unsafe.Pointer, int) {
+	node := bpt.root
+	subtree, subtreeHeight := node, bpt.height-1
+
+	for nodeDepth := 1; nodeDepth < bpt.height; nodeDepth++ {
+		nonLeaf := (*nonLeaf)(node)
+		i, ok := nonLeaf.LocateChild(key, bpt.keyComparer)
+
+		if bpt.comparerChecker != nil {
+			bpt.comparerChecker.Sample(nonLeaf.keys, key)
+		}
+
+		if !ok {
+			i--
+		}
+
+		node = nonLeaf.Child(i)
+
+		if i >= 1 {
+			subtree, subtreeHeight = node, bpt.height-1-nodeDepth
+		}
+	}
+
+	return subtree, subtreeHeight
+}
+
+// cachedDigest returns the cached digest of the given node at the
+// given height, which is 0 for leaves, or nil if there is none.
+func cachedDigest(node unsafe.Pointer, nodeHeight int) *digest {
+	if nodeHeight == 0 {
+		return (*leaf)(node).digest
+	}
+
+	return (*nonLeaf)(node).digest
+}
+
+// lastLeaf returns the last leaf of the given node at the given
+// height.
+func lastLeaf(node unsafe.Pointer, nodeHeight int) *leaf {
+	for ; nodeHeight >= 1; nodeHeight-- {
+		nonLeaf := (*nonLeaf)(node)
+		node = nonLeaf.Child(nonLeaf.NumberOfChildren() - 1)
+	}
+
+	return (*leaf)(node)
+}
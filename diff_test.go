@@ -0,0 +1,173 @@
+package bptree_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(5, bptree.Int64Keys, nil)
+	records := map[int64]int{}
+
+	for i := 0; i < 1000; i++ {
+		k := int64(rand.Intn(2000))
+		bpt.AddOrUpdateRecord(k, i)
+		records[k] = i
+	}
+
+	bpt2 := bpt.Clone(nil)
+	records2 := map[int64]int{}
+
+	for k, v := range records {
+		records2[k] = v
+	}
+
+	for i := 0; i < 300; i++ {
+		k := int64(rand.Intn(2000))
+
+		switch rand.Intn(3) {
+		case 0:
+			bpt2.DeleteRecord(k)
+			delete(records2, k)
+		case 1:
+			bpt2.AddOrUpdateRecord(k, -i)
+			records2[k] = -i
+		default:
+			// no changes.
+			if v, ok := records2[k]; ok {
+				bpt2.UpdateRecord(k, v)
+			}
+		}
+	}
+
+	var expectedDifferences []bptree.Difference
+
+	for k := int64(0); k < 2000; k++ {
+		v, ok := records[k]
+		v2, ok2 := records2[k]
+
+		switch {
+		case ok && !ok2:
+			expectedDifferences = append(expectedDifferences, bptree.Difference{Kind: bptree.RecordRemoved, Key: k, OldValue: v})
+		case !ok && ok2:
+			expectedDifferences = append(expectedDifferences, bptree.Difference{Kind: bptree.RecordAdded, Key: k, NewValue: v2})
+		case ok && ok2 && v != v2:
+			expectedDifferences = append(expectedDifferences, bptree.Difference{Kind: bptree.RecordChanged, Key: k, OldValue: v, NewValue: v2})
+		}
+	}
+
+	var differences []bptree.Difference
+
+	for it := bptree.Diff(bpt, bpt2, nil); !it.IsAtEnd(); it.Advance() {
+		differences = append(differences, it.Difference())
+	}
+
+	assert.Equal(t, expectedDifferences, differences)
+	assert.True(t, sort.SliceIsSorted(differences, func(i, j int) bool {
+		return differences[i].Key.(int64) < differences[j].Key.(int64)
+	}))
+
+	it := bptree.Diff(bpt, bpt.Clone(nil), nil)
+	assert.True(t, it.IsAtEnd())
+	assert.Panics(t, func() { it.Difference() })
+	assert.Panics(t, func() { it.Advance() })
+
+	n := 0
+
+	for it := bptree.Diff(new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil), bpt, nil); !it.IsAtEnd(); it.Advance() {
+		assert.Equal(t, bptree.RecordAdded, it.Difference().Kind)
+		n++
+	}
+
+	assert.Equal(t, len(records), n)
+
+	for it := bptree.Diff(bpt, bpt2, func(interface{}, interface{}) bool { return true }); !it.IsAtEnd(); it.Advance() {
+		assert.NotEqual(t, bptree.RecordChanged, it.Difference().Kind)
+	}
+
+	assert.Equal(t, "changed", bptree.RecordChanged.String())
+}
+
+func TestDiffSkipsIdenticalSubtrees(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(5, bptree.Int64Keys, nil)
+	bpt.EnableHashing(nil, nil)
+
+	for i := 0; i < 2000; i++ {
+		bpt.AddRecord(int64(i), strconv.Itoa(i))
+	}
+
+	bpt2 := bpt.Clone(nil)
+	bpt2.UpdateRecord(int64(1000), "x")
+	numberOfCalls := 0
+	valueEqual := func(value1, value2 interface{}) bool {
+		numberOfCalls++
+		return value1 == value2
+	}
+
+	assert.Equal(t, []bptree.Difference{{Kind: bptree.RecordChanged, Key: int64(1000), OldValue: "1000", NewValue: "x"}}, CollectDifferences(bpt, bpt2, valueEqual))
+	// only the records of the leaf changed are visited.
+	assert.True(t, numberOfCalls <= 5, "%v", numberOfCalls)
+
+	for i := 0; i < 300; i++ {
+		k := int64(rand.Intn(3000))
+
+		switch rand.Intn(3) {
+		case 0:
+			bpt2.DeleteRecord(k)
+		case 1:
+			bpt2.AddOrUpdateRecord(k, strconv.Itoa(-i))
+		default:
+			bpt.AddOrUpdateRecord(k, strconv.Itoa(-i))
+		}
+	}
+
+	bpt3, bpt4 := bpt.Clone(nil), bpt2.Clone(nil)
+	bpt3.DisableHashing()
+	bpt4.DisableHashing()
+	assert.Equal(t, CollectDifferences(bpt3, bpt4, nil), CollectDifferences(bpt, bpt2, nil))
+}
+
+func TestDiffSkipsIdenticalSubtreesWithoutAllocations(t *testing.T) {
+	// generic keys are stored as they are, so that getting them
+	// does not allocate.
+	bpt := new(bptree.BPTree).Init(5, nil)
+	bpt.EnableHashing(func(key interface{}) []byte {
+		return []byte(key.(string))
+	}, nil)
+
+	for i := 0; i < 2000; i++ {
+		bpt.AddRecord(fmt.Sprintf("%04d", i), strconv.Itoa(i))
+	}
+
+	bpt2 := bpt.Clone(nil)
+
+	for i := 0; i < 2000; i += 100 {
+		bpt2.UpdateRecord(fmt.Sprintf("%04d", i), "x")
+	}
+
+	valueEqual := func(value1, value2 interface{}) bool {
+		return value1 == value2
+	}
+
+	// the iterator is the only allocation.
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() {
+		for it := bptree.Diff(bpt, bpt2, valueEqual); !it.IsAtEnd(); it.Advance() {
+		}
+	}))
+}
+
+func CollectDifferences(oldBPTree, newBPTree *bptree.BPTree, valueEqual func(value1, value2 interface{}) bool) []bptree.Difference {
+	var differences []bptree.Difference
+
+	for it := bptree.Diff(oldBPTree, newBPTree, valueEqual); !it.IsAtEnd(); it.Advance() {
+		differences = append(differences, it.Difference())
+	}
+
+	return differences
+}
@@ -5,6 +5,8 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 	"syscall/js"
 
 	"github.com/roy2220/bptree"
@@ -56,10 +58,20 @@ func BPTree_FindMax(_ js.Value, _ []js.Value) interface{} {
 	return nil
 }
 
-func BPTree_Dump(_ js.Value, _ []js.Value) interface{} {
+func BPTree_Dot(_ js.Value, args []js.Value) interface{} {
 	buffer := bytes.NewBuffer(nil)
-	bpTree.Walk(makeBPTreeDumper(buffer))
-	return buffer.String()
+	bpTree.FprintDOT(buffer)
+	dotScript := buffer.String()
+
+	if len(args) >= 1 && args[0].Type() == js.TypeNumber {
+		if port, ok := locateKey(args[0].Float()); ok {
+			i := strings.LastIndexByte(dotScript, '}')
+			dotScript = dotScript[:i] + "  new_key [label = \"new key\", shape = plaintext]\n" +
+				"  new_key -> " + port + "\n" + dotScript[i:]
+		}
+	}
+
+	return dotScript
 }
 
 func BPTree_String(_ js.Value, _ []js.Value) interface{} {
@@ -70,39 +82,37 @@ func BPTree_String(_ js.Value, _ []js.Value) interface{} {
 
 var bpTree bptree.BPTree
 
-func makeBPTreeDumper(buffer *bytes.Buffer) bptree.Walker {
-	var bpTreeDumper bptree.Walker
-
-	bpTreeDumper = func(bpTreeNodeAccessor bptree.NodeAccessor) error {
-		buffer.WriteByte('[')
+func locateKey(key float64) (string, bool) {
+	var port string
+	var locator bptree.Walker
+	nodeName := "n"
 
-		if bpTreeNodeAccessor.IsLeaf() {
-			n := bpTreeNodeAccessor.NumberOfKeys()
+	locator = func(nodeAccessor bptree.NodeAccessor) error {
+		n := nodeAccessor.NumberOfKeys()
 
+		if nodeAccessor.IsLeaf() {
 			for i := 0; i < n; i++ {
-				key := bpTreeNodeAccessor.GetKey(i)
-				fmt.Fprintf(buffer, "%v", key)
-
-				if i < n-1 {
-					buffer.WriteByte(',')
+				if nodeAccessor.GetKey(i) == key {
+					port = fmt.Sprintf("%s:r%d", nodeName, i)
+					break
 				}
 			}
-		} else {
-			bpTreeNodeAccessor.AccessChild(bpTreeDumper, 0)
-			n := bpTreeNodeAccessor.NumberOfKeys()
 
-			for i := 0; i < n; i++ {
-				key := bpTreeNodeAccessor.GetKey(i)
-				fmt.Fprintf(buffer, ",%v,", key)
-				bpTreeNodeAccessor.AccessChild(bpTreeDumper, i+1)
-			}
+			return nil
+		}
+
+		i := 0
+
+		for i < n && nodeAccessor.GetKey(i).(float64) <= key {
+			i++
 		}
 
-		buffer.WriteByte(']')
-		return nil
+		nodeName += "_" + strconv.Itoa(i)
+		return nodeAccessor.AccessChild(locator, i)
 	}
 
-	return bpTreeDumper
+	bpTree.Walk(locator)
+	return port, port != ""
 }
 
 func main() {
@@ -113,7 +123,7 @@ func main() {
 	module.Set("deleteKey", js.FuncOf(BPTree_DeleteKey))
 	module.Set("hasKey", js.FuncOf(BPTree_HasKey))
 	module.Set("findMax", js.FuncOf(BPTree_FindMax))
-	module.Set("dump", js.FuncOf(BPTree_Dump))
+	module.Set("dot", js.FuncOf(BPTree_Dot))
 	module.Set("string", js.FuncOf(BPTree_String))
 	select {}
 }
@@ -18,104 +18,12 @@ function loadBPTreeModule(callback) {
 
 function updateSvg(newKey) {
         const svg = document.getElementById("svg");
-        const arrayTree = eval(BPTree.dump());
-        const dotScript = generateDotScript(arrayTree, newKey);
+        const dotScript = BPTree.dot(newKey);
         // console.log(dotScript);
         const html = Viz(dotScript, "svg");
         svg.innerHTML = html.replace(/(\<svg width=")[^"]+/i, "$1100%");
 }
 
-function generateDotScript(arrayTree, newKey) {
-    let nodePathsOfLevels = [];
-    let prevLeafPath = ""
-    var f;
-
-    f = (node, nodePath, level) => {
-        if (level == nodePathsOfLevels.length) {
-            nodePathsOfLevels.push([]);
-        }
-
-        nodePathsOfLevels[level].push(nodePath);
-
-        let lines = [] ;
-        const i = nodePath.lastIndexOf("_");
-
-        if (i >= 0) {
-            lines.push("  " + nodePath.substring(0, i) + ":c" + nodePath.substring(i+1) + " -> " + nodePath);
-        }
-
-        let nodeIsLeaf = true;
-
-        for (let x of node) {
-            if (x instanceof Array) {
-                nodeIsLeaf = false;
-                break;
-            }
-        }
-
-        if (nodeIsLeaf) {
-            if (prevLeafPath != "") {
-                lines.push("  " + prevLeafPath + " -> " + nodePath);
-                lines.push("  " + nodePath + " -> " + prevLeafPath);
-            }
-
-            prevLeafPath = nodePath;
-        }
-
-        let line = "  " + nodePath + " [label = \"";
-        let childIndex = 0;
-
-        for (let x of node) {
-            if (x instanceof Array) {
-                line += "<c" + childIndex.toString() + ">|"
-                childIndex++
-            } else {
-                console.log(x, newKey);
-                if (nodeIsLeaf && x == newKey) {
-                    lines.push("  new_key [label = \"new key\", shape = plaintext]");
-                    lines.push("  new_key -> " + nodePath + ":nk");
-                    line += "<nk>" + x.toString() + "|";
-                } else {
-                    line += x.toString() + "|";
-                }
-            }
-        }
-
-        line = line.substr(0, line.length - 1);
-        line += "\"]"
-        lines.push(line);
-
-        if (!nodeIsLeaf) {
-            childIndex = 0;
-
-            for (let x of node) {
-                if (x instanceof Array) {
-                    Array.prototype.push.apply(lines, f(x, nodePath + "_" + childIndex.toString(), level + 1));
-                    childIndex++;
-                }
-            }
-        }
-
-        return lines;
-    };
-
-    let lines = [
-        "digraph G {",
-        "  node [shape = record]"
-    ];
-
-    if (arrayTree.length >= 1) {
-        Array.prototype.push.apply(lines, f(arrayTree, "n", 0));
-
-        for (let nodePathsOfLevel of nodePathsOfLevels) {
-            lines.push("  { rank = same; "+ nodePathsOfLevel.join("; ") +"; }");
-        }
-    }
-
-    lines.push("}")
-    return lines.join("\n")
-}
-
 let curMaxDegree = 0;
 const opStack = [];
 let opStackHeight = 0;
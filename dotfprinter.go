@@ -0,0 +1,137 @@
+package bptree
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FprintDOT dumps the B+ tree as a Graphviz DOT script.
+// Nodes are named after their paths from the root, e.g. "n" for
+// the root and "n_0_1" for the 2nd child of the 1st child of the
+// root. Fields of non-leaves are separator keys and ports "c<i>"
+// pointing to children, fields of leaves are records with ports
+// "r<i>". Leaves are linked to each other in the order of the
+// leaf list.
+func (bpt *BPTree) FprintDOT(writer io.Writer) error {
+	bpt.lazyInit()
+
+	dotFprinter := dotFprinter{
+		Writer:   writer,
+		NodeName: "n",
+	}
+
+	if _, err := io.WriteString(writer, "digraph G {\n  node [shape = record]\n"); err != nil {
+		return err
+	}
+
+	if !bpt.IsEmpty() {
+		if err := bpt.Walk(dotFprinter.Fprint); err != nil {
+			return err
+		}
+
+		for _, nodeNames := range dotFprinter.NodeNamesOfLevels {
+			if _, err := fmt.Fprintf(writer, "  { rank = same; %s; }\n", strings.Join(nodeNames, "; ")); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.WriteString(writer, "}\n")
+	return err
+}
+
+type dotFprinter struct {
+	Writer            io.Writer
+	NodeName          string
+	NodeNamesOfLevels [][]string
+	PrevLeafName      string
+}
+
+func (df *dotFprinter) Fprint(nodeAccessor NodeAccessor) error {
+	nodeName := df.NodeName
+
+	if level := nodeAccessor.Depth() - 1; level == len(df.NodeNamesOfLevels) {
+		df.NodeNamesOfLevels = append(df.NodeNamesOfLevels, []string{nodeName})
+	} else {
+		df.NodeNamesOfLevels[level] = append(df.NodeNamesOfLevels[level], nodeName)
+	}
+
+	var label strings.Builder
+	n := nodeAccessor.NumberOfKeys()
+
+	if nodeAccessor.IsLeaf() {
+		for i := 0; i < n; i++ {
+			if i >= 1 {
+				label.WriteByte('|')
+			}
+
+			fmt.Fprintf(&label, "<r%d>%s", i, escapeDOTRecordLabel(formatRecord(nodeAccessor.GetKey(i), nodeAccessor.GetValue(i))))
+		}
+	} else {
+		label.WriteString("<c0>")
+
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&label, "|%s|<c%d>", escapeDOTRecordLabel(fmt.Sprintf("%v", nodeAccessor.GetKey(i))), i+1)
+		}
+	}
+
+	if _, err := fmt.Fprintf(df.Writer, "  %s [label = \"%s\"]\n", nodeName, label.String()); err != nil {
+		return err
+	}
+
+	if nodeAccessor.IsLeaf() {
+		if df.PrevLeafName != "" {
+			if _, err := fmt.Fprintf(df.Writer, "  %s -> %s [dir = both, style = dashed]\n", df.PrevLeafName, nodeName); err != nil {
+				return err
+			}
+		}
+
+		df.PrevLeafName = nodeName
+		return nil
+	}
+
+	for i := 0; i <= n; i++ {
+		childName := nodeName + "_" + strconv.Itoa(i)
+
+		if _, err := fmt.Fprintf(df.Writer, "  %s:c%d -> %s\n", nodeName, i, childName); err != nil {
+			return err
+		}
+
+		df.NodeName = childName
+
+		if err := nodeAccessor.AccessChild(df.Fprint, i); err != nil {
+			return err
+		}
+	}
+
+	df.NodeName = nodeName
+	return nil
+}
+
+func escapeDOTRecordLabel(s string) string {
+	var builder strings.Builder
+
+	for _, c := range s {
+		switch c {
+		case '{', '}', '|', '<', '>', '"', '\\':
+			builder.WriteByte('\\')
+		case '\n':
+			builder.WriteString("\\n")
+			continue
+		}
+
+		builder.WriteRune(c)
+	}
+
+	return builder.String()
+}
+
+func formatRecord(key, value interface{}) string {
+	if value == nil {
+		return fmt.Sprintf("%v", key)
+	}
+
+	return fmt.Sprintf("%v=%v", key, value)
+}
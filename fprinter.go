@@ -7,70 +7,209 @@ import (
 
 // Fprint dumps the B+ tree as plain text for debugging purposes.
 func (bpt *BPTree) Fprint(writer io.Writer) error {
-	return bpt.Walk((&fprinter{writer, "", "\n"}).Fprint)
+	return bpt.FprintWithOptions(writer, FprintOptions{})
+}
+
+// FprintWithOptions dumps the B+ tree as plain text with the given
+// options. The output is deterministic for a given B+ tree and the
+// given options.
+func (bpt *BPTree) FprintWithOptions(writer io.Writer, options FprintOptions) error {
+	bpt.lazyInit()
+
+	f := fprinter{
+		Writer:  writer,
+		Options: options,
+		Prefix:  "",
+		NewLine: "\n",
+	}
+
+	if f.Options.KeyFormatter == nil {
+		f.Options.KeyFormatter = formatValue
+	}
+
+	if f.Options.ValueFormatter == nil {
+		f.Options.ValueFormatter = formatValue
+	}
+
+	if err := bpt.Walk(f.Fprint); err != nil {
+		return err
+	}
+
+	if !options.ShowSummary {
+		return nil
+	}
+
+	return f.FprintSummary(bpt)
+}
+
+// FprintOptions represents the options for FprintWithOptions.
+type FprintOptions struct {
+	// MaxDepth limits the depth of nodes to dump, the children
+	// of non-leaves at the maximum depth are elided. A value <= 0
+	// means no limit.
+	MaxDepth int
+
+	// MaxKeysPerNode limits the number of keys (records for leaves)
+	// to dump per node, the rest are elided with an ellipsis. A value
+	// <= 0 means no limit.
+	MaxKeysPerNode int
+
+	// KeyFormatter formats keys, which defaults to formatting with %v.
+	KeyFormatter func(key interface{}) string
+
+	// ValueFormatter formats values, which defaults to formatting
+	// with %v.
+	ValueFormatter func(value interface{}) string
+
+	// ShowNodeInfo indicates whether to annotate each node with its
+	// size and fill ratio.
+	ShowNodeInfo bool
+
+	// ShowSummary indicates whether to append a summary footer with
+	// the number of records, the height, the number of leaves and the
+	// average fill ratio of leaves.
+	ShowSummary bool
 }
 
 type fprinter struct {
 	Writer  io.Writer
+	Options FprintOptions
 	Prefix  string
 	NewLine string
+	IsDirty bool
 }
 
 func (f *fprinter) Fprint(nodeAccessor NodeAccessor) error {
-	if nodeAccessor.IsLeaf() {
-		n := nodeAccessor.NumberOfKeys()
+	items := f.makeItems(nodeAccessor)
+	prefix, newLine := f.Prefix, f.NewLine
 
-		for i := 0; i < n; i++ {
-			key, value := nodeAccessor.GetKey(i), nodeAccessor.GetValue(i)
-			var err error
-
-			switch i {
-			case 0:
-				if n == 1 {
-					_, err = fmt.Fprintf(f.Writer, "%s──● %v=%v", f.Prefix, key, value)
-				} else {
-					_, err = fmt.Fprintf(f.Writer, "%s┬─● %v=%v", f.Prefix, key, value)
-				}
-			case n - 1:
-				_, err = fmt.Fprintf(f.Writer, "%s└─● %v=%v", f.NewLine, key, value)
-			default:
-				_, err = fmt.Fprintf(f.Writer, "%s├─● %v=%v", f.NewLine, key, value)
+	for i, item := range items {
+		var lead, childNewLine string
+
+		switch i {
+		case 0:
+			if len(items) == 1 {
+				lead, childNewLine = prefix+"──", newLine+"  "
+			} else {
+				lead, childNewLine = prefix+"┬─", newLine+"│ "
 			}
+		case len(items) - 1:
+			lead, childNewLine = newLine+"└─", newLine+"  "
+		default:
+			lead, childNewLine = newLine+"├─", newLine+"│ "
+		}
 
-			if err != nil {
+		if item.ChildIndex < 0 {
+			if _, err := fmt.Fprintf(f.Writer, "%s%s", lead, item.Text); err != nil {
 				return err
 			}
+
+			f.IsDirty = true
+			continue
 		}
-	} else {
-		prefix, newLine := f.Prefix, f.NewLine
-		f.Prefix, f.NewLine = prefix+"┬─", newLine+"│ "
 
-		if err := nodeAccessor.AccessChild(f.Fprint, 0); err != nil {
+		f.Prefix, f.NewLine = lead, childNewLine
+		err := nodeAccessor.AccessChild(f.Fprint, item.ChildIndex)
+		f.Prefix, f.NewLine = prefix, newLine
+
+		if err != nil {
 			return err
 		}
+	}
 
-		n := nodeAccessor.NumberOfKeys()
+	return nil
+}
 
-		for i := 0; i < n; i++ {
-			key := nodeAccessor.GetKey(i)
+func (f *fprinter) FprintSummary(bpt *BPTree) error {
+	var numberOfRecords, numberOfLeaves int
 
-			if _, err := fmt.Fprintf(f.Writer, "%s├─● %v", newLine, key); err != nil {
-				return err
-			}
+	for leaf := bpt.leafList.Head(); ; leaf = leaf.Next {
+		numberOfRecords += leaf.NumberOfRecords()
+		numberOfLeaves++
 
-			if i == n-1 {
-				f.Prefix, f.NewLine = newLine+"└─", newLine+"  "
-			} else {
-				f.Prefix, f.NewLine = newLine+"├─", newLine+"│ "
-			}
+		if leaf == bpt.leafList.Tail() {
+			break
+		}
+	}
 
-			if err := nodeAccessor.AccessChild(f.Fprint, i+1); err != nil {
-				return err
-			}
+	averageFillRatio := float64(numberOfRecords) / float64(numberOfLeaves*bpt.options.LeafCapacity)
+
+	var newLine string
+
+	if f.IsDirty {
+		newLine = f.NewLine
+	}
+
+	_, err := fmt.Fprintf(f.Writer, "%srecords: %d, height: %d, leaves: %d, average fill: %.1f%%",
+		newLine, numberOfRecords, bpt.height, numberOfLeaves, averageFillRatio*100)
+	return err
+}
+
+func (f *fprinter) makeItems(nodeAccessor NodeAccessor) []fprinterItem {
+	var items []fprinterItem
+
+	if f.Options.ShowNodeInfo {
+		var text string
+
+		if nodeAccessor.IsLeaf() {
+			text = fmt.Sprintf("◇ %d records (%.1f%%)", nodeAccessor.NumberOfKeys(), nodeAccessor.FillRatio()*100)
+		} else {
+			text = fmt.Sprintf("◇ %d children (%.1f%%)", nodeAccessor.NumberOfChildren(), nodeAccessor.FillRatio()*100)
 		}
 
-		f.Prefix, f.NewLine = prefix, newLine
+		items = append(items, fprinterItem{text, -1})
 	}
 
-	return nil
+	n := nodeAccessor.NumberOfKeys()
+	m := n
+
+	if f.Options.MaxKeysPerNode >= 1 && m > f.Options.MaxKeysPerNode {
+		m = f.Options.MaxKeysPerNode
+	}
+
+	if nodeAccessor.IsLeaf() {
+		for i := 0; i < m; i++ {
+			key, value := nodeAccessor.GetKey(i), nodeAccessor.GetValue(i)
+			text := "● " + f.Options.KeyFormatter(key) + "=" + f.Options.ValueFormatter(value)
+			items = append(items, fprinterItem{text, -1})
+		}
+
+		if m < n {
+			items = append(items, fprinterItem{fmt.Sprintf("… %d more records", n-m), -1})
+		}
+
+		return items
+	}
+
+	childIsElided := f.Options.MaxDepth >= 1 && nodeAccessor.Depth() >= f.Options.MaxDepth
+	items = append(items, f.makeChildItem(0, childIsElided))
+
+	for i := 0; i < m; i++ {
+		key := nodeAccessor.GetKey(i)
+		items = append(items, fprinterItem{"● " + f.Options.KeyFormatter(key), -1})
+		items = append(items, f.makeChildItem(i+1, childIsElided))
+	}
+
+	if m < n {
+		items = append(items, fprinterItem{fmt.Sprintf("… %d more keys", n-m), -1})
+	}
+
+	return items
+}
+
+func (f *fprinter) makeChildItem(childIndex int, childIsElided bool) fprinterItem {
+	if childIsElided {
+		return fprinterItem{"…", -1}
+	}
+
+	return fprinterItem{"", childIndex}
+}
+
+type fprinterItem struct {
+	Text       string
+	ChildIndex int
+}
+
+func formatValue(value interface{}) string {
+	return fmt.Sprintf("%v", value)
 }
@@ -0,0 +1,167 @@
+package bptree_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func MakeSmallBPTree() *bptree.BPTree {
+	bpt := new(bptree.BPTree).Init(4, func(key1, key2 interface{}) int64 {
+		return int64(key1.(int) - key2.(int))
+	})
+
+	// 10 goes first, so that no insertions are at the end and leaves
+	// are split in halves.
+	bpt.AddRecord(10, nil)
+
+	for i := 1; i <= 9; i++ {
+		bpt.AddRecord(i, nil)
+	}
+
+	bpt.UpdateRecord(3, "x|y")
+	return bpt
+}
+
+func TestBPTreeFprintDOT(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	err := MakeSmallBPTree().FprintDOT(b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `digraph G {
+  node [shape = record]
+  n [label = "<c0>|5|<c1>|7|<c2>"]
+  n:c0 -> n_0
+  n_0 [label = "<r0>1|<r1>2|<r2>3=x\|y|<r3>4"]
+  n:c1 -> n_1
+  n_1 [label = "<r0>5|<r1>6"]
+  n_0 -> n_1 [dir = both, style = dashed]
+  n:c2 -> n_2
+  n_2 [label = "<r0>7|<r1>8|<r2>9|<r3>10"]
+  n_1 -> n_2 [dir = both, style = dashed]
+  { rank = same; n; }
+  { rank = same; n_0; n_1; n_2; }
+}
+`, b.String())
+	}
+
+	b.Reset()
+	err = new(bptree.BPTree).Init(4, nil).FprintDOT(b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "digraph G {\n  node [shape = record]\n}\n", b.String())
+	}
+}
+
+func TestBPTreeFprintMermaid(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	err := MakeSmallBPTree().FprintMermaid(b)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `flowchart TD
+  n["5 | 7"]
+  n --> n_0
+  n_0["1 | 2 | 3=x|y | 4"]
+  n --> n_1
+  n_1["5 | 6"]
+  n_0 <-.-> n_1
+  n --> n_2
+  n_2["7 | 8 | 9 | 10"]
+  n_1 <-.-> n_2
+`, b.String())
+	}
+}
+
+func TestBPTreeMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(MakeSmallBPTree())
+
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+  "maxDegree": 4,
+  "height": 2,
+  "root": {
+    "name": "n",
+    "keys": [5, 7],
+    "children": [
+      {"name": "n_0", "records": [{"key": 1, "value": null}, {"key": 2, "value": null}, {"key": 3, "value": "x|y"}, {"key": 4, "value": null}], "next": "n_1"},
+      {"name": "n_1", "records": [{"key": 5, "value": null}, {"key": 6, "value": null}], "prev": "n_0", "next": "n_2"},
+      {"name": "n_2", "records": [{"key": 7, "value": null}, {"key": 8, "value": null}, {"key": 9, "value": null}, {"key": 10, "value": null}], "prev": "n_1"}
+    ]
+  }
+}`, string(data))
+	}
+}
+
+func TestBPTreeFprintWithOptions(t *testing.T) {
+	bpt := MakeSmallBPTree()
+	b := bytes.NewBuffer(nil)
+	err := bpt.FprintWithOptions(b, bptree.FprintOptions{})
+
+	if assert.NoError(t, err) {
+		b2 := bytes.NewBuffer(nil)
+		bpt.Fprint(b2)
+		assert.Equal(t, b2.String(), b.String())
+	}
+
+	b.Reset()
+
+	err = bpt.FprintWithOptions(b, bptree.FprintOptions{
+		MaxKeysPerNode: 2,
+		KeyFormatter:   func(key interface{}) string { return fmt.Sprintf("%03d", key) },
+		ValueFormatter: func(value interface{}) string { return fmt.Sprintf("%q", value) },
+		ShowNodeInfo:   true,
+		ShowSummary:    true,
+	})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `┬─◇ 3 children (75.0%)
+├─┬─◇ 4 records (100.0%)
+│ ├─● 001=%!q(<nil>)
+│ ├─● 002=%!q(<nil>)
+│ └─… 2 more records
+├─● 005
+├─┬─◇ 2 records (50.0%)
+│ ├─● 005=%!q(<nil>)
+│ └─● 006=%!q(<nil>)
+├─● 007
+└─┬─◇ 4 records (100.0%)
+  ├─● 007=%!q(<nil>)
+  ├─● 008=%!q(<nil>)
+  └─… 2 more records
+records: 10, height: 2, leaves: 3, average fill: 83.3%`, b.String())
+	}
+
+	b.Reset()
+	err = bpt.FprintWithOptions(b, bptree.FprintOptions{MaxDepth: 1, MaxKeysPerNode: 1})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, `┬─…
+├─● 5
+├─…
+└─… 1 more keys`, b.String())
+	}
+
+	b.Reset()
+	err = new(bptree.BPTree).Init(4, nil).FprintWithOptions(b, bptree.FprintOptions{ShowSummary: true})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "records: 0, height: 1, leaves: 1, average fill: 0.0%", b.String())
+	}
+}
+
+func TestBPTreeFprintSummary(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	b := bytes.NewBuffer(nil)
+	err := bpt.FprintWithOptions(b, bptree.FprintOptions{MaxDepth: 2, ShowSummary: true})
+
+	if assert.NoError(t, err) {
+		s := b.String()
+		i := strings.LastIndexByte(s, '\n')
+		assert.Regexp(t, fmt.Sprintf(`^records: %d, height: %d, leaves: \d+, average fill: \d+\.\d%%$`, len(Keywords), bpt.Height()), s[i+1:])
+	}
+}
@@ -0,0 +1,389 @@
+package bptree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"unsafe"
+)
+
+// Encoder encodes keys or values into bytes for hashing.
+type Encoder func(keyOrValue interface{}) []byte
+
+// EnableHashing makes the B+ tree maintain a cryptographic hash of
+// every node, which is a SHA-256 hash covering the keys and values
+// in the subtree, so that the presence or absence of records can
+// be proved with the root hash.
+// Keys are encoded with the given key encoder, which must preserve
+// the order of keys in bytes.Compare order (see the keyenc package),
+// and can be nil for keys of kinds other than GenericKeys. Values
+// are encoded with the given value encoder, which can be nil for
+// values of type []byte or string.
+// Hashes are computed lazily and invalidated on changes, so the cost
+// of insertions and deletions is to descend from the root.
+func (bpt *BPTree) EnableHashing(keyEncoder Encoder, valueEncoder Encoder) {
+	bpt.lazyInit()
+
+	if keyEncoder == nil {
+		switch bpt.keyKind {
+		case GenericKeys:
+			panic(errors.New("bptree: key encoder required"))
+		case BytesKeys:
+			keyEncoder = encodeBytesKey
+		case Int64Keys:
+			keyEncoder = encodeInt64Key
+		case Uint64Keys:
+			keyEncoder = encodeUint64Key
+		case Float64Keys:
+			keyEncoder = encodeFloat64Key
+		case StringKeys:
+			keyEncoder = encodeStringKey
+		}
+	}
+
+	if valueEncoder == nil {
+		valueEncoder = encodeValue
+	}
+
+	bpt.hasher = &hasher{
+		KeyEncoder:   keyEncoder,
+		ValueEncoder: valueEncoder,
+	}
+
+	bpt.invalidateHashes(bpt.root, 1)
+}
+
+// DisableHashing stops maintaining hashes of nodes.
+func (bpt *BPTree) DisableHashing() {
+	bpt.hasher = nil
+}
+
+// RootHash returns the hash of the root of the B+ tree.
+// Hashing must be enabled.
+func (bpt *BPTree) RootHash() []byte {
+	bpt.checkHashing()
+	return bpt.nodeHash(bpt.root, 1)
+}
+
+// Prove returns a proof of the presence or absence of a record
+// with the given key in the B+ tree, which can be verified with
+// the root hash by VerifyProof.
+// Hashing must be enabled.
+func (bpt *BPTree) Prove(key interface{}) *Proof {
+	bpt.checkHashing()
+
+	if _, ok := key.(keyMinMax); ok {
+		panic(errors.New("bptree: invalid key"))
+	}
+
+	recordPath, _ := bpt.findRecord(key)
+	var proof Proof
+
+	for i := 0; i < len(recordPath)-1; i++ {
+		nonLeaf := recordPath[i].NonLeaf()
+		n := nonLeaf.NumberOfChildren()
+		proofNode := ProofNode{
+			Keys:        make([][]byte, n-1),
+			ChildHashes: make([][]byte, n),
+			ChildIndex:  recordPath[i].NodeChildIndex(),
+		}
+
+		for j := 0; j < n; j++ {
+			if j >= 1 {
+				proofNode.Keys[j-1] = bpt.hasher.KeyEncoder(nonLeaf.Key(j))
+			}
+
+			if j != proofNode.ChildIndex {
+				proofNode.ChildHashes[j] = bpt.nodeHash(nonLeaf.Child(j), i+2)
+			}
+		}
+
+		proof.Path = append(proof.Path, proofNode)
+	}
+
+	leaf, _ := recordPath.LocateRecord()
+	proof.Records = make([]ProofRecord, leaf.NumberOfRecords())
+
+	for i := range proof.Records {
+		proof.Records[i] = bpt.proofRecord(leaf, i)
+	}
+
+	return &proof
+}
+
+// Proof represents a proof of the presence or absence of a record
+// in a B+ tree, which consists of the nodes on the path from the
+// root to the leaf where the record is or would be.
+type Proof struct {
+	// Path holds the non-leaves on the path, from the root.
+	Path []ProofNode
+
+	// Records holds the records of the leaf.
+	Records []ProofRecord
+}
+
+// ProofNode represents a non-leaf in a proof.
+type ProofNode struct {
+	// Keys holds the encoded keys of children except the first one.
+	Keys [][]byte
+
+	// ChildHashes holds the hashes of children, except the one on
+	// the path, whose hash is computed in verification.
+	ChildHashes [][]byte
+
+	// ChildIndex is the index of the child on the path.
+	ChildIndex int
+}
+
+// ProofRecord represents a record of the leaf in a proof.
+type ProofRecord struct {
+	Key       []byte
+	ValueHash []byte
+}
+
+// VerifyProof verifies the given proof for the given encoded key
+// against the given root hash. For a proof of presence, it returns
+// true and the value hash of the record, which can be compared with
+// HashValue of the encoded value, for a proof of absence, it returns
+// false. It returns an error if the proof is invalid.
+func VerifyProof(rootHash []byte, key []byte, proof *Proof) ([]byte, bool, error) {
+	var valueHash []byte
+
+	for i, record := range proof.Records {
+		if i >= 1 && bytes.Compare(proof.Records[i-1].Key, record.Key) >= 0 {
+			return nil, false, errors.New("bptree: invalid proof: records out of order")
+		}
+
+		if bytes.Equal(record.Key, key) {
+			valueHash = record.ValueHash
+		}
+	}
+
+	hash := hashLeaf(proof.Records)
+
+	for i := len(proof.Path) - 1; i >= 0; i-- {
+		proofNode := &proof.Path[i]
+		n := len(proofNode.ChildHashes)
+
+		if n < 1 || len(proofNode.Keys) != n-1 || proofNode.ChildIndex < 0 || proofNode.ChildIndex >= n {
+			return nil, false, errors.New("bptree: invalid proof: malformed node")
+		}
+
+		// the key must be within the bounds of the child on the path,
+		// to which the keys of the node are committed by the hash.
+		if j := proofNode.ChildIndex; (j >= 1 && bytes.Compare(key, proofNode.Keys[j-1]) < 0) ||
+			(j < n-1 && bytes.Compare(key, proofNode.Keys[j]) >= 0) {
+			return nil, false, errors.New("bptree: invalid proof: key out of bounds")
+		}
+
+		childHashes := append([][]byte(nil), proofNode.ChildHashes...)
+		childHashes[proofNode.ChildIndex] = hash
+		hash = hashNonLeaf(proofNode.Keys, childHashes)
+	}
+
+	if !bytes.Equal(hash, rootHash) {
+		return nil, false, errors.New("bptree: invalid proof: root hash mismatch")
+	}
+
+	return valueHash, valueHash != nil, nil
+}
+
+// HashValue returns the hash of the given encoded value, as in
+// proofs.
+func HashValue(value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+type hasher struct {
+	KeyEncoder   Encoder
+	ValueEncoder Encoder
+}
+
+func (bpt *BPTree) checkHashing() {
+	if bpt.hasher == nil {
+		panic(errors.New("bptree: hashing disabled"))
+	}
+}
+
+type digest struct {
+	// Hash is the Merkle hash of the node.
+	Hash []byte
+
+	// RangeHash is the XOR of the hashes of the records in the
+	// subtree, which unlike Hash is independent of the structure.
+	RangeHash [sha256.Size]byte
+
+	NumberOfRecords int
+}
+
+func (bpt *BPTree) nodeHash(node unsafe.Pointer, nodeDepth int) []byte {
+	return bpt.nodeDigest(node, nodeDepth).Hash
+}
+
+func (bpt *BPTree) nodeDigest(node unsafe.Pointer, nodeDepth int) *digest {
+	if nodeDepth == bpt.height {
+		leaf := (*leaf)(node)
+
+		if leaf.digest == nil {
+			records := make([]ProofRecord, leaf.NumberOfRecords())
+			digest := digest{NumberOfRecords: len(records)}
+
+			for i := range records {
+				records[i] = bpt.proofRecord(leaf, i)
+				xorHash(&digest.RangeHash, hashRecord(records[i]))
+			}
+
+			digest.Hash = hashLeaf(records)
+			leaf.digest = &digest
+		}
+
+		return leaf.digest
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+
+	if nonLeaf.digest == nil {
+		n := nonLeaf.NumberOfChildren()
+		keys := make([][]byte, n-1)
+		childHashes := make([][]byte, n)
+		var digest digest
+
+		for i := 0; i < n; i++ {
+			if i >= 1 {
+				keys[i-1] = bpt.hasher.KeyEncoder(nonLeaf.Key(i))
+			}
+
+			childDigest := bpt.nodeDigest(nonLeaf.Child(i), nodeDepth+1)
+			childHashes[i] = childDigest.Hash
+			xorHash(&digest.RangeHash, childDigest.RangeHash[:])
+			digest.NumberOfRecords += childDigest.NumberOfRecords
+		}
+
+		digest.Hash = hashNonLeaf(keys, childHashes)
+		nonLeaf.digest = &digest
+	}
+
+	return nonLeaf.digest
+}
+
+func (bpt *BPTree) proofRecord(leaf *leaf, recordIndex int) ProofRecord {
+	return ProofRecord{
+		Key:       bpt.hasher.KeyEncoder(leaf.Key(recordIndex)),
+		ValueHash: HashValue(bpt.hasher.ValueEncoder(leaf.Value(recordIndex))),
+	}
+}
+
+func (bpt *BPTree) invalidateHashes(node unsafe.Pointer, nodeDepth int) {
+	if nodeDepth == bpt.height {
+		(*leaf)(node).digest = nil
+		return
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+	nonLeaf.digest = nil
+
+	for i := 0; i < nonLeaf.NumberOfChildren(); i++ {
+		bpt.invalidateHashes(nonLeaf.Child(i), nodeDepth+1)
+	}
+}
+
+func hashLeaf(records []ProofRecord) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+
+	for _, record := range records {
+		writeBytes(h, record.Key)
+		writeBytes(h, record.ValueHash)
+	}
+
+	return h.Sum(nil)
+}
+
+func hashNonLeaf(keys [][]byte, childHashes [][]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x02})
+	writeBytes(h, childHashes[0])
+
+	for i, key := range keys {
+		writeBytes(h, key)
+		writeBytes(h, childHashes[i+1])
+	}
+
+	return h.Sum(nil)
+}
+
+func hashRecord(record ProofRecord) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x03})
+	writeBytes(h, record.Key)
+	writeBytes(h, record.ValueHash)
+	return h.Sum(nil)
+}
+
+func xorHash(hash *[sha256.Size]byte, other []byte) {
+	for i := range hash {
+		hash[i] ^= other[i]
+	}
+}
+
+func writeBytes(w interface{ Write([]byte) (int, error) }, data []byte) {
+	var buffer [binary.MaxVarintLen64]byte
+	w.Write(buffer[:binary.PutUvarint(buffer[:], uint64(len(data)))])
+	w.Write(data)
+}
+
+func encodeBytesKey(key interface{}) []byte {
+	return key.([]byte)
+}
+
+func encodeStringKey(key interface{}) []byte {
+	return []byte(key.(string))
+}
+
+func encodeInt64Key(key interface{}) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(key.(int64))^(1<<63))
+	return data[:]
+}
+
+func encodeUint64Key(key interface{}) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], key.(uint64))
+	return data[:]
+}
+
+func encodeFloat64Key(key interface{}) []byte {
+	x := key.(float64)
+
+	if x == 0 {
+		x = 0 // -0 == 0
+	}
+
+	bits := math.Float64bits(x)
+
+	if bits>>63 == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], bits)
+	return data[:]
+}
+
+func encodeValue(value interface{}) []byte {
+	switch value := value.(type) {
+	case []byte:
+		return value
+	case string:
+		return []byte(value)
+	default:
+		panic(errors.New("bptree: value encoder required"))
+	}
+}
@@ -0,0 +1,191 @@
+package bptree_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/roy2220/bptree/keyenc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeRootHash(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(5, bptree.Int64Keys, nil)
+	bpt.EnableHashing(nil, nil)
+	emptyRootHash := bpt.RootHash()
+	assert.Len(t, emptyRootHash, 32)
+
+	for i := 0; i < 3000; i++ {
+		k := int64(rand.Intn(1000))
+
+		switch rand.Intn(3) {
+		case 0:
+			bpt.DeleteRecord(k)
+		case 1:
+			bpt.AddOrUpdateRecord(k, strconv.Itoa(i))
+		default:
+			bpt.UpdateRecord(k, strconv.Itoa(-i))
+		}
+
+		if i%10 == 0 {
+			// the cached hashes must match the hashes computed from scratch.
+			if !assert.Equal(t, bpt.Clone(nil).RootHash(), bpt.RootHash(), "%v", i) {
+				t.FailNow()
+			}
+		}
+	}
+
+	rootHash := bpt.RootHash()
+	bpt2 := bpt.Clone(nil)
+	k, v, _ := bpt2.Ceiling(int64(0))
+	bpt2.UpdateRecord(k, v.(string)+"!")
+	assert.NotEqual(t, rootHash, bpt2.RootHash())
+	bpt2.UpdateRecord(k, v)
+	assert.Equal(t, rootHash, bpt2.RootHash())
+
+	bpt.Compact(1)
+	assert.Equal(t, bpt.Clone(nil).RootHash(), bpt.RootHash())
+	assert.NotEqual(t, rootHash, bpt.RootHash())
+
+	for i := int64(0); i < 1000; i++ {
+		bpt.DeleteRecord(i)
+	}
+
+	assert.Equal(t, emptyRootHash, bpt.RootHash())
+
+	for i := int64(0); i < 1000; i++ {
+		bpt.AddRecord(i, "")
+	}
+
+	assert.Equal(t, bpt.Clone(nil).RootHash(), bpt.RootHash())
+	bpt.DisableHashing()
+	assert.Panics(t, func() { bpt.RootHash() })
+	assert.Panics(t, func() { bpt.Prove(int64(0)) })
+	bpt.UpdateRecord(int64(0), "x")
+	bpt.EnableHashing(nil, nil)
+	assert.Equal(t, bpt.Clone(nil).RootHash(), bpt.RootHash())
+}
+
+func TestBPTreeProve(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	bpt.EnableHashing(nil, nil)
+
+	for i, k := range Keywords[:1000] {
+		bpt.AddRecord(k, strconv.Itoa(i))
+	}
+
+	rootHash := bpt.RootHash()
+
+	for i, k := range Keywords[:1000] {
+		valueHash, ok, err := bptree.VerifyProof(rootHash, []byte(k), bpt.Prove(k))
+
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		assert.True(t, ok)
+		assert.Equal(t, bptree.HashValue([]byte(strconv.Itoa(i))), valueHash)
+	}
+
+	for _, k := range Keywords[1000:1100] {
+		valueHash, ok, err := bptree.VerifyProof(rootHash, []byte(k), bpt.Prove(k))
+
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		assert.False(t, ok)
+		assert.Nil(t, valueHash)
+	}
+
+	k := Keywords[0]
+	proof := bpt.Prove(k)
+	// a proof for one key does not prove the absence of another one.
+	_, _, err := bptree.VerifyProof(rootHash, []byte(Keywords[1]), proof)
+	assert.Error(t, err)
+	_, _, err = bptree.VerifyProof(bptree.HashValue(nil), []byte(k), proof)
+	assert.Error(t, err)
+
+	for i := range proof.Records {
+		if bytes.Equal(proof.Records[i].Key, []byte(k)) {
+			proof.Records[i].ValueHash = bptree.HashValue([]byte("forged"))
+		}
+	}
+
+	_, _, err = bptree.VerifyProof(rootHash, []byte(k), proof)
+	assert.Error(t, err)
+
+	proof = bpt.Prove(k)
+	proof.Records = append(proof.Records[:0:0], proof.Records...)
+
+	for i := range proof.Records {
+		if bytes.Equal(proof.Records[i].Key, []byte(k)) {
+			proof.Records = append(proof.Records[:i], proof.Records[i+1:]...)
+			break
+		}
+	}
+
+	_, _, err = bptree.VerifyProof(rootHash, []byte(k), proof)
+	assert.Error(t, err)
+
+	proof = bpt.Prove(k)
+	proof.Path[0].ChildIndex = len(proof.Path[0].ChildHashes)
+	_, _, err = bptree.VerifyProof(rootHash, []byte(k), proof)
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { bpt.Prove(bptree.KeyMin) })
+}
+
+func TestBPTreeProveSequential(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	bpt.EnableHashing(nil, nil)
+
+	for i := 0; i < 200; i++ {
+		bpt.AddRecord(fmt.Sprintf("%04d", i), strconv.Itoa(i))
+		rootHash := bpt.RootHash()
+
+		for j := 0; j <= i+1; j++ {
+			k := fmt.Sprintf("%04d", j)
+			_, ok, err := bptree.VerifyProof(rootHash, []byte(k), bpt.Prove(k))
+
+			if !assert.NoError(t, err, "%v %v", i, j) {
+				t.FailNow()
+			}
+
+			assert.Equal(t, j <= i, ok)
+		}
+	}
+}
+
+func TestBPTreeHashingWithEncoders(t *testing.T) {
+	type value struct{ x int }
+
+	bpt := new(bptree.BPTree).Init(4, keyenc.Compare)
+	assert.Panics(t, func() { bpt.EnableHashing(nil, nil) })
+	bpt.EnableHashing(func(key interface{}) []byte {
+		return key.([]byte)
+	}, func(v interface{}) []byte {
+		return []byte(strconv.Itoa(v.(value).x))
+	})
+
+	for i := 0; i < 200; i++ {
+		key, _ := keyenc.Encode("user", int64(i))
+		bpt.AddRecord(key, value{i})
+	}
+
+	rootHash := bpt.RootHash()
+	key, _ := keyenc.Encode("user", int64(100))
+	valueHash, ok, err := bptree.VerifyProof(rootHash, key, bpt.Prove(key))
+
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+		assert.Equal(t, bptree.HashValue([]byte("100")), valueHash)
+	}
+
+	bpt2 := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	bpt2.EnableHashing(nil, nil)
+	assert.Panics(t, func() { bpt2.AddRecord(int64(1), value{1}); bpt2.RootHash() })
+}
@@ -0,0 +1,101 @@
+package bptree
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// MarshalJSON dumps the structure of the B+ tree as JSON.
+// Nodes are named after their paths from the root in the same
+// way as FprintDOT does, non-leaves have separator keys and
+// children, leaves have records and the names of the previous
+// and next leaves in the leaf list.
+func (bpt *BPTree) MarshalJSON() ([]byte, error) {
+	bpt.lazyInit()
+
+	jsonMarshaler := jsonMarshaler{
+		NodeName: "n",
+	}
+
+	if err := bpt.Walk(jsonMarshaler.Marshal); err != nil {
+		return nil, err
+	}
+
+	for i, jsonLeaf := range jsonMarshaler.Leaves {
+		if i >= 1 {
+			jsonLeaf.Prev = jsonMarshaler.Leaves[i-1].Name
+		}
+
+		if i < len(jsonMarshaler.Leaves)-1 {
+			jsonLeaf.Next = jsonMarshaler.Leaves[i+1].Name
+		}
+	}
+
+	return json.Marshal(jsonTree{
+		MaxDegree: bpt.MaxDegree(),
+		Height:    bpt.height,
+		Root:      jsonMarshaler.Node,
+	})
+}
+
+type jsonMarshaler struct {
+	NodeName string
+	Node     *jsonNode
+	Leaves   []*jsonNode
+}
+
+func (jm *jsonMarshaler) Marshal(nodeAccessor NodeAccessor) error {
+	jsonNode1 := jsonNode{Name: jm.NodeName}
+	n := nodeAccessor.NumberOfKeys()
+
+	if nodeAccessor.IsLeaf() {
+		jsonNode1.Records = make([]jsonRecord, n)
+
+		for i := range jsonNode1.Records {
+			jsonNode1.Records[i] = jsonRecord{nodeAccessor.GetKey(i), nodeAccessor.GetValue(i)}
+		}
+
+		jm.Leaves = append(jm.Leaves, &jsonNode1)
+	} else {
+		jsonNode1.Keys = make([]interface{}, n)
+
+		for i := range jsonNode1.Keys {
+			jsonNode1.Keys[i] = nodeAccessor.GetKey(i)
+		}
+
+		jsonNode1.Children = make([]*jsonNode, n+1)
+
+		for i := range jsonNode1.Children {
+			jm.NodeName = jsonNode1.Name + "_" + strconv.Itoa(i)
+
+			if err := nodeAccessor.AccessChild(jm.Marshal, i); err != nil {
+				return err
+			}
+
+			jsonNode1.Children[i] = jm.Node
+		}
+	}
+
+	jm.Node = &jsonNode1
+	return nil
+}
+
+type jsonTree struct {
+	MaxDegree int       `json:"maxDegree"`
+	Height    int       `json:"height"`
+	Root      *jsonNode `json:"root"`
+}
+
+type jsonNode struct {
+	Name     string        `json:"name"`
+	Keys     []interface{} `json:"keys,omitempty"`
+	Children []*jsonNode   `json:"children,omitempty"`
+	Records  []jsonRecord  `json:"records,omitempty"`
+	Prev     string        `json:"prev,omitempty"`
+	Next     string        `json:"next,omitempty"`
+}
+
+type jsonRecord struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
@@ -0,0 +1,315 @@
+// Package keyenc encodes tuples into byte strings, in such a way
+// that the order of encoded tuples by bytes.Compare matches the
+// order of the tuples, so composite keys can be compared without
+// type assertions on each field.
+//
+// Supported field types are nil, bool, int, int8, int16, int32,
+// int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+// string and []byte. Fields are ordered by their values within
+// the same kind, and by their kinds otherwise:
+// nil < false < true < signed integers < unsigned integers <
+// floats < strings < byte slices.
+// A tuple is ordered before any longer tuple it is a prefix of.
+// Fields wrapped by Desc are ordered in reverse, and after all the
+// ascending fields at the same position.
+package keyenc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	tagNil   = 0x01
+	tagFalse = 0x02
+	tagTrue  = 0x03
+	tagInt   = 0x10
+	tagUint  = 0x11
+	tagFloat = 0x12
+	tagStr   = 0x20
+	tagBytes = 0x21
+)
+
+// Descending wraps a field to reverse its order.
+type Descending struct {
+	Value interface{}
+}
+
+// Desc returns the given field wrapped to be encoded in
+// descending order.
+func Desc(field interface{}) Descending {
+	return Descending{field}
+}
+
+// Encode encodes the given fields of a tuple.
+func Encode(fields ...interface{}) ([]byte, error) {
+	return Append(nil, fields...)
+}
+
+// Append encodes the given fields of a tuple and appends them to
+// the given buffer.
+func Append(buffer []byte, fields ...interface{}) ([]byte, error) {
+	for _, field := range fields {
+		var err error
+
+		if descending, ok := field.(Descending); ok {
+			i := len(buffer)
+
+			if buffer, err = appendField(buffer, descending.Value); err != nil {
+				return nil, err
+			}
+
+			invertBytes(buffer[i:])
+		} else {
+			if buffer, err = appendField(buffer, field); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buffer, nil
+}
+
+// Decode decodes the fields of a tuple. Signed integers are
+// decoded as int64, unsigned integers as uint64, floats as float64,
+// and descending fields as Descending.
+func Decode(data []byte) ([]interface{}, error) {
+	var fields []interface{}
+
+	for len(data) >= 1 {
+		isDescending := data[0] >= 0x80
+		var field interface{}
+		var n int
+		var err error
+
+		if isDescending {
+			field, n, err = decodeField(data, 0xFF)
+			field = Descending{field}
+		} else {
+			field, n, err = decodeField(data, 0)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+		data = data[n:]
+	}
+
+	return fields, nil
+}
+
+// Compare compares two encoded tuples, which can be either
+// strings or byte slices, and can be used as the key comparer of
+// B+ trees.
+func Compare(key1, key2 interface{}) int64 {
+	switch key1 := key1.(type) {
+	case string:
+		switch key2 := key2.(type) {
+		case string:
+			return int64(strings.Compare(key1, key2))
+		case []byte:
+			return int64(strings.Compare(key1, string(key2)))
+		}
+	case []byte:
+		switch key2 := key2.(type) {
+		case string:
+			return int64(bytes.Compare(key1, []byte(key2)))
+		case []byte:
+			return int64(bytes.Compare(key1, key2))
+		}
+	}
+
+	panic(fmt.Errorf("keyenc: invalid keys: %T, %T", key1, key2))
+}
+
+func appendField(buffer []byte, field interface{}) ([]byte, error) {
+	switch field := field.(type) {
+	case nil:
+		return append(buffer, tagNil), nil
+	case bool:
+		if field {
+			return append(buffer, tagTrue), nil
+		}
+
+		return append(buffer, tagFalse), nil
+	case int:
+		return appendInt(buffer, int64(field)), nil
+	case int8:
+		return appendInt(buffer, int64(field)), nil
+	case int16:
+		return appendInt(buffer, int64(field)), nil
+	case int32:
+		return appendInt(buffer, int64(field)), nil
+	case int64:
+		return appendInt(buffer, field), nil
+	case uint:
+		return appendUint(buffer, tagUint, uint64(field)), nil
+	case uint8:
+		return appendUint(buffer, tagUint, uint64(field)), nil
+	case uint16:
+		return appendUint(buffer, tagUint, uint64(field)), nil
+	case uint32:
+		return appendUint(buffer, tagUint, uint64(field)), nil
+	case uint64:
+		return appendUint(buffer, tagUint, field), nil
+	case float32:
+		return appendFloat(buffer, float64(field))
+	case float64:
+		return appendFloat(buffer, field)
+	case string:
+		return appendString(append(buffer, tagStr), field), nil
+	case []byte:
+		return appendString(append(buffer, tagBytes), string(field)), nil
+	case Descending:
+		return nil, errors.New("keyenc: nested descending field")
+	default:
+		return nil, fmt.Errorf("keyenc: unsupported field type: %T", field)
+	}
+}
+
+// appendInt flips the sign bit so that negative integers are
+// ordered before non-negative ones.
+func appendInt(buffer []byte, i int64) []byte {
+	return appendUint(buffer, tagInt, uint64(i)^(1<<63))
+}
+
+func appendUint(buffer []byte, tag byte, u uint64) []byte {
+	var data [9]byte
+	data[0] = tag
+	binary.BigEndian.PutUint64(data[1:], u)
+	return append(buffer, data[:]...)
+}
+
+// appendFloat flips the sign bit of non-negative floats, and all
+// the bits of negative floats, so that the bits of floats are
+// ordered as unsigned integers.
+func appendFloat(buffer []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) {
+		return nil, errors.New("keyenc: NaN field")
+	}
+
+	if f == 0 {
+		f = 0 // -0 => +0
+	}
+
+	u := math.Float64bits(f)
+
+	if u&(1<<63) == 0 {
+		u ^= 1 << 63
+	} else {
+		u = ^u
+	}
+
+	return appendUint(buffer, tagFloat, u), nil
+}
+
+// appendString escapes 0x00 as 0x00 0xFF and terminates the string
+// with 0x00 0x01, so that a string is ordered before any longer
+// string it is a prefix of.
+func appendString(buffer []byte, s string) []byte {
+	for {
+		i := strings.IndexByte(s, 0)
+
+		if i < 0 {
+			break
+		}
+
+		buffer = append(append(buffer, s[:i]...), 0x00, 0xFF)
+		s = s[i+1:]
+	}
+
+	return append(append(buffer, s...), 0x00, 0x01)
+}
+
+func decodeField(data []byte, mask byte) (interface{}, int, error) {
+	switch tag := data[0] ^ mask; tag {
+	case tagNil:
+		return nil, 1, nil
+	case tagFalse:
+		return false, 1, nil
+	case tagTrue:
+		return true, 1, nil
+	case tagInt, tagUint, tagFloat:
+		if len(data) < 9 {
+			return nil, 0, errors.New("keyenc: truncated data")
+		}
+
+		var buffer [8]byte
+
+		for i := range buffer {
+			buffer[i] = data[1+i] ^ mask
+		}
+
+		u := binary.BigEndian.Uint64(buffer[:])
+
+		switch tag {
+		case tagInt:
+			return int64(u ^ (1 << 63)), 9, nil
+		case tagUint:
+			return u, 9, nil
+		default:
+			if u&(1<<63) == 0 {
+				u = ^u
+			} else {
+				u ^= 1 << 63
+			}
+
+			return math.Float64frombits(u), 9, nil
+		}
+	case tagStr, tagBytes:
+		buffer, n, err := decodeString(data[1:], mask)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if tag == tagStr {
+			return string(buffer), 1 + n, nil
+		}
+
+		return buffer, 1 + n, nil
+	default:
+		return nil, 0, fmt.Errorf("keyenc: invalid tag: %#x", data[0])
+	}
+}
+
+func decodeString(data []byte, mask byte) ([]byte, int, error) {
+	buffer := []byte{}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i] ^ mask
+
+		if c != 0x00 {
+			buffer = append(buffer, c)
+			continue
+		}
+
+		if i+1 == len(data) {
+			break
+		}
+
+		switch data[i+1] ^ mask {
+		case 0xFF:
+			buffer = append(buffer, 0x00)
+			i++
+		case 0x01:
+			return buffer, i + 2, nil
+		default:
+			return nil, 0, errors.New("keyenc: invalid escape sequence")
+		}
+	}
+
+	return nil, 0, errors.New("keyenc: unterminated string")
+}
+
+func invertBytes(data []byte) {
+	for i := range data {
+		data[i] = ^data[i]
+	}
+}
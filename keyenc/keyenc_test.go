@@ -0,0 +1,169 @@
+package keyenc_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/roy2220/bptree/keyenc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeOrder(t *testing.T) {
+	// tuples in ascending order
+	tuples := [][]interface{}{
+		{},
+		{nil},
+		{false},
+		{true},
+		{math.MinInt64},
+		{-1},
+		{int8(0)},
+		{0, "a"},
+		{1},
+		{math.MaxInt64},
+		{uint(0)},
+		{uint64(math.MaxUint64)},
+		{math.Inf(-1)},
+		{-1.5},
+		{-math.SmallestNonzeroFloat64},
+		{0.0},
+		{float32(0.5)},
+		{math.Inf(1)},
+		{""},
+		{"", ""},
+		{"\x00"},
+		{"\x00\x00"},
+		{"\x00\x01"},
+		{"a"},
+		{"a", 1},
+		{"a", keyenc.Desc(2)},
+		{"a", keyenc.Desc(1)},
+		{"a", keyenc.Desc(-1)},
+		{"a\x00"},
+		{"a\x00b"},
+		{"ab"},
+		{"ab", keyenc.Desc("b")},
+		{"ab", keyenc.Desc("a\x00")},
+		{"ab", keyenc.Desc("a")},
+		{"ab", keyenc.Desc("")},
+		{[]byte{}},
+		{[]byte{0xFF}},
+	}
+
+	encodedTuples := make([][]byte, len(tuples))
+
+	for i, tuple := range tuples {
+		encodedTuple, err := keyenc.Encode(tuple...)
+
+		if !assert.NoError(t, err, "%v", tuple) {
+			return
+		}
+
+		encodedTuples[i] = encodedTuple
+	}
+
+	for i := 1; i < len(encodedTuples); i++ {
+		assert.Equal(t, -1, bytes.Compare(encodedTuples[i-1], encodedTuples[i]), "%v < %v", tuples[i-1], tuples[i])
+	}
+
+	a, _ := keyenc.Encode(-0.0)
+	b, _ := keyenc.Encode(math.Copysign(0, -1))
+	assert.Equal(t, a, b)
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		Fields         []interface{}
+		ExpectedFields []interface{}
+	}{
+		{
+			[]interface{}{nil, true, false, -7, int8(-8), uint16(9), float32(1.5), -2.25, "a\x00b", []byte{0, 0xFF}},
+			[]interface{}{nil, true, false, int64(-7), int64(-8), uint64(9), 1.5, -2.25, "a\x00b", []byte{0, 0xFF}},
+		},
+		{
+			[]interface{}{keyenc.Desc("x\x00"), keyenc.Desc(3), 4, keyenc.Desc(math.Inf(-1)), keyenc.Desc(nil), keyenc.Desc([]byte{})},
+			[]interface{}{keyenc.Desc("x\x00"), keyenc.Desc(int64(3)), int64(4), keyenc.Desc(math.Inf(-1)), keyenc.Desc(nil), keyenc.Desc([]byte{})},
+		},
+	} {
+		data, err := keyenc.Encode(tc.Fields...)
+
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		fields, err := keyenc.Decode(data)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.ExpectedFields, fields)
+		}
+	}
+
+	for _, data := range [][]byte{{0x7F}, {0x10, 0}, {0x20, 'a'}, {0x20, 0, 0x02}, {0xDF, 0xFF}} {
+		_, err := keyenc.Decode(data)
+		assert.Error(t, err, "%v", data)
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	for _, field := range []interface{}{math.NaN(), struct{}{}, keyenc.Desc(keyenc.Desc(1))} {
+		_, err := keyenc.Encode(field)
+		assert.Error(t, err, "%v", field)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	bpt := new(bptree.BPTree).Init(5, keyenc.Compare)
+	type tuple struct {
+		Tenant    string
+		Timestamp int64
+		ID        uint32
+	}
+
+	tuples := make([]tuple, 1000)
+
+	for i := range tuples {
+		tuples[i] = tuple{string(rune('a' + rand.Intn(3))), rand.Int63n(100) - 50, rand.Uint32()}
+		key, err := keyenc.Encode(tuples[i].Tenant, keyenc.Desc(tuples[i].Timestamp), tuples[i].ID)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		bpt.AddOrUpdateRecord(string(key), tuples[i])
+	}
+
+	minKey, _ := keyenc.Encode("b")
+	maxKey, _ := keyenc.Encode("b", keyenc.Desc(0))
+	var lastTuple *tuple
+	n := 0
+
+	for it := bpt.SearchForward(minKey, maxKey); !it.IsAtEnd(); it.Advance() {
+		_, value := it.Record()
+		tuple := value.(tuple)
+		assert.Equal(t, "b", tuple.Tenant)
+		assert.True(t, tuple.Timestamp > 0)
+
+		if lastTuple != nil {
+			assert.True(t, tuple.Timestamp < lastTuple.Timestamp || (tuple.Timestamp == lastTuple.Timestamp && tuple.ID > lastTuple.ID))
+		}
+
+		lastTuple = &tuple
+		n++
+	}
+
+	m := 0
+
+	for _, tuple := range tuples {
+		if tuple.Tenant == "b" && tuple.Timestamp > 0 {
+			m++
+		}
+	}
+
+	assert.Equal(t, m, n)
+	assert.Equal(t, int64(0), keyenc.Compare("ab", []byte("ab")))
+	assert.Equal(t, int64(1), keyenc.Compare([]byte("b"), "ab"))
+	assert.Panics(t, func() { keyenc.Compare(1, "a") })
+}
@@ -0,0 +1,230 @@
+package bptree
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// KeyKind represents the kind of keys of a B+ tree, which decides
+// how keys are stored in nodes.
+type KeyKind int
+
+const (
+	// GenericKeys is the kind of keys of any type, which are
+	// ordered by a key comparer.
+	// Keys of other kinds are stored unboxed in nodes and searched
+	// without key comparers.
+	GenericKeys = KeyKind(iota)
+
+	// BytesKeys is the kind of []byte keys, which are ordered by
+	// bytes.Compare. The common prefix of keys in a node is stored
+	// once and separator keys are truncated to the shortest ones,
+	// which saves memory for keys sharing long prefixes.
+	// Keys returned are copies.
+	BytesKeys
+
+	// Int64Keys is the kind of int64 keys.
+	Int64Keys
+
+	// Uint64Keys is the kind of uint64 keys.
+	Uint64Keys
+
+	// Float64Keys is the kind of float64 keys, which must not be
+	// NaN.
+	Float64Keys
+
+	// StringKeys is the kind of string keys, which are ordered by
+	// strings.Compare. Separator keys are truncated to the shortest
+	// ones.
+	StringKeys
+)
+
+func (kk KeyKind) String() string {
+	switch kk {
+	case GenericKeys:
+		return "GenericKeys"
+	case BytesKeys:
+		return "BytesKeys"
+	case Int64Keys:
+		return "Int64Keys"
+	case Uint64Keys:
+		return "Uint64Keys"
+	case Float64Keys:
+		return "Float64Keys"
+	case StringKeys:
+		return "StringKeys"
+	default:
+		return fmt.Sprintf("KeyKind(%d)", int(kk))
+	}
+}
+
+// keys represents the keys in a node.
+type keys interface {
+	// Len returns the number of keys.
+	Len() int
+
+	// Get returns the key at the given index.
+	Get(i int) interface{}
+
+	// Set replaces the key at the given index with the given one.
+	Set(i int, key interface{})
+
+	// SetFrom replaces the key at the given index with the key
+	// at the given index of the other keys of the same kind.
+	SetFrom(i int, other keys, j int)
+
+	// Locate returns the index of the first key which is not
+	// less than the given key, or the number of keys if there is
+	// no such key, and whether the key found is equal to the given
+	// key.
+	Locate(key interface{}, keyComparer KeyComparer) (int, bool)
+
+	// Insert inserts the given key at the given index.
+	Insert(i int, key interface{})
+
+	// InsertFrom inserts the key at the given index of the other
+	// keys of the same kind at the given index.
+	InsertFrom(i int, other keys, j int)
+
+	// Remove removes the key at the given index.
+	Remove(i int)
+
+	// RemoveRange removes the keys in the given range [i, j).
+	RemoveRange(i, j int)
+
+	// AppendFrom appends the keys in the given range [i, j) of the
+	// other keys of the same kind.
+	AppendFrom(other keys, i, j int)
+
+	// Truncate removes the keys from the given index.
+	Truncate(i int)
+
+	// Separator returns the shortest key which is greater than
+	// the last key of the given keys of the same kind, and not
+	// greater than the first key.
+	Separator(prev keys) interface{}
+
+	// MemoryUsage returns the estimated number of bytes used by
+	// the keys, excluding the memory referenced by generic keys.
+	MemoryUsage() int64
+}
+
+// newKeys returns empty keys of the given kind with room for the
+// given number of keys.
+func newKeys(keyKind KeyKind, capacity int) keys {
+	switch keyKind {
+	case BytesKeys:
+		return &bytesKeys{ends: make([]int32, 0, capacity)}
+	case Int64Keys:
+		k := make(int64Keys, 0, capacity)
+		return &k
+	case Uint64Keys:
+		k := make(uint64Keys, 0, capacity)
+		return &k
+	case Float64Keys:
+		k := make(float64Keys, 0, capacity)
+		return &k
+	case StringKeys:
+		k := make(stringKeys, 0, capacity)
+		return &k
+	default:
+		k := make(genericKeys, 0, capacity)
+		return &k
+	}
+}
+
+// checkKey panics if the given key cannot be inserted into keys of
+// the given kind, just as the insertion would.
+func checkKey(keyKind KeyKind, key interface{}) {
+	switch keyKind {
+	case BytesKeys:
+		_ = key.([]byte)
+	case Int64Keys:
+		_ = key.(int64)
+	case Uint64Keys:
+		_ = key.(uint64)
+	case Float64Keys:
+		checkFloat64Key(key.(float64))
+	case StringKeys:
+		_ = key.(string)
+	}
+}
+
+type genericKeys []interface{}
+
+func (gk *genericKeys) Len() int {
+	return len(*gk)
+}
+
+func (gk *genericKeys) Get(i int) interface{} {
+	return (*gk)[i]
+}
+
+func (gk *genericKeys) Set(i int, key interface{}) {
+	(*gk)[i] = key
+}
+
+func (gk *genericKeys) SetFrom(i int, other keys, j int) {
+	(*gk)[i] = (*other.(*genericKeys))[j]
+}
+
+func (gk *genericKeys) Locate(key interface{}, keyComparer KeyComparer) (int, bool) {
+	i, j := 0, len(*gk)
+
+	for i < j {
+		k := (i + j) / 2
+		// i <= k < j
+
+		if keyComparer((*gk)[k], key) < 0 {
+			i = k + 1
+			// i <= j
+		} else {
+			j = k
+			// j >= i
+		}
+	}
+	// i == j
+
+	return i, i < len(*gk) && keyComparer((*gk)[i], key) == 0
+}
+
+func (gk *genericKeys) Insert(i int, key interface{}) {
+	*gk = append(*gk, nil)
+	copy((*gk)[i+1:], (*gk)[i:])
+	(*gk)[i] = key
+}
+
+func (gk *genericKeys) InsertFrom(i int, other keys, j int) {
+	gk.Insert(i, (*other.(*genericKeys))[j])
+}
+
+func (gk *genericKeys) Remove(i int) {
+	copy((*gk)[i:], (*gk)[i+1:])
+	(*gk)[len(*gk)-1] = nil
+	*gk = (*gk)[:len(*gk)-1]
+}
+
+func (gk *genericKeys) RemoveRange(i, j int) {
+	copy((*gk)[i:], (*gk)[j:])
+	gk.Truncate(len(*gk) - (j - i))
+}
+
+func (gk *genericKeys) AppendFrom(other keys, i, j int) {
+	*gk = append(*gk, (*other.(*genericKeys))[i:j]...)
+}
+
+func (gk *genericKeys) Truncate(i int) {
+	for k := len(*gk) - 1; k >= i; k-- {
+		(*gk)[k] = nil
+	}
+
+	*gk = (*gk)[:i]
+}
+
+func (gk *genericKeys) Separator(keys) interface{} {
+	return (*gk)[0]
+}
+
+func (gk *genericKeys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*gk)) + int64(cap(*gk))*int64(unsafe.Sizeof(interface{}(nil)))
+}
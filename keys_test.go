@@ -0,0 +1,298 @@
+package bptree_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"unsafe"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeBytesKeys(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(5, bptree.BytesKeys, nil)
+	assert.Equal(t, bptree.BytesKeys, bpt.KeyKind())
+	deletedKeywordIndexes := make(map[int]struct{}, len(Keywords)/2)
+
+	for i, k := range Keywords {
+		_, ok := bpt.AddRecord([]byte(k), i)
+
+		if !assert.True(t, ok, "%v %v", i, k) {
+			t.FailNow()
+		}
+
+		if j := rand.Intn(i*2 + 1); j <= i {
+			if _, ok := deletedKeywordIndexes[j]; !ok {
+				_, ok2 := bpt.DeleteRecord([]byte(Keywords[j]))
+
+				if !assert.True(t, ok2, "%v %v", j, Keywords[j]) {
+					t.FailNow()
+				}
+
+				deletedKeywordIndexes[j] = struct{}{}
+			}
+		}
+	}
+
+	for j := range deletedKeywordIndexes {
+		_, ok := bpt.AddRecord([]byte(Keywords[j]), j)
+
+		if !assert.True(t, ok, "%v %v", j, Keywords[j]) {
+			t.FailNow()
+		}
+	}
+
+	if !assert.NoError(t, bpt.Check()) {
+		t.FailNow()
+	}
+
+	i := 0
+
+	for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+		j := SortedKeywordIndexes[i]
+		k, v := it.Record()
+		assert.Equal(t, []byte(Keywords[j]), k)
+		assert.Equal(t, j, v)
+		i++
+	}
+
+	assert.Equal(t, len(Keywords), i)
+
+	for i, k := range Keywords {
+		j, ok := bpt.HasRecord([]byte(k))
+
+		if assert.True(t, ok, "%v %v", i, k) {
+			assert.Equal(t, i, j)
+		}
+	}
+
+	bpt2 := new(bptree.BPTree).InitWithKeyKind(32, bptree.BytesKeys, nil)
+	bpt3 := new(bptree.BPTree).Init(32, func(key1, key2 interface{}) int64 {
+		return int64(bytes.Compare(key1.([]byte), key2.([]byte)))
+	})
+
+	keysSize := int64(0)
+
+	for _, k := range Keywords {
+		bpt2.AddRecord([]byte(k), nil)
+		bpt3.AddRecord([]byte(k), nil)
+		keysSize += int64(unsafe.Sizeof([]byte(nil))) + int64(len(k))
+	}
+
+	memoryUsage2 := bpt2.Stats().EstimatedMemoryUsage
+	memoryUsage3 := bpt3.Stats().EstimatedMemoryUsage + keysSize
+	t.Logf("estimated memory usage: %d (bytes keys), %d (generic keys)", memoryUsage2, memoryUsage3)
+	assert.True(t, memoryUsage2 < memoryUsage3)
+
+	for i, k := range Keywords {
+		j, ok := bpt.DeleteRecord([]byte(k))
+
+		if assert.True(t, ok, "%v %v", i, k) {
+			assert.Equal(t, i, j)
+		}
+	}
+
+	assert.True(t, bpt.IsEmpty())
+	assert.NoError(t, bpt.Check())
+}
+
+func TestBPTreeBytesKeysRandomly(t *testing.T) {
+	prefixes := []string{"", "a", "ab", "abc", "abd", "b\x00", "b\x00\x00"}
+
+	for n := 0; n < 20; n++ {
+		bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.BytesKeys, nil)
+		keys := map[string]int{}
+
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("%s%d", prefixes[rand.Intn(len(prefixes))], rand.Intn(100))
+			key = key[:rand.Intn(len(key))+1]
+
+			if rand.Intn(3) == 0 {
+				_, ok := keys[key]
+				_, ok2 := bpt.DeleteRecord([]byte(key))
+
+				if !assert.Equal(t, ok, ok2, "%q", key) {
+					t.FailNow()
+				}
+
+				delete(keys, key)
+			} else {
+				_, ok := keys[key]
+				_, ok2 := bpt.AddOrUpdateRecord([]byte(key), i)
+
+				if !assert.Equal(t, !ok, ok2, "%q", key) {
+					t.FailNow()
+				}
+
+				keys[key] = i
+			}
+
+			if !assert.NoError(t, bpt.Check()) {
+				t.FailNow()
+			}
+		}
+
+		sortedKeys := make([]string, 0, len(keys))
+
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+
+		sort.Strings(sortedKeys)
+		i := len(sortedKeys) - 1
+
+		for it := bpt.SearchBackward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+			k, v := it.Record()
+
+			if assert.True(t, bytes.Equal([]byte(sortedKeys[i]), k.([]byte)), "%q %q", sortedKeys[i], k) {
+				assert.Equal(t, keys[sortedKeys[i]], v)
+			}
+
+			i--
+		}
+
+		assert.Equal(t, -1, i)
+	}
+}
+
+func BenchmarkBPTreeHasRecordGenericKeys(b *testing.B) {
+	bpt := new(bptree.BPTree).Init(32, func(key1, key2 interface{}) int64 {
+		return int64(bytes.Compare(key1.([]byte), key2.([]byte)))
+	})
+
+	benchmarkBPTreeHasRecord(b, bpt)
+}
+
+func BenchmarkBPTreeHasRecordBytesKeys(b *testing.B) {
+	benchmarkBPTreeHasRecord(b, new(bptree.BPTree).InitWithKeyKind(32, bptree.BytesKeys, nil))
+}
+
+func benchmarkBPTreeHasRecord(b *testing.B, bpt *bptree.BPTree) {
+	keys := make([]interface{}, len(Keywords))
+
+	for i, k := range Keywords {
+		keys[i] = []byte(k)
+		bpt.AddRecord(keys[i], i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.HasRecord(keys[i%len(keys)])
+	}
+}
+
+func TestBPTreeKeyKinds(t *testing.T) {
+	for _, tc := range []struct {
+		KeyKind bptree.KeyKind
+		MakeKey func(x int) interface{}
+	}{
+		{bptree.Int64Keys, func(x int) interface{} { return int64(x - 500) }},
+		{bptree.Uint64Keys, func(x int) interface{} { return uint64(x) << 54 }},
+		{bptree.Float64Keys, func(x int) interface{} { return float64(x-500) / 7 }},
+		{bptree.StringKeys, func(x int) interface{} { return fmt.Sprintf("%x", x*x) }},
+		{bptree.BytesKeys, func(x int) interface{} { return []byte(fmt.Sprintf("%x", x*x)) }},
+	} {
+		bpt := new(bptree.BPTree).InitWithKeyKind(4, tc.KeyKind, nil)
+		keyComparer := bpt.KeyComparer()
+		values := map[int]int{}
+
+		for i := 0; i < 3000; i++ {
+			x := rand.Intn(1000)
+
+			if rand.Intn(3) == 0 {
+				_, ok := values[x]
+				_, ok2 := bpt.DeleteRecord(tc.MakeKey(x))
+
+				if !assert.Equal(t, ok, ok2, "%v %v", tc.KeyKind, x) {
+					t.FailNow()
+				}
+
+				delete(values, x)
+			} else {
+				_, ok := values[x]
+				_, ok2 := bpt.AddOrUpdateRecord(tc.MakeKey(x), i)
+
+				if !assert.Equal(t, !ok, ok2, "%v %v", tc.KeyKind, x) {
+					t.FailNow()
+				}
+
+				values[x] = i
+			}
+		}
+
+		if !assert.NoError(t, bpt.Check(), "%v", tc.KeyKind) {
+			continue
+		}
+
+		keys := make([]interface{}, 0, len(values))
+
+		for x := range values {
+			keys = append(keys, tc.MakeKey(x))
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return keyComparer(keys[i], keys[j]) < 0
+		})
+
+		i := 0
+
+		for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+			k, _ := it.Record()
+			assert.Equal(t, keys[i], k, "%v", tc.KeyKind)
+			i++
+		}
+
+		assert.Equal(t, len(keys), i, "%v", tc.KeyKind)
+
+		for x, v := range values {
+			v2, ok := bpt.HasRecord(tc.MakeKey(x))
+
+			if assert.True(t, ok, "%v %v", tc.KeyKind, x) {
+				assert.Equal(t, v, v2)
+			}
+		}
+	}
+
+	assert.Panics(t, func() {
+		new(bptree.BPTree).InitWithKeyKind(4, bptree.Float64Keys, nil).AddRecord(math.NaN(), nil)
+	})
+}
+
+func BenchmarkBPTreeHasRecordInt64Keys(b *testing.B) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(32, bptree.Int64Keys, nil)
+	keys := make([]interface{}, 100000)
+
+	for i := range keys {
+		keys[i] = int64(i)
+		bpt.AddRecord(keys[i], i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.HasRecord(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBPTreeHasRecordStringKeys(b *testing.B) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(32, bptree.StringKeys, nil)
+	keys := make([]interface{}, len(Keywords))
+
+	for i, k := range Keywords {
+		keys[i] = k
+		bpt.AddRecord(k, i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.HasRecord(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,194 @@
+package bptree_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeFloorAndCeiling(t *testing.T) {
+	bpt := MakeSmallBPTree()
+	bpt.DeleteRecord(6)
+
+	for _, tc := range []struct {
+		Key                            interface{}
+		ExpectedFloor, ExpectedCeiling interface{}
+	}{
+		{0, nil, 1},
+		{1, 1, 1},
+		{6, 5, 7},
+		{10, 10, 10},
+		{11, 10, nil},
+		{bptree.KeyMin, 1, 1},
+		{bptree.KeyMax, 10, 10},
+	} {
+		key, _, ok := bpt.Floor(tc.Key)
+
+		if tc.ExpectedFloor == nil {
+			assert.False(t, ok, "%v", tc.Key)
+		} else if assert.True(t, ok, "%v", tc.Key) {
+			assert.Equal(t, tc.ExpectedFloor, key)
+		}
+
+		key, _, ok = bpt.Ceiling(tc.Key)
+
+		if tc.ExpectedCeiling == nil {
+			assert.False(t, ok, "%v", tc.Key)
+		} else if assert.True(t, ok, "%v", tc.Key) {
+			assert.Equal(t, tc.ExpectedCeiling, key)
+		}
+	}
+
+	bpt = new(bptree.BPTree).Init(4, nil)
+	_, _, ok := bpt.Floor(bptree.KeyMax)
+	assert.False(t, ok)
+	_, _, ok = bpt.Ceiling(bptree.KeyMin)
+	assert.False(t, ok)
+}
+
+func TestBPTreeFloorAndCeilingWithBytesKeys(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.BytesKeys, nil)
+	keys := append([]string(nil), Keywords[:1000]...)
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		bpt.AddRecord([]byte(k), nil)
+	}
+
+	for i, k := range keys {
+		// a key between the previous key and the current key, which may
+		// be less than the first key of a leaf but not less than the
+		// truncated separator key.
+		key := k[:len(k)-1]
+
+		if i >= 1 && key > keys[i-1] {
+			k2, _, ok := bpt.Floor([]byte(key))
+
+			if assert.True(t, ok) {
+				assert.Equal(t, []byte(keys[i-1]), k2)
+			}
+
+			k2, _, ok = bpt.Ceiling([]byte(key))
+
+			if assert.True(t, ok) {
+				assert.Equal(t, []byte(k), k2)
+			}
+
+			it := bpt.SearchForward(bptree.KeyMin, []byte(key))
+			n := 0
+
+			for ; !it.IsAtEnd(); it.Advance() {
+				n++
+			}
+
+			assert.Equal(t, i, n)
+		}
+	}
+}
+
+func TestBPTreeLookupAllocs(t *testing.T) {
+	intBPT := new(bptree.BPTree).Init(32, func(key1, key2 interface{}) int64 {
+		return int64(key1.(int) - key2.(int))
+	})
+
+	intKeys := make([]interface{}, 10000)
+
+	for i := range intKeys {
+		intKeys[i] = i * 2
+		intBPT.AddRecord(intKeys[i], i)
+	}
+
+	stringBPT, stringKeys := MakeStringBPTree(32)
+
+	for _, tc := range []struct {
+		BPT  *bptree.BPTree
+		Keys []interface{}
+	}{
+		{intBPT, intKeys},
+		{stringBPT, stringKeys},
+	} {
+		i := 0
+		value := interface{}(nil)
+		assert.Equal(t, 0.0, testing.AllocsPerRun(1000, func() {
+			tc.BPT.HasRecord(tc.Keys[i%len(tc.Keys)])
+			tc.BPT.Floor(tc.Keys[i%len(tc.Keys)])
+			tc.BPT.Ceiling(tc.Keys[i%len(tc.Keys)])
+			tc.BPT.UpdateRecord(tc.Keys[i%len(tc.Keys)], value)
+			i++
+		}))
+
+		// only the iterator is allocated
+		assert.Equal(t, 1.0, testing.AllocsPerRun(1000, func() {
+			tc.BPT.SearchForward(tc.Keys[i%len(tc.Keys)], bptree.KeyMax)
+			i++
+		}))
+	}
+}
+
+func BenchmarkBPTreeHasRecordInt(b *testing.B) {
+	bpt := new(bptree.BPTree).Init(32, func(key1, key2 interface{}) int64 {
+		return int64(key1.(int) - key2.(int))
+	})
+
+	keys := make([]interface{}, 100000)
+
+	for i := range keys {
+		keys[i] = i
+		bpt.AddRecord(keys[i], i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.HasRecord(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBPTreeHasRecordString(b *testing.B) {
+	bpt, keys := MakeStringBPTree(32)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.HasRecord(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBPTreeFloorString(b *testing.B) {
+	bpt, keys := MakeStringBPTree(32)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.Floor(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBPTreeSearchForwardString(b *testing.B) {
+	bpt, keys := MakeStringBPTree(32)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bpt.SearchForward(keys[i%len(keys)], bptree.KeyMax)
+	}
+}
+
+func MakeStringBPTree(maxDegree int) (*bptree.BPTree, []interface{}) {
+	bpt := new(bptree.BPTree).Init(maxDegree, func(key1, key2 interface{}) int64 {
+		return int64(strings.Compare(key1.(string), key2.(string)))
+	})
+
+	keys := make([]interface{}, len(Keywords))
+
+	for i, k := range Keywords {
+		keys[i] = k
+		bpt.AddRecord(k, i)
+	}
+
+	return bpt, keys
+}
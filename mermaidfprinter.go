@@ -0,0 +1,96 @@
+package bptree
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FprintMermaid dumps the B+ tree as a Mermaid flowchart.
+// Nodes are named after their paths from the root in the same
+// way as FprintDOT does.
+func (bpt *BPTree) FprintMermaid(writer io.Writer) error {
+	bpt.lazyInit()
+
+	mermaidFprinter := mermaidFprinter{
+		Writer:   writer,
+		NodeName: "n",
+	}
+
+	if _, err := io.WriteString(writer, "flowchart TD\n"); err != nil {
+		return err
+	}
+
+	if bpt.IsEmpty() {
+		return nil
+	}
+
+	return bpt.Walk(mermaidFprinter.Fprint)
+}
+
+type mermaidFprinter struct {
+	Writer       io.Writer
+	NodeName     string
+	PrevLeafName string
+}
+
+func (mf *mermaidFprinter) Fprint(nodeAccessor NodeAccessor) error {
+	nodeName := mf.NodeName
+	n := nodeAccessor.NumberOfKeys()
+	fields := make([]string, n)
+
+	if nodeAccessor.IsLeaf() {
+		for i := range fields {
+			fields[i] = escapeMermaidLabel(formatRecord(nodeAccessor.GetKey(i), nodeAccessor.GetValue(i)))
+		}
+	} else {
+		for i := range fields {
+			fields[i] = escapeMermaidLabel(fmt.Sprintf("%v", nodeAccessor.GetKey(i)))
+		}
+	}
+
+	if _, err := fmt.Fprintf(mf.Writer, "  %s[\"%s\"]\n", nodeName, strings.Join(fields, " | ")); err != nil {
+		return err
+	}
+
+	if nodeAccessor.IsLeaf() {
+		if mf.PrevLeafName != "" {
+			if _, err := fmt.Fprintf(mf.Writer, "  %s <-.-> %s\n", mf.PrevLeafName, nodeName); err != nil {
+				return err
+			}
+		}
+
+		mf.PrevLeafName = nodeName
+		return nil
+	}
+
+	for i := 0; i <= n; i++ {
+		childName := nodeName + "_" + strconv.Itoa(i)
+
+		if _, err := fmt.Fprintf(mf.Writer, "  %s --> %s\n", nodeName, childName); err != nil {
+			return err
+		}
+
+		mf.NodeName = childName
+
+		if err := nodeAccessor.AccessChild(mf.Fprint, i); err != nil {
+			return err
+		}
+	}
+
+	mf.NodeName = nodeName
+	return nil
+}
+
+func escapeMermaidLabel(s string) string {
+	return mermaidLabelReplacer.Replace(s)
+}
+
+var mermaidLabelReplacer = strings.NewReplacer(
+	"\"", "#quot;",
+	"#", "#35;",
+	"<", "#lt;",
+	">", "#gt;",
+	"\n", " ",
+)
@@ -0,0 +1,533 @@
+package bptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	// ErrMutationLogTruncated is returned when mutations to ship
+	// have been dropped from the mutation log, in which case the
+	// follower has to catch up another way, e.g. by Sync or Clone.
+	ErrMutationLogTruncated = errors.New("bptree: mutation log truncated")
+
+	// ErrChecksumMismatch is returned when a batch of mutations is
+	// corrupted.
+	ErrChecksumMismatch = errors.New("bptree: checksum mismatch")
+
+	// ErrSequenceGap is returned when mutations to apply do not
+	// follow the last mutation applied.
+	ErrSequenceGap = errors.New("bptree: sequence gap")
+
+	// ErrDivergence is returned when a follower turns out to differ
+	// from the leader.
+	ErrDivergence = errors.New("bptree: divergence detected")
+)
+
+// EnableMutationLog makes the B+ tree retain its most recent
+// mutations, up to the given number, for shipping to followers
+// (see ShipMutations).
+// Values are retained by reference, so they must not be modified
+// by the user once added to the B+ tree.
+func (bpt *BPTree) EnableMutationLog(maxNumberOfMutations int) {
+	bpt.lazyInit()
+
+	if maxNumberOfMutations < 1 {
+		panic(errors.New("bptree: invalid maximum number of mutations"))
+	}
+
+	bpt.mutationLog = &mutationLog{
+		maxNumberOfMutations: maxNumberOfMutations,
+	}
+}
+
+// DisableMutationLog stops retaining mutations and drops the
+// retained ones.
+func (bpt *BPTree) DisableMutationLog() {
+	bpt.mutationLog = nil
+}
+
+// SequenceNumber returns the sequence number of the last mutation
+// of the B+ tree, which is 0 if there is none. The sequence number
+// is carried over to followers by ApplyMutations, and to copies by
+// Clone.
+func (bpt *BPTree) SequenceNumber() uint64 {
+	return bpt.sequenceNumber
+}
+
+// ShipMutations writes the retained mutations from the given
+// sequence number to the given writer in batches of at most the
+// given number of mutations, with keys and values encoded by the
+// given encoder. It returns the sequence number to resume from.
+// Each batch carries a checksum. If hashing is enabled, the last
+// batch also carries a summary of records of the B+ tree, with
+// which followers with hashing enabled detect divergence.
+// The mutation log must be enabled.
+func (bpt *BPTree) ShipMutations(w io.Writer, encoder MutationEncoder, fromSequenceNumber uint64, maxBatchSize int) (uint64, error) {
+	bpt.lazyInit()
+
+	if bpt.mutationLog == nil {
+		panic(errors.New("bptree: mutation log disabled"))
+	}
+
+	if maxBatchSize < 1 {
+		panic(errors.New("bptree: invalid maximum batch size"))
+	}
+
+	if fromSequenceNumber == 0 || fromSequenceNumber > bpt.sequenceNumber+1 {
+		return fromSequenceNumber, ErrSequenceGap
+	}
+
+	mutations, ok := bpt.mutationLog.Since(fromSequenceNumber, bpt.sequenceNumber+1)
+
+	if !ok {
+		return fromSequenceNumber, ErrMutationLogTruncated
+	}
+
+	for len(mutations) >= 1 {
+		n := maxBatchSize
+
+		if n > len(mutations) {
+			n = len(mutations)
+		}
+
+		var summary *RangeSummary
+
+		if n == len(mutations) && bpt.hasher != nil {
+			s := bpt.summarizeRange(KeyRange{KeyMin, KeyMax})
+			summary = &s
+		}
+
+		if err := writeMutationBatch(w, encoder, mutations[:n], summary); err != nil {
+			return fromSequenceNumber, err
+		}
+
+		mutations = mutations[n:]
+		fromSequenceNumber += uint64(n)
+	}
+
+	return fromSequenceNumber, nil
+}
+
+// ApplyMutations reads batches of mutations shipped by a leader
+// (see ShipMutations) from the given reader until the end, and
+// applies them to the B+ tree, with keys and values decoded by the
+// given encoder. Mutations already applied are skipped, so batches
+// can be shipped again from any sequence number up to the next one
+// of the B+ tree.
+// The B+ tree must not be modified other than by ApplyMutations,
+// otherwise it diverges from the leader.
+func (bpt *BPTree) ApplyMutations(r io.Reader, encoder MutationEncoder) error {
+	bpt.lazyInit()
+	byteReader, ok := r.(io.ByteReader)
+
+	if !ok {
+		br := bufio.NewReader(r)
+		r, byteReader = br, br
+	}
+
+	for {
+		mutations, summary, err := readMutationBatch(r, byteReader, encoder)
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		for i := range mutations {
+			if err := bpt.applyMutation(&mutations[i]); err != nil {
+				return err
+			}
+		}
+
+		if summary != nil && bpt.hasher != nil {
+			s := bpt.summarizeRange(KeyRange{KeyMin, KeyMax})
+
+			if s.NumberOfRecords != summary.NumberOfRecords || !bytes.Equal(s.Hash, summary.Hash) {
+				return ErrDivergence
+			}
+		}
+	}
+}
+
+// Mutation represents a mutation of a B+ tree.
+type Mutation struct {
+	SequenceNumber uint64
+	Kind           MutationKind
+	Key            interface{}
+	Value          interface{}
+}
+
+// MutationKind is the kind of a mutation.
+type MutationKind int
+
+const (
+	// MutationAdd means a record is added.
+	MutationAdd = MutationKind(1 + iota)
+
+	// MutationUpdate means the value of a record is replaced.
+	MutationUpdate
+
+	// MutationDelete means a record is deleted.
+	MutationDelete
+
+	// MutationClear means all records are removed.
+	MutationClear
+)
+
+// String returns the name of the mutation kind.
+func (mk MutationKind) String() string {
+	switch mk {
+	case MutationAdd:
+		return "add"
+	case MutationUpdate:
+		return "update"
+	case MutationDelete:
+		return "delete"
+	case MutationClear:
+		return "clear"
+	default:
+		return "unknown"
+	}
+}
+
+// MutationEncoder encodes and decodes the keys and values of
+// mutations. Sequence numbers and kinds are encoded in batches.
+type MutationEncoder interface {
+	// EncodeMutation encodes the key and the value of the given
+	// mutation, the value of which is nil for deletions.
+	EncodeMutation(mutation *Mutation) (data []byte, err error)
+
+	// DecodeMutation decodes the given data into the key and the
+	// value of the given mutation.
+	DecodeMutation(data []byte, mutation *Mutation) (err error)
+}
+
+// GobMutationEncoder is a mutation encoder using encoding/gob.
+// Keys and values of types other than the built-in ones have to be
+// registered with gob.Register.
+type GobMutationEncoder struct{}
+
+var _ MutationEncoder = GobMutationEncoder{}
+
+// EncodeMutation implements MutationEncoder.EncodeMutation.
+func (GobMutationEncoder) EncodeMutation(mutation *Mutation) ([]byte, error) {
+	var buffer bytes.Buffer
+	record := gobRecord{mutation.Key, mutation.Value}
+
+	if err := gob.NewEncoder(&buffer).Encode(&record); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// DecodeMutation implements MutationEncoder.DecodeMutation.
+func (GobMutationEncoder) DecodeMutation(data []byte, mutation *Mutation) error {
+	var record gobRecord
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+		return err
+	}
+
+	mutation.Key, mutation.Value = record.Key, record.Value
+	return nil
+}
+
+type gobRecord struct {
+	Key   interface{}
+	Value interface{}
+}
+
+type mutationLog struct {
+	maxNumberOfMutations int
+	mutations            []Mutation
+}
+
+func (ml *mutationLog) Append(mutation Mutation) {
+	if len(ml.mutations) == 2*ml.maxNumberOfMutations {
+		n := copy(ml.mutations, ml.mutations[ml.maxNumberOfMutations:])
+
+		for i := n; i < len(ml.mutations); i++ {
+			ml.mutations[i] = Mutation{}
+		}
+
+		ml.mutations = ml.mutations[:n]
+	}
+
+	ml.mutations = append(ml.mutations, mutation)
+}
+
+// Since returns the retained mutations from the given sequence
+// number, which must not be greater than the next one. It returns
+// false if any of them has been dropped.
+func (ml *mutationLog) Since(sequenceNumber uint64, nextSequenceNumber uint64) ([]Mutation, bool) {
+	n := len(ml.mutations)
+	i := n - int(nextSequenceNumber-sequenceNumber)
+
+	if i < 0 || i < n-ml.maxNumberOfMutations {
+		return nil, false
+	}
+
+	return ml.mutations[i:], true
+}
+
+func (bpt *BPTree) logMutation(kind MutationKind, key, value interface{}) {
+	bpt.sequenceNumber++
+
+	if bpt.mutationLog != nil {
+		bpt.mutationLog.Append(Mutation{bpt.sequenceNumber, kind, key, value})
+	}
+}
+
+func (bpt *BPTree) applyMutation(mutation *Mutation) error {
+	if mutation.SequenceNumber <= bpt.sequenceNumber {
+		return nil
+	}
+
+	if mutation.SequenceNumber != bpt.sequenceNumber+1 {
+		return ErrSequenceGap
+	}
+
+	var ok bool
+
+	switch mutation.Kind {
+	case MutationAdd:
+		_, ok = bpt.AddRecord(mutation.Key, mutation.Value)
+	case MutationUpdate:
+		_, ok = bpt.UpdateRecord(mutation.Key, mutation.Value)
+	case MutationDelete:
+		_, ok = bpt.DeleteRecord(mutation.Key)
+	case MutationClear:
+		bpt.Clear()
+		ok = true
+	}
+
+	if !ok {
+		return ErrDivergence
+	}
+
+	return nil
+}
+
+// writeMutationBatch writes a batch in the format:
+//
+//	uvarint first sequence number
+//	uvarint number of mutations
+//	for each mutation:
+//	  byte kind
+//	  uvarint length, data
+//	byte 1 and summary, or byte 0
+//	uint32 CRC-32 (Castagnoli) of all the above
+//
+// where summary is uvarint number of records, uvarint length, hash.
+func writeMutationBatch(w io.Writer, encoder MutationEncoder, mutations []Mutation, summary *RangeSummary) error {
+	var buffer bytes.Buffer
+	writeUvarint(&buffer, mutations[0].SequenceNumber)
+	writeUvarint(&buffer, uint64(len(mutations)))
+
+	for i := range mutations {
+		mutation := &mutations[i]
+		data, err := encoder.EncodeMutation(mutation)
+
+		if err != nil {
+			return err
+		}
+
+		buffer.WriteByte(byte(mutation.Kind))
+		writeUvarint(&buffer, uint64(len(data)))
+		buffer.Write(data)
+	}
+
+	if summary == nil {
+		buffer.WriteByte(0)
+	} else {
+		buffer.WriteByte(1)
+		writeUvarint(&buffer, uint64(summary.NumberOfRecords))
+		writeUvarint(&buffer, uint64(len(summary.Hash)))
+		buffer.Write(summary.Hash)
+	}
+
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.Checksum(buffer.Bytes(), crc32Table))
+	buffer.Write(checksum[:])
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+func readMutationBatch(r io.Reader, byteReader io.ByteReader, encoder MutationEncoder) ([]Mutation, *RangeSummary, error) {
+	cr := checksumReader{r, byteReader, crc32.New(crc32Table)}
+	sequenceNumber, err := binary.ReadUvarint(&cr)
+
+	if err != nil {
+		// io.EOF at the start of a batch is the end.
+		return nil, nil, err
+	}
+
+	n, err := binary.ReadUvarint(&cr)
+
+	if err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+
+	var mutations []Mutation
+	var datas [][]byte // decoded once the checksum is verified.
+
+	for i := uint64(0); i < n; i++ {
+		kind, err := cr.ReadByte()
+
+		if err != nil {
+			return nil, nil, unexpectedEOF(err)
+		}
+
+		data, err := cr.ReadBytes()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		mutations = append(mutations, Mutation{
+			SequenceNumber: sequenceNumber + i,
+			Kind:           MutationKind(kind),
+		})
+
+		datas = append(datas, data)
+	}
+
+	var summary *RangeSummary
+	hasSummary, err := cr.ReadByte()
+
+	if err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+
+	if hasSummary == 1 {
+		numberOfRecords, err := binary.ReadUvarint(&cr)
+
+		if err != nil {
+			return nil, nil, unexpectedEOF(err)
+		}
+
+		hash, err := cr.ReadBytes()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		summary = &RangeSummary{hash, int(numberOfRecords)}
+	}
+
+	expectedChecksum := cr.Hash.Sum32()
+	var checksum [4]byte
+
+	if _, err := io.ReadFull(r, checksum[:]); err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+
+	if binary.BigEndian.Uint32(checksum[:]) != expectedChecksum {
+		return nil, nil, ErrChecksumMismatch
+	}
+
+	for i := range mutations {
+		mutation := &mutations[i]
+
+		if mutation.Kind < MutationAdd || mutation.Kind > MutationClear {
+			return nil, nil, fmt.Errorf("bptree: invalid mutation kind: %d", mutation.Kind)
+		}
+
+		if err := encoder.DecodeMutation(datas[i], mutation); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return mutations, summary, nil
+}
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+type checksumReader struct {
+	Reader     io.Reader
+	ByteReader io.ByteReader
+	Hash       hash.Hash32
+}
+
+func (cr *checksumReader) ReadByte() (byte, error) {
+	b, err := cr.ByteReader.ReadByte()
+
+	if err != nil {
+		return 0, err
+	}
+
+	cr.Hash.Write([]byte{b})
+	return b, nil
+}
+
+func (cr *checksumReader) ReadBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(cr)
+
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	// guard against huge lengths in corrupted batches.
+	if n > 1<<30 {
+		return nil, fmt.Errorf("bptree: invalid length in mutation batch: %d", n)
+	}
+
+	data, err := readData(cr.Reader, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cr.Hash.Write(data)
+	return data, nil
+}
+
+// readData reads data of the given length, which may be corrupted.
+func readData(r io.Reader, n uint64) ([]byte, error) {
+	if n <= maxPreallocatedDataLength {
+		data := make([]byte, n)
+
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		return data, nil
+	}
+
+	// grow the buffer as the data arrives, so that a corrupted
+	// length cannot force a huge allocation up front.
+	var buffer bytes.Buffer
+
+	if _, err := io.CopyN(&buffer, r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+const maxPreallocatedDataLength = 64 << 10
+
+func writeUvarint(buffer *bytes.Buffer, x uint64) {
+	var data [binary.MaxVarintLen64]byte
+	buffer.Write(data[:binary.PutUvarint(data[:], x)])
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
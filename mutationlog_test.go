@@ -0,0 +1,202 @@
+package bptree_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeShipMutations(t *testing.T) {
+	leader := new(bptree.BPTree).InitWithKeyKind(5, bptree.Int64Keys, nil)
+	leader.EnableHashing(nil, nil)
+	leader.EnableMutationLog(10000)
+	follower := new(bptree.BPTree).InitWithKeyKind(7, bptree.Int64Keys, nil)
+	follower.EnableHashing(nil, nil)
+
+	mutate := func(n int) {
+		for i := 0; i < n; i++ {
+			k := int64(rand.Intn(500))
+
+			switch rand.Intn(4) {
+			case 0:
+				leader.DeleteRecord(k)
+			case 1:
+				leader.UpdateRecord(k, strconv.Itoa(-i))
+			default:
+				leader.AddOrUpdateRecord(k, strconv.Itoa(i))
+			}
+		}
+	}
+
+	mutate(2000)
+	nextSequenceNumber := ShipMutationsOverPipe(t, leader, follower, follower.SequenceNumber()+1, 7)
+	assert.Equal(t, leader.SequenceNumber()+1, nextSequenceNumber)
+	assert.Equal(t, leader.SequenceNumber(), follower.SequenceNumber())
+	assert.True(t, leader.Equal(follower, nil))
+	assert.NoError(t, follower.Check())
+
+	// resume from the follower.
+	mutate(500)
+	leader.Clear()
+	mutate(500)
+	ShipMutationsOverPipe(t, leader, follower, follower.SequenceNumber()+1, 100)
+	assert.True(t, leader.Equal(follower, nil))
+
+	// shipping mutations already applied again is harmless.
+	mutate(10)
+	ShipMutationsOverPipe(t, leader, follower, follower.SequenceNumber()-100, 3)
+	assert.True(t, leader.Equal(follower, nil))
+	assert.Equal(t, leader.SequenceNumber(), follower.SequenceNumber())
+
+	var buffer bytes.Buffer
+	_, err := leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber()+2, 1)
+	assert.Equal(t, bptree.ErrSequenceGap, err)
+	_, err = leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, 0, 1)
+	assert.Equal(t, bptree.ErrSequenceGap, err)
+	nextSequenceNumber, err = leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber()+1, 1)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, leader.SequenceNumber()+1, nextSequenceNumber)
+		assert.Equal(t, 0, buffer.Len())
+	}
+
+	assert.Equal(t, "clear", bptree.MutationClear.String())
+}
+
+func TestBPTreeShipMutationsTruncated(t *testing.T) {
+	leader := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	leader.EnableMutationLog(10)
+
+	for i, k := range Keywords[:100] {
+		leader.AddRecord(k, strconv.Itoa(i))
+	}
+
+	var buffer bytes.Buffer
+	_, err := leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, 1, 10)
+	assert.Equal(t, bptree.ErrMutationLogTruncated, err)
+	_, err = leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber()-10, 10)
+	assert.Equal(t, bptree.ErrMutationLogTruncated, err)
+
+	// catch up by a copy.
+	follower := leader.Clone(nil)
+	assert.Equal(t, leader.SequenceNumber(), follower.SequenceNumber())
+
+	for i, k := range Keywords[:10] {
+		leader.UpdateRecord(k, strconv.Itoa(-i))
+	}
+
+	ShipMutationsOverPipe(t, leader, follower, follower.SequenceNumber()+1, 4)
+	assert.True(t, leader.Equal(follower, nil))
+
+	fresh := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	_, err = leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber()-5, 10)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, bptree.ErrSequenceGap, fresh.ApplyMutations(&buffer, bptree.GobMutationEncoder{}))
+	}
+
+	assert.Panics(t, func() { leader.EnableMutationLog(0) })
+	leader.DisableMutationLog()
+	assert.Panics(t, func() { leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, 1, 1) })
+}
+
+func TestBPTreeApplyMutationsCorrupted(t *testing.T) {
+	leader := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	leader.EnableMutationLog(100)
+
+	for i, k := range Keywords[:10] {
+		leader.AddRecord(k, strconv.Itoa(i))
+	}
+
+	var buffer bytes.Buffer
+	_, err := leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, 1, 100)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	data := buffer.Bytes()
+	data[len(data)-1] ^= 1
+	follower := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	assert.Equal(t, bptree.ErrChecksumMismatch, follower.ApplyMutations(bytes.NewReader(data), bptree.GobMutationEncoder{}))
+	assert.True(t, follower.IsEmpty())
+	assert.Equal(t, io.ErrUnexpectedEOF, follower.ApplyMutations(bytes.NewReader(data[:len(data)-1]), bptree.GobMutationEncoder{}))
+}
+
+func TestBPTreeApplyMutationsDivergence(t *testing.T) {
+	leader := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	leader.EnableHashing(nil, nil)
+	leader.EnableMutationLog(100)
+	follower := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	follower.EnableHashing(nil, nil)
+
+	for i := int64(0); i < 100; i++ {
+		leader.AddRecord(i, "a")
+
+		if i == 50 {
+			follower.AddRecord(i, "b")
+		} else {
+			follower.AddRecord(i, "a")
+		}
+	}
+
+	leader.AddRecord(int64(100), "a")
+	var buffer bytes.Buffer
+	_, err := leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber(), 100)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, bptree.ErrDivergence, follower.ApplyMutations(&buffer, bptree.GobMutationEncoder{}))
+	}
+
+	leader.DeleteRecord(int64(100))
+	follower.DeleteRecord(int64(50))
+	leader.DeleteRecord(int64(50))
+	buffer.Reset()
+	_, err = leader.ShipMutations(&buffer, bptree.GobMutationEncoder{}, leader.SequenceNumber(), 100)
+
+	if assert.NoError(t, err) {
+		// the record to delete is missing.
+		assert.Equal(t, bptree.ErrDivergence, follower.ApplyMutations(&buffer, bptree.GobMutationEncoder{}))
+	}
+}
+
+func TestBPTreeApplyMutationsHugeLength(t *testing.T) {
+	// a batch of one mutation claiming 1 GiB of data which is missing.
+	data := []byte{1, 1, byte(bptree.MutationAdd)}
+	var length [binary.MaxVarintLen64]byte
+	data = append(data, length[:binary.PutUvarint(length[:], 1<<30)]...)
+	var memStats1, memStats2 runtime.MemStats
+	runtime.ReadMemStats(&memStats1)
+	follower := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	assert.Equal(t, io.ErrUnexpectedEOF, follower.ApplyMutations(bytes.NewReader(data), bptree.GobMutationEncoder{}))
+	runtime.ReadMemStats(&memStats2)
+	assert.True(t, memStats2.TotalAlloc-memStats1.TotalAlloc < 1<<20, "%v", memStats2.TotalAlloc-memStats1.TotalAlloc)
+}
+
+func ShipMutationsOverPipe(t *testing.T, leader, follower *bptree.BPTree, fromSequenceNumber uint64, maxBatchSize int) uint64 {
+	pr, pw := io.Pipe()
+	var nextSequenceNumber uint64
+	var err error
+
+	go func() {
+		nextSequenceNumber, err = leader.ShipMutations(pw, bptree.GobMutationEncoder{}, fromSequenceNumber, maxBatchSize)
+		pw.CloseWithError(err)
+	}()
+
+	if !assert.NoError(t, follower.ApplyMutations(pr, bptree.GobMutationEncoder{})) {
+		t.FailNow()
+	}
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return nextSequenceNumber
+}
@@ -0,0 +1,226 @@
+package bptree
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultMaxDegree is the maximum degree of B+ trees created by New
+// without WithMaxDegree or WithCapacities, and of zero-value B+
+// trees.
+const DefaultMaxDegree = 32
+
+// New returns a new B+ tree with the given options, which by
+// default has the maximum degree DefaultMaxDegree and generic keys
+// compared by the default key comparer (see Options.KeyComparer).
+// Unlike the Init methods, it returns an error for invalid options
+// rather than panics.
+// The hooks which can be set are the comparer error handler (see
+// WithComparerCheck) and the trace writer (see WithTrace). The
+// statistics need no options, the counters of structural changes
+// are always kept (see Counters) and the rest is collected on
+// demand (see Stats).
+func New(opts ...Option) (*BPTree, error) {
+	c := newConfig{
+		Options: Options{
+			LeafCapacity:    DefaultMaxDegree,
+			NonLeafCapacity: DefaultMaxDegree,
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Options.normalize(); err != nil {
+		return nil, err
+	}
+
+	if c.EnableHashing && c.KeyEncoder == nil && c.Options.KeyKind == GenericKeys {
+		return nil, errors.New("bptree: key encoder required")
+	}
+
+	bpt := new(BPTree).InitWithOptions(c.Options)
+
+	if c.EnableHashing {
+		bpt.EnableHashing(c.KeyEncoder, c.ValueEncoder)
+	}
+
+	if c.MaxNumberOfMutations >= 1 {
+		bpt.EnableMutationLog(c.MaxNumberOfMutations)
+	}
+
+	if c.EnableNodePooling {
+		bpt.EnableNodePooling(c.MaxNumberOfFreeNodes)
+	}
+
+	if c.TraceWriter != nil {
+		if err := bpt.StartTrace(c.TraceWriter, c.TraceEncoder); err != nil {
+			return nil, err
+		}
+	}
+
+	return bpt, nil
+}
+
+// Option represents an option of New.
+type Option func(c *newConfig) error
+
+// WithMaxDegree sets both the leaf capacity and the non-leaf
+// capacity to the given maximum degree, which is at least 4.
+func WithMaxDegree(maxDegree int) Option {
+	return func(c *newConfig) error {
+		if maxDegree < 4 {
+			return errors.New("bptree: invalid maximum degree")
+		}
+
+		c.Options.LeafCapacity = maxDegree
+		c.Options.NonLeafCapacity = maxDegree
+		return nil
+	}
+}
+
+// WithCapacities sets the leaf capacity and the non-leaf capacity
+// (see Options).
+func WithCapacities(leafCapacity, nonLeafCapacity int) Option {
+	return func(c *newConfig) error {
+		c.Options.LeafCapacity = leafCapacity
+		c.Options.NonLeafCapacity = nonLeafCapacity
+		return nil
+	}
+}
+
+// WithMinFillFactor sets the minimum fill factor (see Options).
+func WithMinFillFactor(minFillFactor float64) Option {
+	return func(c *newConfig) error {
+		c.Options.MinFillFactor = minFillFactor
+		return nil
+	}
+}
+
+// WithoutSiblingShifting disables sibling shifting (see
+// Options.DisableSiblingShifting).
+func WithoutSiblingShifting() Option {
+	return func(c *newConfig) error {
+		c.Options.DisableSiblingShifting = true
+		return nil
+	}
+}
+
+// WithKeyKind sets the kind of keys.
+func WithKeyKind(keyKind KeyKind) Option {
+	return func(c *newConfig) error {
+		c.Options.KeyKind = keyKind
+		return nil
+	}
+}
+
+// WithKeyComparer sets the key comparer of generic keys.
+func WithKeyComparer(keyComparer KeyComparer) Option {
+	return func(c *newConfig) error {
+		c.Options.KeyComparer = keyComparer
+		return nil
+	}
+}
+
+// WithComparerCheck enables checks of the key comparer every given
+// number of searches in nodes, with the given error handler, which
+// can be nil (see Options.ComparerCheckInterval).
+func WithComparerCheck(interval int, errorHandler func(err *ComparerError)) Option {
+	return func(c *newConfig) error {
+		if interval < 1 {
+			return errors.New("bptree: invalid comparer check interval")
+		}
+
+		c.Options.ComparerCheckInterval = interval
+		c.Options.ComparerErrorHandler = errorHandler
+		return nil
+	}
+}
+
+// WithPanicRecovery makes searches and mutations recover from
+// panics (see Options.RecoverPanics).
+func WithPanicRecovery() Option {
+	return func(c *newConfig) error {
+		c.Options.RecoverPanics = true
+		return nil
+	}
+}
+
+// WithHashing enables hashing with the given key encoder and value
+// encoder (see EnableHashing).
+func WithHashing(keyEncoder Encoder, valueEncoder Encoder) Option {
+	return func(c *newConfig) error {
+		c.EnableHashing = true
+		c.KeyEncoder = keyEncoder
+		c.ValueEncoder = valueEncoder
+		return nil
+	}
+}
+
+// WithMutationLog enables the mutation log retaining up to the
+// given number of mutations (see EnableMutationLog).
+func WithMutationLog(maxNumberOfMutations int) Option {
+	return func(c *newConfig) error {
+		if maxNumberOfMutations < 1 {
+			return errors.New("bptree: invalid maximum number of mutations")
+		}
+
+		c.MaxNumberOfMutations = maxNumberOfMutations
+		return nil
+	}
+}
+
+// WithNodePooling enables node pooling keeping at most the given
+// number of free nodes (see EnableNodePooling).
+func WithNodePooling(maxNumberOfFreeNodes int) Option {
+	return func(c *newConfig) error {
+		if maxNumberOfFreeNodes < 0 {
+			return errors.New("bptree: invalid maximum number of free nodes")
+		}
+
+		c.EnableNodePooling = true
+		c.MaxNumberOfFreeNodes = maxNumberOfFreeNodes
+		return nil
+	}
+}
+
+// WithTrace starts recording the operations on the B+ tree to the
+// given writer with the given encoder (see StartTrace).
+func WithTrace(w io.Writer, encoder MutationEncoder) Option {
+	return func(c *newConfig) error {
+		if w == nil || encoder == nil {
+			return errors.New("bptree: trace writer and encoder required")
+		}
+
+		c.TraceWriter = w
+		c.TraceEncoder = encoder
+		return nil
+	}
+}
+
+type newConfig struct {
+	Options              Options
+	EnableHashing        bool
+	KeyEncoder           Encoder
+	ValueEncoder         Encoder
+	MaxNumberOfMutations int
+	EnableNodePooling    bool
+	MaxNumberOfFreeNodes int
+	TraceWriter          io.Writer
+	TraceEncoder         MutationEncoder
+}
+
+// lazyInit initializes the B+ tree on first use if it is the zero
+// value, as New does without options, so that the zero value is
+// ready to use.
+func (bpt *BPTree) lazyInit() {
+	if bpt.root == nil {
+		bpt.InitWithOptions(Options{
+			LeafCapacity:    DefaultMaxDegree,
+			NonLeafCapacity: DefaultMaxDegree,
+		})
+	}
+}
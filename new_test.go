@@ -0,0 +1,170 @@
+package bptree_test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	bpt, err := bptree.New()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, bptree.DefaultMaxDegree, bpt.MaxDegree())
+		assert.Equal(t, bptree.GenericKeys, bpt.KeyKind())
+		bpt.AddRecord(2, "b")
+		bpt.AddRecord(1, "a")
+		_, v, ok := bpt.Floor(3)
+		assert.True(t, ok)
+		assert.Equal(t, "b", v)
+	}
+
+	bpt, err = bptree.New(
+		bptree.WithCapacities(6, 5),
+		bptree.WithMinFillFactor(0.4),
+		bptree.WithoutSiblingShifting(),
+		bptree.WithKeyKind(bptree.Int64Keys),
+		bptree.WithComparerCheck(10, func(*bptree.ComparerError) {}),
+		bptree.WithPanicRecovery(),
+		bptree.WithHashing(nil, nil),
+		bptree.WithMutationLog(100),
+		bptree.WithNodePooling(10),
+	)
+
+	if assert.NoError(t, err) {
+		options := bpt.Options()
+		assert.Equal(t, 6, options.LeafCapacity)
+		assert.Equal(t, 5, options.NonLeafCapacity)
+		assert.Equal(t, 0.4, options.MinFillFactor)
+		assert.True(t, options.DisableSiblingShifting)
+		assert.Equal(t, 10, options.ComparerCheckInterval)
+		assert.True(t, options.RecoverPanics)
+
+		for i := int64(0); i < 100; i++ {
+			bpt.AddRecord(i, "x")
+		}
+
+		bpt.AddRecord("foo", "x")
+		assert.Error(t, bpt.Err())
+		assert.Equal(t, uint64(100), bpt.SequenceNumber())
+		assert.NotEmpty(t, bpt.RootHash())
+		bpt.Clear()
+		assert.True(t, bpt.Stats().NumberOfFreeNodes >= 1)
+		assert.NoError(t, bpt.Check())
+	}
+
+	for _, tc := range []struct {
+		Opts []bptree.Option
+		Err  string
+	}{
+		{[]bptree.Option{bptree.WithMaxDegree(3)}, "bptree: invalid maximum degree"},
+		{[]bptree.Option{bptree.WithCapacities(1, 4)}, "bptree: invalid leaf capacity"},
+		{[]bptree.Option{bptree.WithCapacities(2, 3)}, "bptree: invalid non-leaf capacity"},
+		{[]bptree.Option{bptree.WithMinFillFactor(0.6)}, "bptree: invalid minimum fill factor"},
+		{[]bptree.Option{bptree.WithKeyKind(bptree.KeyKind(100))}, "bptree: invalid key kind"},
+		{[]bptree.Option{bptree.WithComparerCheck(0, nil)}, "bptree: invalid comparer check interval"},
+		{[]bptree.Option{bptree.WithHashing(nil, nil)}, "bptree: key encoder required"},
+		{[]bptree.Option{bptree.WithMutationLog(0)}, "bptree: invalid maximum number of mutations"},
+		{[]bptree.Option{bptree.WithNodePooling(-1)}, "bptree: invalid maximum number of free nodes"},
+		{[]bptree.Option{bptree.WithTrace(nil, bptree.GobMutationEncoder{})}, "bptree: trace writer and encoder required"},
+	} {
+		bpt, err := bptree.New(tc.Opts...)
+		assert.Nil(t, bpt)
+		assert.EqualError(t, err, tc.Err)
+	}
+}
+
+func TestNewWithTrace(t *testing.T) {
+	var trace bytes.Buffer
+	bpt, err := bptree.New(bptree.WithKeyKind(bptree.StringKeys), bptree.WithTrace(&trace, bptree.GobMutationEncoder{}))
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	bpt.AddRecord("a", 1)
+	bpt.DeleteRecord("a")
+	bpt.AddRecord("b", 2)
+	assert.NoError(t, bpt.StopTrace())
+	bpt2, n, err := bptree.Replay(&trace, bptree.GobMutationEncoder{}, nil)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, n)
+		assert.True(t, bpt.Equal(bpt2, nil))
+	}
+}
+
+func TestBPTreeZeroValue(t *testing.T) {
+	var s struct {
+		Index bptree.BPTree
+	}
+
+	assert.True(t, s.Index.IsEmpty())
+	assert.Equal(t, bptree.DefaultMaxDegree, s.Index.MaxDegree())
+
+	for i := 0; i < 1000; i++ {
+		s.Index.AddRecord(i*7%1000, i)
+	}
+
+	assert.NoError(t, s.Index.Check())
+	assert.Equal(t, 3, s.Index.Height())
+	k, _, ok := s.Index.Ceiling(-1)
+	assert.True(t, ok)
+	assert.Equal(t, 0, k)
+
+	var bpt bptree.BPTree
+	bpt.EnableNodePooling(10)
+	bpt.AddRecord("b", nil)
+	bpt.AddRecord("a", nil)
+	it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax)
+	k, _ = it.Record()
+	assert.Equal(t, "a", k)
+
+	for i := 0; i < 100; i++ {
+		bpt.AddRecord(strconv.Itoa(i), nil)
+	}
+
+	bpt.Clear()
+	assert.True(t, bpt.Stats().NumberOfFreeNodes >= 1)
+
+	for _, keys := range [][2]interface{}{
+		{int8(-1), int8(1)},
+		{int16(-1), int16(1)},
+		{int32(-1), int32(1)},
+		{int64(-1), int64(1)},
+		{uint(1), uint(2)},
+		{uint8(1), uint8(2)},
+		{uint16(1), uint16(2)},
+		{uint32(1), uint32(2)},
+		{uint64(1), uint64(2)},
+		{float32(-0.5), float32(0.5)},
+		{-0.5, 0.5},
+		{[]byte("a"), []byte("b")},
+	} {
+		var bpt bptree.BPTree
+		bpt.AddRecord(keys[1], nil)
+		bpt.AddRecord(keys[0], nil)
+		k, _, ok := bpt.Floor(keys[1])
+		assert.True(t, ok)
+		assert.Equal(t, keys[1], k)
+		k, _, ok = bpt.Floor(keys[0])
+		assert.True(t, ok)
+		assert.Equal(t, keys[0], k)
+	}
+
+	var bpt2, bpt3 bptree.BPTree
+	assert.True(t, bptree.Diff(&bpt2, &bpt3, nil).IsAtEnd())
+	bpt3.AddRecord(1, "a")
+	it2 := bptree.Diff(&bpt2, &bpt3, nil)
+	assert.Equal(t, bptree.Difference{Kind: bptree.RecordAdded, Key: 1, NewValue: "a"}, it2.Difference())
+
+	var bpt4 bptree.BPTree
+	it2 = bptree.Diff(&bpt3, &bpt4, nil)
+	assert.Equal(t, bptree.RecordRemoved, it2.Difference().Kind)
+
+	bpt2.AddRecord(struct{}{}, nil)
+	assert.Panics(t, func() { bpt2.AddRecord(struct{}{}, nil) })
+}
@@ -0,0 +1,199 @@
+package bptree
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// EnableNodePooling makes the B+ tree recycle nodes removed by
+// merges, height decreases and Clear, rather than leave them to
+// the garbage collector. Nodes allocated with node pooling enabled
+// have room for as many records or children as their capacities,
+// so that the slices of recycled nodes never have to grow.
+// At most the given number of free nodes are kept in the pool.
+func (bpt *BPTree) EnableNodePooling(maxNumberOfFreeNodes int) {
+	bpt.lazyInit()
+
+	if maxNumberOfFreeNodes < 0 {
+		panic(errors.New("bptree: invalid maximum number of free nodes"))
+	}
+
+	if bpt.nodePool == nil {
+		bpt.nodePool = new(nodePool)
+	}
+
+	bpt.nodePool.SetMaxNumberOfFreeNodes(maxNumberOfFreeNodes)
+}
+
+// DisableNodePooling stops recycling nodes and drops the free
+// nodes in the pool.
+func (bpt *BPTree) DisableNodePooling() {
+	bpt.nodePool = nil
+}
+
+// Clear removes all records from the B+ tree. If node pooling is
+// enabled, the nodes of the B+ tree are returned to the pool.
+func (bpt *BPTree) Clear() {
+	bpt.lazyInit()
+
+	if bpt.tracer != nil {
+		bpt.tracer.Record(TraceClear)
+	}
+
+	if bpt.nodePool != nil {
+		bpt.freeNodes(bpt.root, 1)
+	}
+
+	bpt.finger = nil
+	root := bpt.newLeaf()
+	bpt.leafList.Init(root)
+	bpt.root = unsafe.Pointer(root)
+	bpt.height = 1
+	bpt.logMutation(MutationClear, nil, nil)
+}
+
+func (bpt *BPTree) freeNodes(node unsafe.Pointer, nodeDepth int) {
+	if nodeDepth == bpt.height {
+		bpt.freeLeaf((*leaf)(node))
+		return
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+
+	for i := 0; i < nonLeaf.NumberOfChildren(); i++ {
+		bpt.freeNodes(nonLeaf.Child(i), nodeDepth+1)
+	}
+
+	bpt.freeNonLeaf(nonLeaf)
+}
+
+func (bpt *BPTree) newLeaf() *leaf {
+	if bpt.nodePool == nil {
+		return &leaf{records: records{keys: newKeys(bpt.keyKind, 0)}}
+	}
+
+	if leaf := bpt.nodePool.GetLeaf(); leaf != nil {
+		return leaf
+	}
+
+	return &leaf{
+		records: records{
+			keys:   newKeys(bpt.keyKind, bpt.options.LeafCapacity),
+			values: make([]interface{}, 0, bpt.options.LeafCapacity),
+		},
+	}
+}
+
+func (bpt *BPTree) newNonLeaf() *nonLeaf {
+	if bpt.nodePool == nil {
+		return &nonLeaf{nodeChildren{keys: newKeys(bpt.keyKind, 0)}}
+	}
+
+	if nonLeaf := bpt.nodePool.GetNonLeaf(); nonLeaf != nil {
+		return nonLeaf
+	}
+
+	return &nonLeaf{
+		nodeChildren{
+			keys:     newKeys(bpt.keyKind, bpt.options.NonLeafCapacity-1),
+			children: make([]unsafe.Pointer, 0, bpt.options.NonLeafCapacity),
+		},
+	}
+}
+
+func (bpt *BPTree) freeLeaf(leaf *leaf) {
+	if bpt.nodePool != nil {
+		bpt.nodePool.PutLeaf(leaf)
+	}
+}
+
+func (bpt *BPTree) freeNonLeaf(nonLeaf *nonLeaf) {
+	if bpt.nodePool != nil {
+		bpt.nodePool.PutNonLeaf(nonLeaf)
+	}
+}
+
+// nodePool holds free nodes, which are empty but keep the capacity
+// of their slices.
+type nodePool struct {
+	maxNumberOfFreeNodes int
+	freeLeaves           []*leaf
+	freeNonLeaves        []*nonLeaf
+}
+
+func (np *nodePool) SetMaxNumberOfFreeNodes(maxNumberOfFreeNodes int) {
+	np.maxNumberOfFreeNodes = maxNumberOfFreeNodes
+
+	for np.NumberOfFreeNodes() > maxNumberOfFreeNodes {
+		if n := len(np.freeNonLeaves); n >= 1 {
+			np.freeNonLeaves[n-1] = nil
+			np.freeNonLeaves = np.freeNonLeaves[:n-1]
+		} else {
+			n = len(np.freeLeaves)
+			np.freeLeaves[n-1] = nil
+			np.freeLeaves = np.freeLeaves[:n-1]
+		}
+	}
+}
+
+func (np *nodePool) GetLeaf() *leaf {
+	n := len(np.freeLeaves)
+
+	if n == 0 {
+		return nil
+	}
+
+	leaf := np.freeLeaves[n-1]
+	np.freeLeaves[n-1] = nil
+	np.freeLeaves = np.freeLeaves[:n-1]
+	return leaf
+}
+
+func (np *nodePool) PutLeaf(leaf *leaf) {
+	leaf.Truncate(0)
+	leaf.Prev = nil
+	leaf.Next = nil
+
+	if np.NumberOfFreeNodes() < np.maxNumberOfFreeNodes {
+		np.freeLeaves = append(np.freeLeaves, leaf)
+	}
+}
+
+func (np *nodePool) GetNonLeaf() *nonLeaf {
+	n := len(np.freeNonLeaves)
+
+	if n == 0 {
+		return nil
+	}
+
+	nonLeaf := np.freeNonLeaves[n-1]
+	np.freeNonLeaves[n-1] = nil
+	np.freeNonLeaves = np.freeNonLeaves[:n-1]
+	return nonLeaf
+}
+
+func (np *nodePool) PutNonLeaf(nonLeaf *nonLeaf) {
+	nonLeaf.Truncate(0)
+
+	if np.NumberOfFreeNodes() < np.maxNumberOfFreeNodes {
+		np.freeNonLeaves = append(np.freeNonLeaves, nonLeaf)
+	}
+}
+
+func (np *nodePool) NumberOfFreeNodes() int {
+	return len(np.freeLeaves) + len(np.freeNonLeaves)
+}
+
+func (np *nodePool) MemoryUsage() int64 {
+	var memoryUsage int64
+
+	for _, leaf := range np.freeLeaves {
+		memoryUsage += int64(unsafe.Sizeof(*leaf)) + leaf.MemoryUsage()
+	}
+
+	for _, nonLeaf := range np.freeNonLeaves {
+		memoryUsage += int64(unsafe.Sizeof(*nonLeaf)) + nonLeaf.MemoryUsage()
+	}
+
+	return memoryUsage
+}
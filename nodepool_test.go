@@ -0,0 +1,149 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeNodePooling(t *testing.T) {
+	for _, keyKind := range []bptree.KeyKind{bptree.Int64Keys, bptree.StringKeys, bptree.BytesKeys} {
+		bpt := new(bptree.BPTree).InitWithKeyKind(4, keyKind, nil)
+		bpt.EnableNodePooling(1000)
+		makeKey := func(i int) interface{} {
+			switch keyKind {
+			case bptree.Int64Keys:
+				return int64(i)
+			case bptree.StringKeys:
+				return Keywords[i]
+			default:
+				return []byte(Keywords[i])
+			}
+		}
+
+		records := map[int]int{}
+
+		for i := 0; i < 3000; i++ {
+			k := rand.Intn(500)
+
+			if rand.Intn(2) == 0 {
+				_, ok := records[k]
+				_, ok2 := bpt.DeleteRecord(makeKey(k))
+				assert.Equal(t, ok, ok2, "%v %v", keyKind, k)
+				delete(records, k)
+			} else {
+				_, ok := records[k]
+				_, ok2 := bpt.AddOrUpdateRecord(makeKey(k), i)
+				assert.Equal(t, !ok, ok2, "%v %v", keyKind, k)
+				records[k] = i
+			}
+
+			if !assert.NoError(t, bpt.Check()) {
+				t.FailNow()
+			}
+		}
+
+		for k, v := range records {
+			_, v2, ok := bpt.Floor(makeKey(k))
+
+			if assert.True(t, ok, "%v %v", keyKind, k) {
+				assert.Equal(t, v, v2)
+			}
+		}
+
+		stats := bpt.Stats()
+		bpt.Clear()
+		stats2 := bpt.Stats()
+		assert.Equal(t, 0, stats2.NumberOfRecords)
+		assert.Equal(t, 1, stats2.Height)
+		assert.Equal(t, stats.NumberOfFreeNodes+stats.NumberOfLeaves+stats.NumberOfNonLeaves-1, stats2.NumberOfFreeNodes)
+		assert.True(t, bpt.SearchForward(bptree.KeyMin, bptree.KeyMax).IsAtEnd())
+
+		for i := 0; i < 500; i++ {
+			bpt.AddRecord(makeKey(i), i)
+		}
+
+		assert.NoError(t, bpt.Check())
+		stats3 := bpt.Stats()
+		assert.Equal(t, 500, stats3.NumberOfRecords)
+		assert.Less(t, stats3.NumberOfFreeNodes, stats2.NumberOfFreeNodes)
+	}
+}
+
+func TestBPTreeNodePoolingLimit(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+	bpt.EnableNodePooling(10)
+
+	for i := int64(0); i < 1000; i++ {
+		bpt.AddRecord(i, nil)
+	}
+
+	bpt.Clear()
+	assert.Equal(t, 10-1, bpt.Stats().NumberOfFreeNodes)
+	bpt.EnableNodePooling(5)
+	assert.Equal(t, 5, bpt.Stats().NumberOfFreeNodes)
+	bpt.DisableNodePooling()
+	assert.Equal(t, 0, bpt.Stats().NumberOfFreeNodes)
+	assert.Panics(t, func() { bpt.EnableNodePooling(-1) })
+}
+
+func TestBPTreeClear(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	bpt.Clear()
+	assert.True(t, bpt.SearchForward(bptree.KeyMin, bptree.KeyMax).IsAtEnd())
+	assert.Equal(t, 1, bpt.Height())
+	assert.NoError(t, bpt.Check())
+	_, ok := bpt.AddRecord("foo", 1)
+	assert.True(t, ok)
+	_, ok = bpt.HasRecord("foo")
+	assert.True(t, ok)
+}
+
+func TestBPTreeNodePoolingAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(10, func() { churn(makeChurnBPTree(false)) })
+	allocs2 := testing.AllocsPerRun(10, func() { churn(makeChurnBPTree(true)) })
+	assert.Less(t, allocs2, allocs)
+}
+
+func BenchmarkBPTreeChurn(b *testing.B) {
+	benchmarkBPTreeChurn(b, false)
+}
+
+func BenchmarkBPTreeChurnWithNodePooling(b *testing.B) {
+	benchmarkBPTreeChurn(b, true)
+}
+
+func benchmarkBPTreeChurn(b *testing.B, nodePooling bool) {
+	bpt := makeChurnBPTree(nodePooling)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		churn(bpt)
+	}
+}
+
+var churnKeys = rand.Perm(10000)
+
+func makeChurnBPTree(nodePooling bool) *bptree.BPTree {
+	bpt := new(bptree.BPTree).InitWithKeyKind(16, bptree.Int64Keys, nil)
+
+	if nodePooling {
+		bpt.EnableNodePooling(len(churnKeys))
+	}
+
+	churn(bpt)
+	return bpt
+}
+
+func churn(bpt *bptree.BPTree) {
+	for _, k := range churnKeys {
+		bpt.AddRecord(int64(k), nil)
+	}
+
+	for _, k := range churnKeys {
+		bpt.DeleteRecord(int64(k))
+	}
+}
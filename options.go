@@ -0,0 +1,148 @@
+package bptree
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// Options represents the options of a B+ tree.
+type Options struct {
+	// LeafCapacity is the maximum number of records of a leaf,
+	// which is at least 2.
+	LeafCapacity int
+
+	// NonLeafCapacity is the maximum number of children of a
+	// non-leaf, namely the fan-out, which is at least 4.
+	NonLeafCapacity int
+
+	// MinFillFactor is the minimum ratio of the size of a node to
+	// its capacity, in (0, 0.5], nodes at or below it are merged
+	// with or refilled from siblings on deletion. The root is
+	// exempt, and the last leaf may be below it after insertions at
+	// the end. 0 means 0.5.
+	MinFillFactor float64
+
+	// DisableSiblingShifting makes full nodes split on insertion
+	// right away, rather than shift records or children to siblings
+	// which are not full.
+	DisableSiblingShifting bool
+
+	// KeyKind is the kind of keys, GenericKeys by default.
+	KeyKind KeyKind
+
+	// KeyComparer is the key comparer of generic keys, which
+	// compares keys of the same integer, floating-point, string or
+	// []byte type by default. It is never called with KeyMin or
+	// KeyMax.
+	KeyComparer KeyComparer
+
+	// ComparerCheckInterval enables sanity checks of the key
+	// comparer for debugging if it is positive. Every such number
+	// of searches in nodes, the comparer is checked for reflexivity,
+	// antisymmetry and transitivity with the key searched for and
+	// some keys around it, and on every insertion, the key inserted
+	// is checked to be ordered between its neighbors.
+	ComparerCheckInterval int
+
+	// ComparerErrorHandler handles the violations found by the
+	// checks of the key comparer, which panic with a *ComparerError
+	// if it is nil.
+	ComparerErrorHandler func(err *ComparerError)
+
+	// RecoverPanics makes searches and mutations recover from
+	// panics, such as ones raised by the key comparer, and fail
+	// with the error reported by Err instead.
+	RecoverPanics bool
+}
+
+// InitWithOptions initializes the B+ tree with the given options
+// and returns it. It panics if the options are invalid.
+func (bpt *BPTree) InitWithOptions(options Options) *BPTree {
+	if err := options.normalize(); err != nil {
+		panic(err)
+	}
+
+	bpt.setOptions(options)
+	bpt.keyKind = options.KeyKind
+	bpt.keyComparer = options.KeyComparer
+	bpt.counters = Counters{}
+	bpt.nodePool = nil
+	bpt.hasher = nil
+	bpt.sequenceNumber = 0
+	bpt.mutationLog = nil
+	bpt.tracer = nil
+	bpt.comparerChecker = newComparerChecker(options)
+	bpt.err = nil
+	bpt.finger = nil
+	root := bpt.newLeaf()
+	bpt.leafList.Init(root)
+	bpt.root = unsafe.Pointer(root)
+	bpt.height = 1
+	return bpt
+}
+
+// Options returns the options of the B+ tree, with defaults filled
+// in.
+func (bpt *BPTree) Options() Options {
+	bpt.lazyInit()
+	return bpt.options
+}
+
+// normalize validates the options and fills in defaults.
+func (o *Options) normalize() error {
+	if o.LeafCapacity < 2 {
+		return errors.New("bptree: invalid leaf capacity")
+	}
+
+	if o.NonLeafCapacity < 4 {
+		return errors.New("bptree: invalid non-leaf capacity")
+	}
+
+	if o.MinFillFactor == 0 {
+		o.MinFillFactor = 0.5
+	} else if !(o.MinFillFactor > 0 && o.MinFillFactor <= 0.5) {
+		return errors.New("bptree: invalid minimum fill factor")
+	}
+
+	if o.ComparerCheckInterval < 0 {
+		return errors.New("bptree: invalid comparer check interval")
+	}
+
+	switch o.KeyKind {
+	case GenericKeys:
+		if o.KeyComparer == nil {
+			o.KeyComparer = compareWellKnownKeys
+		}
+	case BytesKeys:
+		o.KeyComparer = compareBytes
+	case Int64Keys:
+		o.KeyComparer = compareInt64s
+	case Uint64Keys:
+		o.KeyComparer = compareUint64s
+	case Float64Keys:
+		o.KeyComparer = compareFloat64s
+	case StringKeys:
+		o.KeyComparer = compareStrings
+	default:
+		return errors.New("bptree: invalid key kind")
+	}
+
+	return nil
+}
+
+func (bpt *BPTree) setOptions(options Options) {
+	bpt.options = options
+	// with at most half of the capacity, two sparse siblings can
+	// always be merged, and both halves of a split node are not
+	// below the minimum size.
+	bpt.minLeafSize = maxInt(1, int(float64(options.LeafCapacity)*options.MinFillFactor))
+	bpt.minNonLeafSize = maxInt(2, int(float64(options.NonLeafCapacity)*options.MinFillFactor))
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+
+	return y
+}
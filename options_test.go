@@ -0,0 +1,137 @@
+package bptree_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeInitWithOptions(t *testing.T) {
+	for _, leafCapacity := range []int{2, 3, 8} {
+		for _, nonLeafCapacity := range []int{4, 5, 9} {
+			for _, minFillFactor := range []float64{0, 0.1, 0.3, 0.5} {
+				for _, disableSiblingShifting := range []bool{false, true} {
+					options := bptree.Options{
+						LeafCapacity:           leafCapacity,
+						NonLeafCapacity:        nonLeafCapacity,
+						MinFillFactor:          minFillFactor,
+						DisableSiblingShifting: disableSiblingShifting,
+						KeyKind:                bptree.Int64Keys,
+					}
+
+					testBPTreeWithOptions(t, options)
+				}
+			}
+		}
+	}
+}
+
+func testBPTreeWithOptions(t *testing.T, options bptree.Options) {
+	bpt := new(bptree.BPTree).InitWithOptions(options)
+	records := map[int64]int{}
+
+	for i := 0; i < 2000; i++ {
+		k := int64(rand.Intn(300))
+
+		if i < 1000 || rand.Intn(2) == 0 {
+			_, ok := records[k]
+			_, ok2 := bpt.AddOrUpdateRecord(k, i)
+			assert.Equal(t, !ok, ok2, "%+v %v", options, k)
+			records[k] = i
+		} else {
+			_, ok := records[k]
+			_, ok2 := bpt.DeleteRecord(k)
+			assert.Equal(t, ok, ok2, "%+v %v", options, k)
+			delete(records, k)
+		}
+
+		if !assert.NoError(t, bpt.Check(), "%+v", options) {
+			t.FailNow()
+		}
+	}
+
+	n := 0
+
+	for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+		k, v := it.Record()
+		assert.Equal(t, records[k.(int64)], v)
+		n++
+	}
+
+	assert.Equal(t, len(records), n)
+}
+
+func TestBPTreeOptions(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:    16,
+		NonLeafCapacity: 64,
+		KeyKind:         bptree.StringKeys,
+	})
+
+	options := bpt.Options()
+	assert.Equal(t, 0.5, options.MinFillFactor)
+	assert.NotNil(t, options.KeyComparer)
+	assert.Equal(t, 64, bpt.MaxDegree())
+
+	for i, k := range Keywords[:10000] {
+		bpt.AddRecord(k, i)
+	}
+
+	assert.NoError(t, bpt.Check())
+	var walker bptree.Walker
+
+	walker = func(nodeAccessor bptree.NodeAccessor) error {
+		if nodeAccessor.IsLeaf() {
+			assert.True(t, nodeAccessor.NumberOfKeys() <= 16)
+			return nil
+		}
+
+		assert.True(t, nodeAccessor.NumberOfChildren() <= 64)
+
+		for i := 0; i < nodeAccessor.NumberOfChildren(); i++ {
+			if err := nodeAccessor.AccessChild(walker, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	assert.NoError(t, bpt.Walk(walker))
+
+	for _, options := range []bptree.Options{
+		{LeafCapacity: 1, NonLeafCapacity: 4},
+		{LeafCapacity: 2, NonLeafCapacity: 3},
+		{LeafCapacity: 2, NonLeafCapacity: 4, MinFillFactor: 0.6},
+		{LeafCapacity: 2, NonLeafCapacity: 4, MinFillFactor: -0.1},
+		{LeafCapacity: 2, NonLeafCapacity: 4, KeyKind: -1},
+	} {
+		assert.Panics(t, func() { new(bptree.BPTree).InitWithOptions(options) }, "%+v", options)
+	}
+}
+
+func TestBPTreeDisableSiblingShifting(t *testing.T) {
+	for _, disableSiblingShifting := range []bool{false, true} {
+		bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+			LeafCapacity:           8,
+			NonLeafCapacity:        8,
+			DisableSiblingShifting: disableSiblingShifting,
+			KeyKind:                bptree.StringKeys,
+		})
+
+		for i, k := range Keywords[:10000] {
+			bpt.AddRecord(k, i)
+		}
+
+		assert.NoError(t, bpt.Check())
+		stats := bpt.Stats()
+
+		if disableSiblingShifting {
+			assert.Equal(t, int64(0), stats.NumberOfShifts)
+		} else {
+			assert.NotEqual(t, int64(0), stats.NumberOfShifts)
+		}
+	}
+}
@@ -21,6 +21,17 @@ func (rp recordPath) LocateRecord() (*leaf, int) {
 	return rp[i].Leaf(), rp[i].RecordIndex()
 }
 
+// InvalidateHashes invalidates the cached hashes of the nodes on
+// the path, which change along with any change of their children.
+func (rp recordPath) InvalidateHashes() {
+	i := len(rp) - 1
+	rp[i].Leaf().digest = nil
+
+	for i--; i >= 0; i-- {
+		rp[i].NonLeaf().digest = nil
+	}
+}
+
 func (rp *recordPath) insertComponent(component recordPathComponent, componentIndex int) {
 	*rp = append(*rp, recordPathComponent{})
 	copy((*rp)[componentIndex+1:], (*rp)[componentIndex:])
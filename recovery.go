@@ -0,0 +1,37 @@
+package bptree
+
+import "fmt"
+
+// PanicError represents a panic recovered from an operation on a
+// B+ tree, with the option RecoverPanics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+}
+
+// Error implements error.Error.
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("bptree: panic recovered: %v", pe.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error,
+// otherwise nil.
+func (pe *PanicError) Unwrap() error {
+	err, _ := pe.Value.(error)
+	return err
+}
+
+// Err returns the error of the last search or mutation on the
+// B+ tree if it panicked, with the option RecoverPanics, otherwise
+// nil.
+// An operation which panicked returns zero values, and if it is a
+// mutation, the B+ tree is left as it was before the operation.
+func (bpt *BPTree) Err() error {
+	return bpt.err
+}
+
+func (bpt *BPTree) recoverPanic() {
+	if v := recover(); v != nil {
+		bpt.err = &PanicError{v}
+	}
+}
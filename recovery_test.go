@@ -0,0 +1,119 @@
+package bptree_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreePanicSafety(t *testing.T) {
+	numberOfCalls, maxNumberOfCalls := 0, -1
+	errComparer := errors.New("comparer failure")
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:    4,
+		NonLeafCapacity: 4,
+		KeyComparer: func(key1, key2 interface{}) int64 {
+			if numberOfCalls++; numberOfCalls == maxNumberOfCalls {
+				panic(errComparer)
+			}
+
+			return compareInts(key1, key2)
+		},
+		ComparerCheckInterval: 3,
+	})
+
+	for i := 0; i < 2000; i++ {
+		k := rand.Intn(300)
+		bpt2 := bpt.Clone(nil)
+		numberOfCalls, maxNumberOfCalls = 0, 1+rand.Intn(30)
+
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					assert.Equal(t, errComparer, v)
+					maxNumberOfCalls = -1
+					assert.NoError(t, bpt.Check())
+					assert.True(t, bpt.Equal(bpt2, nil))
+					assert.True(t, bpt.EqualShape(bpt2))
+				}
+			}()
+
+			if rand.Intn(3) == 0 {
+				bpt.DeleteRecord(k)
+			} else {
+				bpt.AddRecord(k, i)
+			}
+		}()
+
+		maxNumberOfCalls = -1
+	}
+
+	assert.NoError(t, bpt.Check())
+}
+
+func TestBPTreePanicSafetyNaNKey(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.Float64Keys, nil)
+
+	for i := 0; i < 16; i++ {
+		bpt.AddRecord(float64(i), nil)
+	}
+
+	bpt2 := bpt.Clone(nil)
+	assert.Panics(t, func() { bpt.AddRecord(math.NaN(), nil) })
+	assert.Panics(t, func() { bpt.AddRecord("1", nil) })
+	assert.NoError(t, bpt.Check())
+	assert.True(t, bpt.EqualShape(bpt2))
+	assert.Equal(t, bpt2.Stats().Counters, bpt.Stats().Counters)
+}
+
+func TestBPTreeRecoverPanics(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:    4,
+		NonLeafCapacity: 4,
+		KeyComparer: func(key1, key2 interface{}) int64 {
+			return compareInts(key1, key2)
+		},
+		RecoverPanics: true,
+	})
+
+	for i := 0; i < 100; i++ {
+		bpt.AddRecord(i, i)
+	}
+
+	bpt2 := bpt.Clone(nil)
+	_, ok := bpt.AddRecord("foo", nil)
+	assert.False(t, ok)
+	err := bpt.Err()
+
+	if assert.IsType(t, &bptree.PanicError{}, err) {
+		var typeAssertionError interface{ RuntimeError() }
+		assert.True(t, errors.As(err, &typeAssertionError))
+	}
+
+	assert.NoError(t, bpt.Check())
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.EqualShape(bpt2))
+
+	value, ok := bpt.HasRecord(13)
+	assert.NoError(t, bpt.Err())
+	assert.True(t, ok)
+	assert.Equal(t, 13, value)
+
+	it := bpt.SearchForward("foo", bptree.KeyMax)
+	assert.Error(t, bpt.Err())
+	assert.True(t, it.IsAtEnd())
+
+	_, _, ok = bpt.Floor("foo")
+	assert.False(t, ok)
+	assert.Error(t, bpt.Err())
+	_, ok = bpt.DeleteRecord(50)
+	assert.True(t, ok)
+	assert.NoError(t, bpt.Err())
+
+	assert.Equal(t, "bptree: panic recovered: foo", (&bptree.PanicError{Value: "foo"}).Error())
+	assert.Nil(t, (&bptree.PanicError{Value: "foo"}).Unwrap())
+}
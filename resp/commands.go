@@ -0,0 +1,359 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/roy2220/bptree"
+)
+
+type command struct {
+	// Arity is the number of arguments including the command name,
+	// or the negated minimum number of arguments if variadic.
+	Arity   int
+	Handler func(s *Server, args []string, replyWriter replyWriter) error
+}
+
+var commands = map[string]command{
+	"ping":             {-1, handlePing},
+	"command":          {-1, handleCommand},
+	"del":              {-2, handleDel},
+	"zadd":             {-4, handleZAdd},
+	"zrem":             {-3, handleZRem},
+	"zscore":           {3, handleZScore},
+	"zcard":            {2, handleZCard},
+	"zrank":            {3, handleZRank},
+	"zrevrank":         {3, handleZRevRank},
+	"zrangebyscore":    {-4, handleZRangeByScore},
+	"zrevrangebyscore": {-4, handleZRevRangeByScore},
+	"zrangebylex":      {-4, handleZRangeByLex},
+	"zrevrangebylex":   {-4, handleZRevRangeByLex},
+}
+
+func handlePing(_ *Server, args []string, replyWriter replyWriter) error {
+	switch len(args) {
+	case 1:
+		replyWriter.WriteSimpleString("PONG")
+	case 2:
+		replyWriter.WriteBulkString(args[1])
+	default:
+		return wrongNumberOfArgumentsError(args[0])
+	}
+
+	return nil
+}
+
+func handleCommand(_ *Server, _ []string, replyWriter replyWriter) error {
+	// Clients like redis-cli ask for command docs on start, an
+	// empty reply is acceptable to them.
+	replyWriter.WriteArrayHeader(0)
+	return nil
+}
+
+func handleDel(s *Server, args []string, replyWriter replyWriter) error {
+	n := 0
+
+	for _, key := range args[1:] {
+		if _, ok := s.sortedSets[key]; ok {
+			delete(s.sortedSets, key)
+			n++
+		}
+	}
+
+	replyWriter.WriteInteger(int64(n))
+	return nil
+}
+
+func handleZAdd(s *Server, args []string, replyWriter replyWriter) error {
+	var nx, xx, ch bool
+	i := 2
+
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ch":
+			ch = true
+		default:
+			break options
+		}
+	}
+
+	if nx && xx {
+		return errors.New("ERR XX and NX options at the same time are not compatible")
+	}
+
+	if (len(args)-i)%2 != 0 || i == len(args) {
+		return errSyntax
+	}
+
+	scores := make([]float64, 0, (len(args)-i)/2)
+
+	for j := i; j < len(args); j += 2 {
+		score, ok := parseScore(args[j])
+
+		if !ok {
+			return errors.New("ERR value is not a valid float")
+		}
+
+		scores = append(scores, score)
+	}
+
+	zset, ok := s.sortedSets[args[1]]
+
+	if !ok {
+		if xx {
+			replyWriter.WriteInteger(0)
+			return nil
+		}
+
+		zset = new(sortedSet).Init(s.options.MaxDegree)
+		s.sortedSets[args[1]] = zset
+	}
+
+	n := 0
+
+	for j, score := range scores {
+		member := args[i+2*j+1]
+		_, exists := zset.Score(member)
+
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+
+		if oldScore, ok := zset.Add(score, member); !ok || (ch && oldScore != score) {
+			n++
+		}
+	}
+
+	replyWriter.WriteInteger(int64(n))
+	return nil
+}
+
+func handleZRem(s *Server, args []string, replyWriter replyWriter) error {
+	n := 0
+
+	if zset, ok := s.sortedSets[args[1]]; ok {
+		for _, member := range args[2:] {
+			if zset.Remove(member) {
+				n++
+			}
+		}
+
+		if zset.Len() == 0 {
+			delete(s.sortedSets, args[1])
+		}
+	}
+
+	replyWriter.WriteInteger(int64(n))
+	return nil
+}
+
+func handleZScore(s *Server, args []string, replyWriter replyWriter) error {
+	if zset, ok := s.sortedSets[args[1]]; ok {
+		if score, ok := zset.Score(args[2]); ok {
+			replyWriter.WriteBulkString(formatScore(score))
+			return nil
+		}
+	}
+
+	replyWriter.WriteNil()
+	return nil
+}
+
+func handleZCard(s *Server, args []string, replyWriter replyWriter) error {
+	n := 0
+
+	if zset, ok := s.sortedSets[args[1]]; ok {
+		n = zset.Len()
+	}
+
+	replyWriter.WriteInteger(int64(n))
+	return nil
+}
+
+func handleZRank(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRank(s, args, replyWriter, false)
+}
+
+func handleZRevRank(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRank(s, args, replyWriter, true)
+}
+
+func doZRank(s *Server, args []string, replyWriter replyWriter, isReversed bool) error {
+	if zset, ok := s.sortedSets[args[1]]; ok {
+		if rank, ok := zset.Rank(args[2], isReversed); ok {
+			replyWriter.WriteInteger(int64(rank))
+			return nil
+		}
+	}
+
+	replyWriter.WriteNil()
+	return nil
+}
+
+func handleZRangeByScore(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRangeByScore(s, args, replyWriter, false)
+}
+
+func handleZRevRangeByScore(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRangeByScore(s, args, replyWriter, true)
+}
+
+func doZRangeByScore(s *Server, args []string, replyWriter replyWriter, isReversed bool) error {
+	minArg, maxArg := args[2], args[3]
+
+	if isReversed {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	minKey, maxKey, ok := parseScoreRange(minArg, maxArg)
+
+	if !ok {
+		return errors.New("ERR min or max is not a float")
+	}
+
+	rangeOptions, err := parseRangeOptions(args[4:], true)
+
+	if err != nil {
+		return err
+	}
+
+	zset, ok := s.sortedSets[args[1]]
+
+	if !ok {
+		replyWriter.WriteArrayHeader(0)
+		return nil
+	}
+
+	var replies []string
+
+	rangeOptions.Iterate(zset.Search(minKey, maxKey, isReversed), func(scoreMember scoreMember) {
+		replies = append(replies, scoreMember.Member)
+
+		if rangeOptions.WithScores {
+			replies = append(replies, formatScore(scoreMember.Score))
+		}
+	})
+
+	replyWriter.WriteBulkStrings(replies)
+	return nil
+}
+
+func handleZRangeByLex(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRangeByLex(s, args, replyWriter, false)
+}
+
+func handleZRevRangeByLex(s *Server, args []string, replyWriter replyWriter) error {
+	return doZRangeByLex(s, args, replyWriter, true)
+}
+
+// doZRangeByLex assumes that all the members have the same score,
+// as Redis does, and takes the score of the first member.
+func doZRangeByLex(s *Server, args []string, replyWriter replyWriter, isReversed bool) error {
+	minArg, maxArg := args[2], args[3]
+
+	if isReversed {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	if _, _, ok := parseLexRange(minArg, maxArg, 0); !ok {
+		return errors.New("ERR min or max not valid string range item")
+	}
+
+	rangeOptions, err := parseRangeOptions(args[4:], false)
+
+	if err != nil {
+		return err
+	}
+
+	zset, ok := s.sortedSets[args[1]]
+
+	if !ok {
+		replyWriter.WriteArrayHeader(0)
+		return nil
+	}
+
+	it := zset.Search(scoreMember{Score: math.Inf(-1), Bound: -1, IsMemberOpen: true}, scoreMember{Score: math.Inf(1), Bound: 1, IsMemberOpen: true}, false)
+	firstKey, _ := it.Record()
+	minKey, maxKey, _ := parseLexRange(minArg, maxArg, firstKey.(scoreMember).Score)
+	var replies []string
+
+	rangeOptions.Iterate(zset.Search(minKey, maxKey, isReversed), func(scoreMember scoreMember) {
+		replies = append(replies, scoreMember.Member)
+	})
+
+	replyWriter.WriteBulkStrings(replies)
+	return nil
+}
+
+type rangeOptions struct {
+	WithScores bool
+	Offset     int
+	Count      int
+}
+
+func parseRangeOptions(args []string, withScoresAllowed bool) (rangeOptions, error) {
+	rangeOptions := rangeOptions{Count: -1}
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "withscores":
+			if !withScoresAllowed {
+				return rangeOptions, errSyntax
+			}
+
+			rangeOptions.WithScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return rangeOptions, errSyntax
+			}
+
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+
+			if err1 != nil || err2 != nil {
+				return rangeOptions, errors.New("ERR value is not an integer or out of range")
+			}
+
+			rangeOptions.Offset, rangeOptions.Count = offset, count
+			i += 2
+		default:
+			return rangeOptions, errSyntax
+		}
+	}
+
+	return rangeOptions, nil
+}
+
+// Iterate calls the given callback with the members found by the
+// given iterator, applying the offset and the count.
+func (ro rangeOptions) Iterate(it bptree.Iterator, callback func(scoreMember)) {
+	if ro.Offset < 0 {
+		return
+	}
+
+	for i := 0; !it.IsAtEnd() && ro.Count != 0; it.Advance() {
+		if i < ro.Offset {
+			i++
+			continue
+		}
+
+		key, _ := it.Record()
+		callback(key.(scoreMember))
+
+		if ro.Count >= 1 {
+			ro.Count--
+		}
+	}
+}
+
+func wrongNumberOfArgumentsError(commandName string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(commandName))
+}
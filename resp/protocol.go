@@ -0,0 +1,175 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLength             = 512 << 20
+	maxPreallocatedBulkLength = 64 << 10
+)
+
+type protocolError string
+
+func (pe protocolError) Error() string {
+	return "Protocol error: " + string(pe)
+}
+
+// readCommand reads a command, which is either an array of bulk
+// strings or an inline command.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+
+	if err != nil || n < -1 || n > 1024*1024 {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	if n == -1 {
+		// a null array is an empty command, which is ignored.
+		return nil, nil
+	}
+
+	// the number of arguments is untrusted, so args grows as the
+	// bulk strings arrive.
+	var args []string
+
+	for i := 0; i < n; i++ {
+		line, err := readLine(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(line, "$") {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%s'", line[:1]))
+		}
+
+		bulkLength, err := strconv.Atoi(line[1:])
+
+		if err != nil || bulkLength < 0 || bulkLength > maxBulkLength {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		buffer, err := readBulk(reader, bulkLength+2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if buffer[bulkLength] != '\r' || buffer[bulkLength+1] != '\n' {
+			return nil, protocolError("invalid bulk string")
+		}
+
+		args = append(args, string(buffer[:bulkLength]))
+	}
+
+	return args, nil
+}
+
+// readBulk reads the given number of bytes. Only small bulks are
+// allocated up front, larger ones grow as the data arrives, so that a
+// huge length cannot force a huge allocation before any data.
+func readBulk(reader *bufio.Reader, n int) ([]byte, error) {
+	if n <= maxPreallocatedBulkLength {
+		buffer := make([]byte, n)
+
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return nil, err
+		}
+
+		return buffer, nil
+	}
+
+	var buffer bytes.Buffer
+
+	if _, err := io.CopyN(&buffer, reader, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line[:len(line)-1], "\r")
+
+	if line == "" {
+		return "", protocolError("empty line")
+	}
+
+	return line, nil
+}
+
+// replyWriter writes replies in the RESP2 format.
+type replyWriter struct {
+	*bufio.Writer
+}
+
+func (rw replyWriter) WriteSimpleString(s string) {
+	rw.WriteString("+" + s + "\r\n")
+}
+
+func (rw replyWriter) WriteError(err error) {
+	message := err.Error()
+
+	if !strings.HasPrefix(message, "ERR ") && !strings.HasPrefix(message, "WRONGTYPE ") {
+		message = "ERR " + message
+	}
+
+	rw.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(message) + "\r\n")
+}
+
+func (rw replyWriter) WriteInteger(i int64) {
+	rw.WriteString(":" + strconv.FormatInt(i, 10) + "\r\n")
+}
+
+func (rw replyWriter) WriteBulkString(s string) {
+	rw.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (rw replyWriter) WriteNil() {
+	rw.WriteString("$-1\r\n")
+}
+
+func (rw replyWriter) WriteArrayHeader(n int) {
+	rw.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (rw replyWriter) WriteBulkStrings(ss []string) {
+	rw.WriteArrayHeader(len(ss))
+
+	for _, s := range ss {
+		rw.WriteBulkString(s)
+	}
+}
+
+var errSyntax = errors.New("ERR syntax error")
@@ -0,0 +1,194 @@
+// Package resp implements a server speaking the Redis protocol
+// (RESP) which keeps sorted sets in B+ trees, as a local stand-in
+// for Redis in tests.
+//
+// Supported commands are PING, DEL, ZADD (with NX, XX and CH),
+// ZREM, ZSCORE, ZCARD, ZRANK, ZREVRANK, ZRANGEBYSCORE and
+// ZREVRANGEBYSCORE (with WITHSCORES and LIMIT), ZRANGEBYLEX and
+// ZREVRANGEBYLEX (with LIMIT).
+package resp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Server represents a RESP server.
+type Server struct {
+	options    Options
+	mutex      sync.Mutex
+	sortedSets map[string]*sortedSet
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup
+}
+
+// Init initializes the server with the given options and
+// returns it.
+func (s *Server) Init(options Options) *Server {
+	s.options = options
+	s.options.normalize()
+	s.sortedSets = map[string]*sortedSet{}
+	s.conns = map[net.Conn]struct{}{}
+	return s
+}
+
+// Serve accepts connections on the given listener and serves
+// them until the given context is done, then closes the listener
+// and all the connections, and waits for the connections to be
+// served.
+// It returns nil if the context is done.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+			s.closeConns()
+		case <-stop:
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			s.closeConns()
+			s.wg.Wait()
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		if !s.addConn(conn) {
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			defer s.removeConn(conn)
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn serves the given connection until the client quits or
+// the connection is broken, then closes the connection.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	replyWriter := replyWriter{bufio.NewWriter(conn)}
+
+	for {
+		args, err := readCommand(reader)
+
+		if err != nil {
+			if pe, ok := err.(protocolError); ok {
+				replyWriter.WriteError(pe)
+				replyWriter.Flush()
+			}
+
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(args[0], "quit") {
+			replyWriter.WriteSimpleString("OK")
+			replyWriter.Flush()
+			return
+		}
+
+		s.executeCommand(args, replyWriter)
+
+		// Replies to pipelined commands are written out at once.
+		if reader.Buffered() == 0 {
+			if err := replyWriter.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) executeCommand(args []string, replyWriter replyWriter) {
+	command, ok := commands[strings.ToLower(args[0])]
+
+	if !ok {
+		replyWriter.WriteError(unknownCommandError(args[0]))
+		return
+	}
+
+	if n := len(args); (command.Arity >= 0 && n != command.Arity) || n < -command.Arity {
+		replyWriter.WriteError(wrongNumberOfArgumentsError(args[0]))
+		return
+	}
+
+	s.mutex.Lock()
+	err := command.Handler(s, args, replyWriter)
+	s.mutex.Unlock()
+
+	if err != nil {
+		replyWriter.WriteError(err)
+	}
+}
+
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conns == nil {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) closeConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	s.conns = nil
+}
+
+// Options represents the options for servers.
+type Options struct {
+	// MaxDegree is the maximum degree of the B+ trees of sorted
+	// sets, which defaults to 64.
+	MaxDegree int
+}
+
+func (o *Options) normalize() {
+	if o.MaxDegree == 0 {
+		o.MaxDegree = 64
+	}
+}
+
+type unknownCommandError string
+
+func (uce unknownCommandError) Error() string {
+	return "ERR unknown command '" + string(uce) + "'"
+}
@@ -0,0 +1,314 @@
+package resp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roy2220/bptree/resp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerCommands(t *testing.T) {
+	c := DialPipe(new(resp.Server).Init(resp.Options{MaxDegree: 4}))
+	defer c.Close()
+
+	for _, tc := range []struct {
+		Command       string
+		ExpectedReply string
+	}{
+		{"PING", "PONG"},
+		{"PING hello", "hello"},
+		{"ZADD z 1 a 2 b 3 c", "3"},
+		{"ZADD z 1 a 2.5 b -inf d +inf e", "2"},
+		{"ZADD z CH 1 a 2 b", "1"},
+		{"ZADD z NX 10 a 4 f", "1"},
+		{"ZADD z XX 10 g", "0"},
+		{"ZADD z NX XX 1 a", "ERR XX and NX options at the same time are not compatible"},
+		{"ZADD z x a", "ERR value is not a valid float"},
+		{"ZADD z 1", "ERR wrong number of arguments for 'zadd' command"},
+		{"ZCARD z", "6"},
+		{"ZSCORE z b", "2"},
+		{"ZSCORE z e", "inf"},
+		{"ZSCORE z x", "<nil>"},
+		{"ZRANGEBYSCORE z -inf +inf", "[d a b c f e]"},
+		{"ZRANGEBYSCORE z 1 3 WITHSCORES", "[a 1 b 2 c 3]"},
+		{"ZRANGEBYSCORE z (1 (3", "[b]"},
+		{"ZRANGEBYSCORE z -inf +inf LIMIT 1 2", "[a b]"},
+		{"ZRANGEBYSCORE z 3 1", "[]"},
+		{"ZRANGEBYSCORE z x 1", "ERR min or max is not a float"},
+		{"ZRANGEBYSCORE z 1 2 LIMIT 1", "ERR syntax error"},
+		{"ZREVRANGEBYSCORE z +inf -inf LIMIT 0 3", "[e f c]"},
+		{"ZREVRANGEBYSCORE z 3 (1 WITHSCORES", "[c 3 b 2]"},
+		{"ZRANK z d", "0"},
+		{"ZRANK z c", "3"},
+		{"ZREVRANK z c", "2"},
+		{"ZRANK z x", "<nil>"},
+		{"ZREM z a x d", "2"},
+		{"ZRANGEBYSCORE z -inf +inf", "[b c f e]"},
+		{"ZRANGEBYSCORE y -inf +inf", "[]"},
+		{"ZADD l 0 a 0 b 0 c 0 d 0 e", "5"},
+		{"ZRANGEBYLEX l - +", "[a b c d e]"},
+		{"ZRANGEBYLEX l [b (d", "[b c]"},
+		{"ZRANGEBYLEX l (b + LIMIT 1 10", "[d e]"},
+		{"ZREVRANGEBYLEX l [d -", "[d c b a]"},
+		{"ZRANGEBYLEX l b d", "ERR min or max not valid string range item"},
+		{"ZRANGEBYLEX l [d [b", "[]"},
+		{"DEL l x", "1"},
+		{"ZCARD l", "0"},
+		{"FOO", "ERR unknown command 'FOO'"},
+	} {
+		reply, err := c.Do(strings.Fields(tc.Command)...)
+
+		if assert.NoError(t, err, tc.Command) {
+			assert.Equal(t, tc.ExpectedReply, FormatReply(reply), tc.Command)
+		}
+	}
+}
+
+func TestServerPipelining(t *testing.T) {
+	c := DialPipe(new(resp.Server).Init(resp.Options{}))
+	defer c.Close()
+	const n = 100
+
+	go func() {
+		for i := 0; i < n; i++ {
+			c.Send("ZADD", "z", strconv.Itoa(i), fmt.Sprintf("m%d", i))
+		}
+
+		c.Send("ZCARD", "z")
+		c.Flush()
+	}()
+
+	for i := 0; i < n; i++ {
+		reply, err := c.Receive()
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(1), reply)
+		}
+	}
+
+	reply, err := c.Receive()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(n), reply)
+	}
+}
+
+func TestServerInlineCommand(t *testing.T) {
+	c := DialPipe(new(resp.Server).Init(resp.Options{}))
+	defer c.Close()
+
+	go func() {
+		c.Writer.WriteString("zadd z 1 a\r\nzscore z a\r\n")
+		c.Flush()
+	}()
+
+	reply, err := c.Receive()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), reply)
+	}
+
+	reply, err = c.Receive()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", reply)
+	}
+}
+
+func TestServerNegativeMultibulkLength(t *testing.T) {
+	c := DialPipe(new(resp.Server).Init(resp.Options{}))
+	defer c.Close()
+
+	go func() {
+		c.Writer.WriteString("*-1\r\nzcard z\r\n*-5\r\n")
+		c.Flush()
+	}()
+
+	reply, err := c.Receive()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), reply)
+	}
+
+	reply, err = c.Receive()
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, errors.New("ERR Protocol error: invalid multibulk length"), reply)
+	}
+
+	_, err = c.Receive()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServerHugeBulkLength(t *testing.T) {
+	conn1, conn2 := net.Pipe()
+	done := make(chan struct{})
+	var memStats1, memStats2 runtime.MemStats
+	runtime.ReadMemStats(&memStats1)
+
+	go func() {
+		new(resp.Server).Init(resp.Options{}).ServeConn(conn2)
+		close(done)
+	}()
+
+	conn1.Write([]byte("*1\r\n$536870912\r\nzcard"))
+	conn1.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+
+	runtime.ReadMemStats(&memStats2)
+	// the bulk length announced must not be allocated up front.
+	assert.True(t, memStats2.TotalAlloc-memStats1.TotalAlloc < 1<<20, "%v", memStats2.TotalAlloc-memStats1.TotalAlloc)
+}
+
+func TestServerServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- new(resp.Server).Init(resp.Options{}).Serve(ctx, listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+
+	c := NewClient(conn)
+	defer c.Close()
+	reply, err := c.Do("ZADD", "z", "1", "a")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), reply)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not shut down")
+	}
+
+	_, err = c.Do("PING")
+	assert.Error(t, err)
+}
+
+type Client struct {
+	io.Closer
+	*bufio.Writer
+	Reader *bufio.Reader
+}
+
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{conn, bufio.NewWriter(conn), bufio.NewReader(conn)}
+}
+
+func DialPipe(s *resp.Server) *Client {
+	conn1, conn2 := net.Pipe()
+	go s.ServeConn(conn2)
+	return NewClient(conn1)
+}
+
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.Send(args...)
+
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.Receive()
+}
+
+func (c *Client) Send(args ...string) {
+	fmt.Fprintf(c, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		fmt.Fprintf(c, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// Receive reads a reply, which is a string, an int64, nil, an
+// error or a slice of replies.
+func (c *Client) Receive() (interface{}, error) {
+	line, err := c.Reader.ReadString('\n')
+
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+
+		if n < 0 {
+			return nil, nil
+		}
+
+		buffer := make([]byte, n+2)
+
+		if _, err := io.ReadFull(c.Reader, buffer); err != nil {
+			return nil, err
+		}
+
+		return string(buffer[:n]), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		replies := make([]interface{}, n)
+
+		for i := range replies {
+			if replies[i], err = c.Receive(); err != nil {
+				return nil, err
+			}
+		}
+
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("invalid reply: %q", line)
+	}
+}
+
+func FormatReply(reply interface{}) string {
+	if replies, ok := reply.([]interface{}); ok {
+		s := make([]string, len(replies))
+
+		for i, reply := range replies {
+			s[i] = FormatReply(reply)
+		}
+
+		return "[" + strings.Join(s, " ") + "]"
+	}
+
+	return fmt.Sprint(reply)
+}
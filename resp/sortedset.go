@@ -0,0 +1,218 @@
+package resp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/roy2220/bptree"
+)
+
+// sortedSet is a sorted set backed by a B+ tree keyed by
+// (score, member), and a map from members to scores.
+type sortedSet struct {
+	bpt    bptree.BPTree
+	scores map[string]float64
+}
+
+func (ss *sortedSet) Init(maxDegree int) *sortedSet {
+	ss.bpt.Init(maxDegree, compareScoreMembers)
+	ss.scores = map[string]float64{}
+	return ss
+}
+
+func (ss *sortedSet) Add(score float64, member string) (float64, bool) {
+	oldScore, ok := ss.scores[member]
+
+	if ok {
+		if oldScore == score {
+			return oldScore, true
+		}
+
+		ss.bpt.DeleteRecord(scoreMember{Score: oldScore, Member: member})
+	}
+
+	ss.bpt.AddRecord(scoreMember{Score: score, Member: member}, nil)
+	ss.scores[member] = score
+	return oldScore, ok
+}
+
+func (ss *sortedSet) Remove(member string) bool {
+	score, ok := ss.scores[member]
+
+	if !ok {
+		return false
+	}
+
+	ss.bpt.DeleteRecord(scoreMember{Score: score, Member: member})
+	delete(ss.scores, member)
+	return true
+}
+
+func (ss *sortedSet) Score(member string) (float64, bool) {
+	score, ok := ss.scores[member]
+	return score, ok
+}
+
+func (ss *sortedSet) Len() int {
+	return len(ss.scores)
+}
+
+// Rank returns the 0-based rank of the given member. The B+ tree
+// does not maintain subtree sizes, so it takes linear time.
+func (ss *sortedSet) Rank(member string, isReversed bool) (int, bool) {
+	score, ok := ss.scores[member]
+
+	if !ok {
+		return 0, false
+	}
+
+	rank := 0
+	var it bptree.Iterator
+
+	if isReversed {
+		it = ss.bpt.SearchBackward(scoreMember{Score: score, Member: member}, bptree.KeyMax)
+	} else {
+		it = ss.bpt.SearchForward(bptree.KeyMin, scoreMember{Score: score, Member: member})
+	}
+
+	for ; !it.IsAtEnd(); it.Advance() {
+		rank++
+	}
+
+	return rank - 1, true
+}
+
+// Search returns an iterator to iterate over the members in
+// the given interval [minKey, maxKey].
+func (ss *sortedSet) Search(minKey, maxKey scoreMember, isReversed bool) bptree.Iterator {
+	if isReversed {
+		return ss.bpt.SearchBackward(minKey, maxKey)
+	}
+
+	return ss.bpt.SearchForward(minKey, maxKey)
+}
+
+// scoreMember is the key of sorted sets. Its bound places it
+// before (-1) or after (+1) all the members with the same score
+// or, for lexicographical ranges, the same member prefix.
+type scoreMember struct {
+	Score  float64
+	Member string
+	Bound  int8
+
+	// IsMemberOpen indicates that the member is unbounded, so that
+	// the bound applies to all the members with the same score.
+	IsMemberOpen bool
+}
+
+func compareScoreMembers(key1, key2 interface{}) int64 {
+	scoreMember1, scoreMember2 := key1.(scoreMember), key2.(scoreMember)
+
+	if scoreMember1.Score < scoreMember2.Score {
+		return -1
+	}
+
+	if scoreMember1.Score > scoreMember2.Score {
+		return 1
+	}
+
+	if scoreMember1.IsMemberOpen {
+		if scoreMember2.IsMemberOpen {
+			return int64(scoreMember1.Bound - scoreMember2.Bound)
+		}
+
+		return int64(scoreMember1.Bound)
+	}
+
+	if scoreMember2.IsMemberOpen {
+		return -int64(scoreMember2.Bound)
+	}
+
+	if d := strings.Compare(scoreMember1.Member, scoreMember2.Member); d != 0 {
+		return int64(d)
+	}
+
+	return int64(scoreMember1.Bound - scoreMember2.Bound)
+}
+
+// parseScoreRange parses an interval of scores like "(1" and
+// "+inf" into the keys bounding the interval.
+func parseScoreRange(minArg, maxArg string) (scoreMember, scoreMember, bool) {
+	minScore, minIsExclusive, ok1 := parseScoreBound(minArg)
+	maxScore, maxIsExclusive, ok2 := parseScoreBound(maxArg)
+
+	if !(ok1 && ok2) {
+		return scoreMember{}, scoreMember{}, false
+	}
+
+	minKey := scoreMember{Score: minScore, Bound: -1, IsMemberOpen: true}
+
+	if minIsExclusive {
+		minKey.Bound = 1
+	}
+
+	maxKey := scoreMember{Score: maxScore, Bound: 1, IsMemberOpen: true}
+
+	if maxIsExclusive {
+		maxKey.Bound = -1
+	}
+
+	return minKey, maxKey, true
+}
+
+func parseScoreBound(arg string) (float64, bool, bool) {
+	isExclusive := strings.HasPrefix(arg, "(")
+
+	if isExclusive {
+		arg = arg[1:]
+	}
+
+	score, ok := parseScore(arg)
+	return score, isExclusive, ok
+}
+
+// parseLexRange parses an interval of members like "[a", "(b",
+// "-" and "+" into the keys bounding the interval for members
+// with the given score.
+func parseLexRange(minArg, maxArg string, score float64) (scoreMember, scoreMember, bool) {
+	minKey, ok1 := parseLexBound(minArg, score, -1)
+	maxKey, ok2 := parseLexBound(maxArg, score, 1)
+	return minKey, maxKey, ok1 && ok2
+}
+
+func parseLexBound(arg string, score float64, bound int8) (scoreMember, bool) {
+	switch {
+	case arg == "-":
+		return scoreMember{Score: score, Bound: -1, IsMemberOpen: true}, true
+	case arg == "+":
+		return scoreMember{Score: score, Bound: 1, IsMemberOpen: true}, true
+	case strings.HasPrefix(arg, "["):
+		return scoreMember{Score: score, Member: arg[1:], Bound: bound}, true
+	case strings.HasPrefix(arg, "("):
+		return scoreMember{Score: score, Member: arg[1:], Bound: -bound}, true
+	default:
+		return scoreMember{}, false
+	}
+}
+
+func parseScore(arg string) (float64, bool) {
+	score, err := strconv.ParseFloat(arg, 64)
+
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,204 @@
+package bptree_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeSequentialAdd(t *testing.T) {
+	for _, maxDegree := range []int{4, 5, 16} {
+		bpt := new(bptree.BPTree).InitWithKeyKind(maxDegree, bptree.Int64Keys, nil)
+		n := 10000
+
+		for i := 0; i < n; i++ {
+			_, ok := bpt.AddRecord(int64(i), i)
+			assert.True(t, ok)
+		}
+
+		if !assert.NoError(t, bpt.Check()) {
+			t.FailNow()
+		}
+
+		stats := bpt.Stats()
+		assert.Equal(t, (n+maxDegree-1)/maxDegree, stats.NumberOfLeaves, "%v", maxDegree)
+		i := 0
+
+		for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+			k, v := it.Record()
+			assert.Equal(t, int64(i), k)
+			assert.Equal(t, i, v)
+			i++
+		}
+
+		assert.Equal(t, n, i)
+
+		for i := 0; i < n; i += 2 {
+			_, ok := bpt.DeleteRecord(int64(i))
+			assert.True(t, ok)
+		}
+
+		if !assert.NoError(t, bpt.Check()) {
+			t.FailNow()
+		}
+	}
+}
+
+func TestBPTreeAppendSplit(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+
+	for i := 0; i < 1000; i++ {
+		bpt.AddRecord(int64(i), nil)
+
+		if !assert.NoError(t, bpt.Check(), "%v", i) {
+			t.FailNow()
+		}
+
+		// every leaf except the last one is full, and every non-leaf
+		// has at least 2 children.
+		var leafSizes []int
+
+		bpt.Traverse(context.Background(), bptree.PreOrder, func(nodeAccessor bptree.NodeAccessor) error {
+			if nodeAccessor.IsLeaf() {
+				leafSizes = append(leafSizes, nodeAccessor.NumberOfKeys())
+			} else {
+				assert.True(t, nodeAccessor.NumberOfChildren() >= 2)
+			}
+
+			return nil
+		})
+
+		for _, n := range leafSizes[:len(leafSizes)-1] {
+			if !assert.Equal(t, 4, n, "%v %v", i, leafSizes) {
+				t.FailNow()
+			}
+		}
+	}
+
+	counters := bpt.Counters()
+	assert.Equal(t, int64(1000/4-1), counters.NumberOfAppendSplits)
+
+	for i := 999; i >= 0; i-- {
+		bpt.DeleteRecord(int64(i))
+
+		if !assert.NoError(t, bpt.Check(), "%v", i) {
+			t.FailNow()
+		}
+	}
+
+	assert.True(t, bpt.IsEmpty())
+
+	// the last leaf is exempt from the minimum size only after
+	// insertions at the end.
+	bpt2 := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+
+	for i := 1000; i >= 0; i-- {
+		bpt2.AddRecord(int64(i), nil)
+	}
+
+	assert.Equal(t, int64(0), bpt2.Counters().NumberOfAppendSplits)
+	assert.NoError(t, bpt2.Check())
+
+	// an insertion at the end right after one elsewhere is not
+	// sequential.
+	bpt3 := new(bptree.BPTree).InitWithKeyKind(4, bptree.Int64Keys, nil)
+
+	for _, k := range []int64{0, 1, 3, 2, 4} {
+		bpt3.AddRecord(k, nil)
+	}
+
+	assert.Equal(t, int64(0), bpt3.Counters().NumberOfAppendSplits)
+	assert.Equal(t, int64(1), bpt3.Counters().NumberOfSplits)
+}
+
+func TestBPTreeFinger(t *testing.T) {
+	bpt := new(bptree.BPTree).Init(5, func(key1, key2 interface{}) int64 {
+		return int64(key1.(int) - key2.(int))
+	})
+
+	records := map[int]int{}
+	k := 0
+
+	for i := 0; i < 20000; i++ {
+		// keys close to each other, mostly increasing.
+		k += rand.Intn(7) - 2
+
+		switch rand.Intn(4) {
+		case 0:
+			_, ok := records[k]
+			_, ok2 := bpt.DeleteRecord(k)
+			assert.Equal(t, ok, ok2, "%v", k)
+			delete(records, k)
+		case 1:
+			v, ok := records[k]
+			v2, ok2 := bpt.AddRecord(k, i)
+			assert.Equal(t, !ok, ok2, "%v", k)
+
+			if ok {
+				assert.Equal(t, v, v2)
+			} else {
+				records[k] = i
+			}
+		default:
+			v, ok := records[k]
+			v2, ok2 := bpt.AddOrUpdateRecord(k, i)
+			assert.Equal(t, !ok, ok2, "%v", k)
+
+			if ok {
+				assert.Equal(t, v, v2)
+			}
+
+			records[k] = i
+		}
+
+		if i%100 == 0 && !assert.NoError(t, bpt.Check()) {
+			t.FailNow()
+		}
+	}
+
+	assert.NoError(t, bpt.Check())
+	n := 0
+
+	for it := bpt.SearchForward(bptree.KeyMin, bptree.KeyMax); !it.IsAtEnd(); it.Advance() {
+		k, v := it.Record()
+		assert.Equal(t, records[k.(int)], v)
+		n++
+	}
+
+	assert.Equal(t, len(records), n)
+}
+
+func BenchmarkBPTreeAddRecordSequential(b *testing.B) {
+	keys := make([]interface{}, b.N)
+
+	for i := range keys {
+		keys[i] = int64(i)
+	}
+
+	bpt := new(bptree.BPTree).InitWithKeyKind(64, bptree.Int64Keys, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for _, k := range keys {
+		bpt.AddRecord(k, nil)
+	}
+}
+
+func BenchmarkBPTreeAddRecordRandomly(b *testing.B) {
+	keys := make([]interface{}, b.N)
+
+	for i, k := range rand.Perm(b.N) {
+		keys[i] = int64(k)
+	}
+
+	bpt := new(bptree.BPTree).InitWithKeyKind(64, bptree.Int64Keys, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for _, k := range keys {
+		bpt.AddRecord(k, nil)
+	}
+}
@@ -0,0 +1,357 @@
+// Package server exposes a B+ tree as an ordered key-value
+// service over HTTP/JSON.
+//
+// Endpoints:
+//
+//	GET    /records/{key}  get a record
+//	PUT    /records/{key}  put a record, the body is the JSON value
+//	DELETE /records/{key}  delete a record
+//	GET    /records?min=&max=&direction=forward|backward&limit=
+//	                       scan records with keys in [min, max] and
+//	                       stream them as newline-delimited JSON
+//	GET    /stats          get the statistics of the B+ tree
+//
+// Keys are strings, values are arbitrary JSON values.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roy2220/bptree"
+)
+
+// Server represents an HTTP server exposing a B+ tree with
+// string keys.
+type Server struct {
+	options      Options
+	mutex        sync.RWMutex
+	bpt          *bptree.BPTree
+	mux          http.ServeMux
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// ErrServerClosed is returned by Serve after the server has been
+// shut down.
+var ErrServerClosed = errors.New("server: server closed")
+
+// Init initializes the server with the given options and
+// returns it.
+func (s *Server) Init(options Options) *Server {
+	s.options = options
+	s.options.normalize()
+	s.bpt = new(bptree.BPTree).InitWithKeyKind(s.options.MaxDegree, bptree.StringKeys, nil)
+	s.mux.HandleFunc("/records", s.handleRecords)
+	s.mux.HandleFunc("/records/", s.handleRecord)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	s.shutdown = make(chan struct{})
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	s.mux.ServeHTTP(responseWriter, request)
+}
+
+// Serve accepts connections on the given listener and serves
+// requests until the given context is done, then shuts down
+// gracefully by waiting for active requests to complete for at
+// most the shutdown timeout.
+// It returns nil after a graceful shutdown, and ErrServerClosed if
+// the server has already been shut down. The listener is closed in
+// either case.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	select {
+	case <-s.shutdown:
+		listener.Close()
+		return ErrServerClosed
+	default:
+	}
+
+	httpServer := http.Server{Handler: s}
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.ShutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if err := <-errs; err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) handleRecord(responseWriter http.ResponseWriter, request *http.Request) {
+	key, err := url.PathUnescape(strings.TrimPrefix(request.URL.EscapedPath(), "/records/"))
+
+	if err != nil {
+		writeError(responseWriter, http.StatusBadRequest, "invalid key")
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		s.mutex.RLock()
+		value, ok := s.bpt.HasRecord(key)
+		s.mutex.RUnlock()
+
+		if !ok {
+			writeError(responseWriter, http.StatusNotFound, "record not found")
+			return
+		}
+
+		writeJSON(responseWriter, http.StatusOK, Record{key, value.(json.RawMessage)})
+	case http.MethodPut:
+		// read one more byte than the limit to tell values too large
+		// apart from other failures of reading the body.
+		data, err := ioutil.ReadAll(io.LimitReader(request.Body, s.options.MaxValueSize+1))
+
+		if err != nil {
+			writeError(responseWriter, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if int64(len(data)) > s.options.MaxValueSize {
+			writeError(responseWriter, http.StatusRequestEntityTooLarge, "value too large")
+			return
+		}
+
+		if !json.Valid(data) {
+			writeError(responseWriter, http.StatusBadRequest, "invalid value")
+			return
+		}
+
+		s.mutex.Lock()
+		_, ok := s.bpt.AddOrUpdateRecord(key, json.RawMessage(data))
+		s.mutex.Unlock()
+
+		if ok {
+			responseWriter.WriteHeader(http.StatusCreated)
+		} else {
+			responseWriter.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		s.mutex.Lock()
+		_, ok := s.bpt.DeleteRecord(key)
+		s.mutex.Unlock()
+
+		if !ok {
+			writeError(responseWriter, http.StatusNotFound, "record not found")
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusNoContent)
+	default:
+		responseWriter.Header().Set("Allow", "GET, PUT, DELETE")
+		writeError(responseWriter, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleRecords(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		responseWriter.Header().Set("Allow", "GET")
+		writeError(responseWriter, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := request.URL.Query()
+	var minKey, maxKey interface{} = bptree.KeyMin, bptree.KeyMax
+
+	if _, ok := query["min"]; ok {
+		minKey = query.Get("min")
+	}
+
+	if _, ok := query["max"]; ok {
+		maxKey = query.Get("max")
+	}
+
+	var isBackward bool
+
+	switch query.Get("direction") {
+	case "", "forward":
+	case "backward":
+		isBackward = true
+	default:
+		writeError(responseWriter, http.StatusBadRequest, "invalid direction")
+		return
+	}
+
+	limit := -1
+
+	if limitArg := query.Get("limit"); limitArg != "" {
+		var err error
+		limit, err = strconv.Atoi(limitArg)
+
+		if err != nil || limit < 0 {
+			writeError(responseWriter, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/x-ndjson")
+	responseWriter.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(responseWriter)
+	flusher, _ := responseWriter.(http.Flusher)
+
+	// Records are read in batches so that the lock is not held
+	// while writing to slow clients.
+	for limit != 0 {
+		batchSize := s.options.ScanBatchSize
+
+		if limit >= 1 && limit < batchSize {
+			batchSize = limit
+		}
+
+		records := make([]Record, 0, batchSize)
+		s.mutex.RLock()
+
+		for it := s.search(minKey, maxKey, isBackward); !it.IsAtEnd() && len(records) < batchSize+1; it.Advance() {
+			key, value := it.Record()
+			records = append(records, Record{key.(string), value.(json.RawMessage)})
+		}
+
+		s.mutex.RUnlock()
+		isLastBatch := len(records) <= batchSize
+
+		if !isLastBatch {
+			if isBackward {
+				maxKey = records[batchSize].Key
+			} else {
+				minKey = records[batchSize].Key
+			}
+
+			records = records[:batchSize]
+		}
+
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return
+			}
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if isLastBatch {
+			return
+		}
+
+		if limit >= 1 {
+			limit -= batchSize
+		}
+
+		select {
+		case <-request.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		default:
+		}
+	}
+}
+
+func (s *Server) search(minKey, maxKey interface{}, isBackward bool) bptree.Iterator {
+	if isBackward {
+		return s.bpt.SearchBackward(minKey, maxKey)
+	}
+
+	return s.bpt.SearchForward(minKey, maxKey)
+}
+
+func (s *Server) handleStats(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		responseWriter.Header().Set("Allow", "GET")
+		writeError(responseWriter, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mutex.RLock()
+	stats := s.bpt.Stats()
+	s.mutex.RUnlock()
+	writeJSON(responseWriter, http.StatusOK, stats)
+}
+
+// Options represents the options for servers.
+type Options struct {
+	// MaxDegree is the maximum degree of the B+ tree, which
+	// defaults to 64.
+	MaxDegree int
+
+	// MaxValueSize is the maximum size of values in bytes, which
+	// defaults to 1 MiB.
+	MaxValueSize int64
+
+	// ScanBatchSize is the number of records read at a time while
+	// scanning, which defaults to 256.
+	ScanBatchSize int
+
+	// ShutdownTimeout is the maximum time to wait for active
+	// requests to complete while shutting down, which defaults
+	// to 5 seconds.
+	ShutdownTimeout time.Duration
+}
+
+func (o *Options) normalize() {
+	if o.MaxDegree == 0 {
+		o.MaxDegree = 64
+	}
+
+	if o.MaxValueSize == 0 {
+		o.MaxValueSize = 1 << 20
+	}
+
+	if o.ScanBatchSize == 0 {
+		o.ScanBatchSize = 256
+	}
+
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = 5 * time.Second
+	}
+}
+
+// Record represents a record in responses.
+type Record struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(responseWriter http.ResponseWriter, statusCode int, data interface{}) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(data)
+}
+
+func writeError(responseWriter http.ResponseWriter, statusCode int, message string) {
+	writeJSON(responseWriter, statusCode, errorResponse{message})
+}
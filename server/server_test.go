@@ -0,0 +1,202 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roy2220/bptree/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerRecords(t *testing.T) {
+	ts := httptest.NewServer(new(server.Server).Init(server.Options{}))
+	defer ts.Close()
+
+	statusCode, _ := DoRequest(t, http.MethodPut, ts.URL+"/records/a%2Fb", `{"x": 1}`)
+	assert.Equal(t, http.StatusCreated, statusCode)
+	statusCode, _ = DoRequest(t, http.MethodPut, ts.URL+"/records/a%2Fb", `[1, 2]`)
+	assert.Equal(t, http.StatusNoContent, statusCode)
+	statusCode, body := DoRequest(t, http.MethodGet, ts.URL+"/records/a%2Fb", "")
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, `{"key": "a/b", "value": [1, 2]}`, body)
+	statusCode, body = DoRequest(t, http.MethodPut, ts.URL+"/records/c", `{`)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.JSONEq(t, `{"error": "invalid value"}`, body)
+	statusCode, _ = DoRequest(t, http.MethodDelete, ts.URL+"/records/a%2Fb", "")
+	assert.Equal(t, http.StatusNoContent, statusCode)
+	statusCode, _ = DoRequest(t, http.MethodDelete, ts.URL+"/records/a%2Fb", "")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	statusCode, _ = DoRequest(t, http.MethodGet, ts.URL+"/records/a%2Fb", "")
+	assert.Equal(t, http.StatusNotFound, statusCode)
+	statusCode, _ = DoRequest(t, http.MethodPost, ts.URL+"/records/a", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, statusCode)
+}
+
+func TestServerRecordsBadBody(t *testing.T) {
+	s := new(server.Server).Init(server.Options{MaxValueSize: 4})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	statusCode, _ := DoRequest(t, http.MethodPut, ts.URL+"/records/a", `1234`)
+	assert.Equal(t, http.StatusCreated, statusCode)
+	statusCode, body := DoRequest(t, http.MethodPut, ts.URL+"/records/a", `12345`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+	assert.JSONEq(t, `{"error": "value too large"}`, body)
+
+	request := httptest.NewRequest(http.MethodPut, "/records/a", ioutil.NopCloser(errorReader{}))
+	responseRecorder := httptest.NewRecorder()
+	s.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, http.StatusBadRequest, responseRecorder.Code)
+	assert.JSONEq(t, `{"error": "invalid request body"}`, responseRecorder.Body.String())
+}
+
+type errorReader struct{}
+
+func (errorReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestServerScan(t *testing.T) {
+	ts := httptest.NewServer(new(server.Server).Init(server.Options{MaxDegree: 4, ScanBatchSize: 3}))
+	defer ts.Close()
+
+	for i := 0; i < 20; i++ {
+		statusCode, _ := DoRequest(t, http.MethodPut, fmt.Sprintf("%s/records/k%02d", ts.URL, i), fmt.Sprint(i))
+		assert.Equal(t, http.StatusCreated, statusCode)
+	}
+
+	for _, tc := range []struct {
+		Query        string
+		ExpectedKeys string
+	}{
+		{"", "k00 k01 k02 k03 k04 k05 k06 k07 k08 k09 k10 k11 k12 k13 k14 k15 k16 k17 k18 k19"},
+		{"?min=k05&max=k09", "k05 k06 k07 k08 k09"},
+		{"?min=k05&max=k09&direction=backward", "k09 k08 k07 k06 k05"},
+		{"?min=k15&limit=3", "k15 k16 k17"},
+		{"?max=k10&direction=backward&limit=7", "k10 k09 k08 k07 k06 k05 k04"},
+		{"?min=k3", ""},
+		{"?limit=0", ""},
+	} {
+		statusCode, body := DoRequest(t, http.MethodGet, ts.URL+"/records"+tc.Query, "")
+
+		if !assert.Equal(t, http.StatusOK, statusCode, tc.Query) {
+			continue
+		}
+
+		var keys []string
+		scanner := bufio.NewScanner(strings.NewReader(body))
+
+		for scanner.Scan() {
+			var record server.Record
+
+			if assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record)) {
+				i, _ := strconv.Atoi(record.Key[1:])
+				assert.Equal(t, strconv.Itoa(i), string(record.Value))
+				keys = append(keys, record.Key)
+			}
+		}
+
+		assert.Equal(t, tc.ExpectedKeys, strings.Join(keys, " "), tc.Query)
+	}
+
+	for _, query := range []string{"?direction=sideways", "?limit=-1", "?limit=x"} {
+		statusCode, _ := DoRequest(t, http.MethodGet, ts.URL+"/records"+query, "")
+		assert.Equal(t, http.StatusBadRequest, statusCode, query)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	ts := httptest.NewServer(new(server.Server).Init(server.Options{MaxDegree: 4}))
+	defer ts.Close()
+
+	for i := 0; i < 10; i++ {
+		DoRequest(t, http.MethodPut, fmt.Sprintf("%s/records/%d", ts.URL, i), "null")
+	}
+
+	statusCode, body := DoRequest(t, http.MethodGet, ts.URL+"/stats", "")
+
+	if assert.Equal(t, http.StatusOK, statusCode) {
+		var stats struct{ NumberOfRecords, Height int }
+
+		if assert.NoError(t, json.Unmarshal([]byte(body), &stats)) {
+			assert.Equal(t, 10, stats.NumberOfRecords)
+			assert.Equal(t, 2, stats.Height)
+		}
+	}
+}
+
+func TestServerServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	s := new(server.Server).Init(server.Options{})
+
+	go func() {
+		errs <- s.Serve(ctx, listener)
+	}()
+
+	url := "http://" + listener.Addr().String()
+	statusCode, _ := DoRequest(t, http.MethodPut, url+"/records/a", "1")
+	assert.Equal(t, http.StatusCreated, statusCode)
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not shut down")
+	}
+
+	_, err = http.Get(url + "/records/a")
+	assert.Error(t, err)
+	assert.Equal(t, server.ErrServerClosed, s.Serve(context.Background(), listener))
+	listener2, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, server.ErrServerClosed, s.Serve(context.Background(), listener2))
+	// the listener is closed, so no connections are accepted.
+	_, err = net.Dial("tcp", listener2.Addr().String())
+	assert.Error(t, err)
+}
+
+func DoRequest(t *testing.T, method string, url string, body string) (int, string) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response.StatusCode, string(data)
+}
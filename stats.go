@@ -0,0 +1,114 @@
+package bptree
+
+import "unsafe"
+
+// Stats returns the statistics of the B+ tree.
+// It visits every node of the B+ tree.
+func (bpt *BPTree) Stats() Stats {
+	bpt.lazyInit()
+
+	stats := Stats{
+		Height:               bpt.height,
+		FillFactorHistograms: make([]FillFactorHistogram, bpt.height),
+		EstimatedMemoryUsage: int64(unsafe.Sizeof(*bpt)),
+		Counters:             bpt.counters,
+	}
+
+	bpt.collectStats(&stats, bpt.root, 1)
+
+	if np := bpt.nodePool; np != nil {
+		stats.NumberOfFreeNodes = np.NumberOfFreeNodes()
+		stats.EstimatedMemoryUsage += np.MemoryUsage()
+	}
+
+	stats.AverageLeafFillFactor = float64(stats.NumberOfRecords) / float64(stats.NumberOfLeaves*bpt.options.LeafCapacity)
+	return stats
+}
+
+// Counters returns the cumulative counters of the structural
+// changes of the B+ tree since it was initialized.
+func (bpt *BPTree) Counters() Counters {
+	return bpt.counters
+}
+
+func (bpt *BPTree) collectStats(stats *Stats, node unsafe.Pointer, nodeDepth int) {
+	fillFactorHistogram := &stats.FillFactorHistograms[nodeDepth-1]
+
+	if nodeDepth == bpt.height {
+		leaf := (*leaf)(node)
+		stats.NumberOfRecords += leaf.NumberOfRecords()
+		stats.NumberOfLeaves++
+		fillFactorHistogram.add(leaf.NumberOfRecords(), bpt.options.LeafCapacity)
+		stats.EstimatedMemoryUsage += int64(unsafe.Sizeof(*leaf)) + leaf.MemoryUsage()
+		return
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+	stats.NumberOfNonLeaves++
+	fillFactorHistogram.add(nonLeaf.NumberOfChildren(), bpt.options.NonLeafCapacity)
+	stats.EstimatedMemoryUsage += int64(unsafe.Sizeof(*nonLeaf)) + nonLeaf.MemoryUsage()
+
+	for i := 0; i < nonLeaf.NumberOfChildren(); i++ {
+		bpt.collectStats(stats, nonLeaf.Child(i), nodeDepth+1)
+	}
+}
+
+// Stats represents the statistics of a B+ tree.
+type Stats struct {
+	NumberOfRecords   int
+	NumberOfLeaves    int
+	NumberOfNonLeaves int
+	Height            int
+
+	// NumberOfFreeNodes is the number of nodes kept in the node
+	// pool for reuse.
+	NumberOfFreeNodes int
+
+	// AverageLeafFillFactor is the number of records divided by
+	// the capacity of all leaves.
+	AverageLeafFillFactor float64
+
+	// FillFactorHistograms holds the fill factor histograms of
+	// levels, from the root level to the leaf level.
+	FillFactorHistograms []FillFactorHistogram
+
+	// EstimatedMemoryUsage is the estimated number of bytes used
+	// by the B+ tree, excluding the memory referenced by keys and
+	// values.
+	EstimatedMemoryUsage int64
+
+	Counters
+}
+
+// FillFactorHistogram counts nodes by fill factor, which is the
+// number of records of a leaf, or the number of children of a
+// non-leaf, divided by the maximum degree. The i-th bucket counts
+// nodes with fill factors in [i*10%, (i+1)*10%), the last bucket
+// includes full nodes.
+type FillFactorHistogram [10]int
+
+func (ffh *FillFactorHistogram) add(nodeSize int, capacity int) {
+	i := nodeSize * len(ffh) / capacity
+
+	if i == len(ffh) {
+		i--
+	}
+
+	ffh[i]++
+}
+
+// Counters represents the cumulative counters of the structural
+// changes of a B+ tree.
+type Counters struct {
+	NumberOfSplits          int64
+	NumberOfMerges          int64
+	NumberOfShifts          int64
+	NumberOfHeightIncreases int64
+	NumberOfHeightDecreases int64
+
+	// NumberOfAppendSplits is the number of leaf splits made by
+	// sequential insertions at the end of the B+ tree, which leave the split
+	// leaves full and the last leaf possibly below the minimum
+	// size. It is included in NumberOfSplits.
+	NumberOfAppendSplits int64
+}
@@ -0,0 +1,85 @@
+package bptree_test
+
+import (
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeStats(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	stats := bpt.Stats()
+	assert.Equal(t, len(Keywords), stats.NumberOfRecords)
+	assert.Equal(t, bpt.Height(), stats.Height)
+
+	if assert.Len(t, stats.FillFactorHistograms, bpt.Height()) {
+		assert.Equal(t, 1, sum(stats.FillFactorHistograms[0][:]))
+		assert.Equal(t, stats.NumberOfLeaves, sum(stats.FillFactorHistograms[bpt.Height()-1][:]))
+		numberOfNonLeaves := 0
+
+		for _, fillFactorHistogram := range stats.FillFactorHistograms[:bpt.Height()-1] {
+			numberOfNonLeaves += sum(fillFactorHistogram[:])
+		}
+
+		assert.Equal(t, stats.NumberOfNonLeaves, numberOfNonLeaves)
+	}
+
+	assert.True(t, stats.AverageLeafFillFactor >= 0.4 && stats.AverageLeafFillFactor <= 1)
+	assert.True(t, stats.EstimatedMemoryUsage > 0)
+	assert.True(t, stats.NumberOfSplits >= int64(stats.NumberOfLeaves+stats.NumberOfNonLeaves-bpt.Height()))
+	assert.True(t, stats.NumberOfMerges >= 1)
+	assert.True(t, stats.NumberOfShifts >= 1)
+	assert.Equal(t, int64(bpt.Height()-1), stats.NumberOfHeightIncreases-stats.NumberOfHeightDecreases)
+	assert.Equal(t, stats.Counters, bpt.Counters())
+
+	for l, h := 0, len(Keywords)-1; l <= h; l, h = l+1, h-1 {
+		bpt.DeleteRecord(Keywords[SortedKeywordIndexes[l]])
+
+		if l < h {
+			bpt.DeleteRecord(Keywords[SortedKeywordIndexes[h]])
+		}
+	}
+
+	stats = bpt.Stats()
+	assert.Equal(t, 0, stats.NumberOfRecords)
+	assert.Equal(t, 1, stats.NumberOfLeaves)
+	assert.Equal(t, 0, stats.NumberOfNonLeaves)
+	assert.Equal(t, stats.NumberOfHeightIncreases, stats.NumberOfHeightDecreases)
+}
+
+func TestBPTreeCheck(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	assert.NoError(t, bpt.Check())
+	isReversed := false
+
+	bpt = new(bptree.BPTree).Init(4, func(key1, key2 interface{}) int64 {
+		d := int64(key1.(int) - key2.(int))
+
+		if isReversed {
+			d = -d
+		}
+
+		return d
+	})
+
+	assert.NoError(t, bpt.Check())
+
+	for i := 0; i < 100; i++ {
+		bpt.AddRecord(i, nil)
+	}
+
+	assert.NoError(t, bpt.Check())
+	isReversed = true
+	assert.Error(t, bpt.Check())
+}
+
+func sum(values []int) int {
+	s := 0
+
+	for _, value := range values {
+		s += value
+	}
+
+	return s
+}
@@ -0,0 +1,376 @@
+package bptree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"unsafe"
+)
+
+// Sync synchronizes the B+ tree with a remote replica through the
+// given transport, so that the B+ tree ends up with the same records
+// as the remote one. It compares the summaries of key ranges of both
+// replicas, narrows down the differing ranges recursively, and then
+// transfers the records only in those ranges.
+// Summaries are computed from the digests cached in nodes (see
+// EnableHashing), so ranges covering whole subtrees are summarized
+// without scanning their records. Hashing must be enabled on both
+// replicas, with the same encoders.
+// Range hashes are XORs of record hashes, which detect accidental
+// divergence but are not meant to be secure against forgery.
+func (bpt *BPTree) Sync(transport SyncTransport) (SyncStats, error) {
+	bpt.checkHashing()
+	var stats SyncStats
+	ranges := []KeyRange{{KeyMin, KeyMax}}
+	var recordRanges []KeyRange
+
+	for len(ranges) >= 1 || len(recordRanges) >= 1 {
+		request := SyncRequest{
+			Ranges:       ranges,
+			RecordRanges: recordRanges,
+		}
+
+		response, err := transport.RoundTrip(&request)
+
+		if err != nil {
+			return stats, err
+		}
+
+		stats.NumberOfRoundTrips++
+
+		if len(response.Summaries) != len(request.Ranges) || len(response.Records) != len(request.RecordRanges) {
+			return stats, errors.New("bptree: invalid sync response")
+		}
+
+		for i, keyRange := range request.RecordRanges {
+			records := response.Records[i]
+
+			if err := bpt.checkSyncRecords(keyRange, records); err != nil {
+				return stats, err
+			}
+
+			bpt.applySyncRecords(keyRange, records)
+			stats.NumberOfRecordsTransferred += len(records)
+		}
+
+		ranges, recordRanges = nil, nil
+
+		for i, keyRange := range request.Ranges {
+			stats.NumberOfRangesCompared++
+			summary := bpt.summarizeRange(keyRange)
+			remoteSummary := response.Summaries[i]
+
+			if remoteSummary.NumberOfRecords == summary.NumberOfRecords && bytes.Equal(remoteSummary.Hash, summary.Hash) {
+				continue
+			}
+
+			if remoteSummary.NumberOfRecords == 0 {
+				bpt.applySyncRecords(keyRange, nil)
+				continue
+			}
+
+			var splitKeys []interface{}
+
+			if remoteSummary.NumberOfRecords > bpt.options.LeafCapacity {
+				splitKeys = bpt.splitRange(keyRange, bpt.options.NonLeafCapacity)
+			}
+
+			if len(splitKeys) == 0 {
+				recordRanges = append(recordRanges, keyRange)
+				continue
+			}
+
+			minKey := keyRange.MinKey
+
+			for _, splitKey := range splitKeys {
+				ranges = append(ranges, KeyRange{minKey, splitKey})
+				minKey = splitKey
+			}
+
+			ranges = append(ranges, KeyRange{minKey, keyRange.MaxKey})
+		}
+	}
+
+	return stats, nil
+}
+
+// ServeSync serves the given request from a replica synchronizing
+// with the B+ tree, see Sync.
+// Hashing must be enabled.
+func (bpt *BPTree) ServeSync(request *SyncRequest) *SyncResponse {
+	bpt.checkHashing()
+
+	response := SyncResponse{
+		Summaries: make([]RangeSummary, len(request.Ranges)),
+		Records:   make([][]SyncRecord, len(request.RecordRanges)),
+	}
+
+	for i, keyRange := range request.Ranges {
+		response.Summaries[i] = bpt.summarizeRange(keyRange)
+	}
+
+	for i, keyRange := range request.RecordRanges {
+		response.Records[i] = bpt.collectSyncRecords(keyRange)
+	}
+
+	return &response
+}
+
+// SyncTransport represents a transport of messages between two
+// replicas of a B+ tree. Transports crossing process boundaries
+// have to serialize the keys and values in messages.
+type SyncTransport interface {
+	// RoundTrip sends the given request to the remote replica and
+	// returns the response.
+	RoundTrip(request *SyncRequest) (response *SyncResponse, err error)
+}
+
+// SyncTransportFunc is a function as a sync transport.
+type SyncTransportFunc func(request *SyncRequest) (*SyncResponse, error)
+
+// RoundTrip calls the function.
+func (stf SyncTransportFunc) RoundTrip(request *SyncRequest) (*SyncResponse, error) {
+	return stf(request)
+}
+
+// SyncRequest represents a request in synchronization.
+type SyncRequest struct {
+	// Ranges holds the key ranges to summarize.
+	Ranges []KeyRange
+
+	// RecordRanges holds the key ranges to transfer records in.
+	RecordRanges []KeyRange
+}
+
+// SyncResponse represents a response in synchronization.
+type SyncResponse struct {
+	// Summaries holds the summaries of the requested ranges.
+	Summaries []RangeSummary
+
+	// Records holds the records in the requested record ranges,
+	// in key order.
+	Records [][]SyncRecord
+}
+
+// KeyRange represents the key range [MinKey, MaxKey), where MinKey
+// can be KeyMin and MaxKey can be KeyMax.
+type KeyRange struct {
+	MinKey interface{}
+	MaxKey interface{}
+}
+
+// RangeSummary represents the summary of records in a key range.
+type RangeSummary struct {
+	Hash            []byte
+	NumberOfRecords int
+}
+
+// SyncRecord represents a record transferred in synchronization.
+type SyncRecord struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// SyncStats represents the statistics of synchronization.
+type SyncStats struct {
+	NumberOfRoundTrips         int
+	NumberOfRangesCompared     int
+	NumberOfRecordsTransferred int
+}
+
+func (bpt *BPTree) summarizeRange(keyRange KeyRange) RangeSummary {
+	var rangeHash [sha256.Size]byte
+	n := bpt.summarizeNodeRange(bpt.root, 1, KeyRange{KeyMin, KeyMax}, keyRange, &rangeHash)
+	return RangeSummary{rangeHash[:], n}
+}
+
+func (bpt *BPTree) summarizeNodeRange(node unsafe.Pointer, nodeDepth int, nodeRange KeyRange, keyRange KeyRange, rangeHash *[sha256.Size]byte) int {
+	if bpt.compareKeys(keyRange.MinKey, nodeRange.MinKey) <= 0 && bpt.compareKeys(nodeRange.MaxKey, keyRange.MaxKey) <= 0 {
+		digest := bpt.nodeDigest(node, nodeDepth)
+		xorHash(rangeHash, digest.RangeHash[:])
+		return digest.NumberOfRecords
+	}
+
+	if nodeDepth == bpt.height {
+		leaf := (*leaf)(node)
+		n := 0
+
+		for i := 0; i < leaf.NumberOfRecords(); i++ {
+			if bpt.isInRange(leaf.Key(i), keyRange) {
+				xorHash(rangeHash, hashRecord(bpt.proofRecord(leaf, i)))
+				n++
+			}
+		}
+
+		return n
+	}
+
+	nonLeaf := (*nonLeaf)(node)
+	n := 0
+
+	for i := 0; i < nonLeaf.NumberOfChildren(); i++ {
+		childRange := bpt.childRange(nonLeaf, i, nodeRange)
+
+		if bpt.compareKeys(childRange.MinKey, keyRange.MaxKey) < 0 && bpt.compareKeys(keyRange.MinKey, childRange.MaxKey) < 0 {
+			n += bpt.summarizeNodeRange(nonLeaf.Child(i), nodeDepth+1, childRange, keyRange, rangeHash)
+		}
+	}
+
+	return n
+}
+
+// splitRange returns at most maxNumberOfKeys-1 keys strictly inside
+// the given key range to split it with, which are taken from the
+// highest level having any. It returns nothing if the B+ tree has
+// no such keys.
+func (bpt *BPTree) splitRange(keyRange KeyRange, maxNumberOfKeys int) []interface{} {
+	node := bpt.root
+	var keys []interface{}
+
+	for nodeDepth := 1; ; nodeDepth++ {
+		if nodeDepth == bpt.height {
+			leaf := (*leaf)(node)
+
+			for i := 0; i < leaf.NumberOfRecords(); i++ {
+				if key := leaf.Key(i); bpt.compareKeys(keyRange.MinKey, key) < 0 && bpt.isInRange(key, keyRange) {
+					keys = append(keys, key)
+				}
+			}
+
+			break
+		}
+
+		nonLeaf := (*nonLeaf)(node)
+		childIndex := 0
+
+		for i := 1; i < nonLeaf.NumberOfChildren(); i++ {
+			key := nonLeaf.Key(i)
+
+			if bpt.compareKeys(key, keyRange.MinKey) <= 0 {
+				childIndex = i
+			} else if bpt.compareKeys(key, keyRange.MaxKey) < 0 {
+				keys = append(keys, key)
+			}
+		}
+
+		if len(keys) >= 1 {
+			break
+		}
+
+		// the key range falls inside a single child.
+		node = nonLeaf.Child(childIndex)
+	}
+
+	if len(keys) < maxNumberOfKeys {
+		return keys
+	}
+
+	sampledKeys := make([]interface{}, maxNumberOfKeys-1)
+
+	for i := range sampledKeys {
+		sampledKeys[i] = keys[(i+1)*len(keys)/maxNumberOfKeys]
+	}
+
+	return sampledKeys
+}
+
+func (bpt *BPTree) collectSyncRecords(keyRange KeyRange) []SyncRecord {
+	var records []SyncRecord
+	leaf, recordIndex, _ := bpt.locateRecord(keyRange.MinKey)
+
+	for leaf, recordIndex, ok := bpt.nextRecord(leaf, recordIndex); ok; leaf, recordIndex, ok = bpt.nextRecord(leaf, recordIndex+1) {
+		key := leaf.Key(recordIndex)
+
+		if bpt.compareKeys(key, keyRange.MaxKey) >= 0 {
+			break
+		}
+
+		if bpt.compareKeys(keyRange.MinKey, key) <= 0 {
+			records = append(records, SyncRecord{key, leaf.Value(recordIndex)})
+		}
+	}
+
+	return records
+}
+
+func (bpt *BPTree) checkSyncRecords(keyRange KeyRange, records []SyncRecord) error {
+	for i, record := range records {
+		if !bpt.isInRange(record.Key, keyRange) || (i >= 1 && bpt.keyComparer(records[i-1].Key, record.Key) >= 0) {
+			return errors.New("bptree: invalid sync response")
+		}
+	}
+
+	return nil
+}
+
+// applySyncRecords makes the records in the given key range of the
+// B+ tree the same as the given ones.
+func (bpt *BPTree) applySyncRecords(keyRange KeyRange, records []SyncRecord) {
+	localRecords := bpt.collectSyncRecords(keyRange)
+	i, j := 0, 0
+
+	for i < len(localRecords) || j < len(records) {
+		var d int64
+
+		switch {
+		case j == len(records):
+			d = -1
+		case i == len(localRecords):
+			d = 1
+		default:
+			d = bpt.keyComparer(localRecords[i].Key, records[j].Key)
+		}
+
+		switch {
+		case d < 0:
+			bpt.DeleteRecord(localRecords[i].Key)
+			i++
+		case d > 0:
+			bpt.AddRecord(records[j].Key, records[j].Value)
+			j++
+		default:
+			if !bytes.Equal(bpt.hasher.ValueEncoder(localRecords[i].Value), bpt.hasher.ValueEncoder(records[j].Value)) {
+				bpt.UpdateRecord(records[j].Key, records[j].Value)
+			}
+
+			i++
+			j++
+		}
+	}
+}
+
+func (bpt *BPTree) childRange(nonLeaf *nonLeaf, childIndex int, nodeRange KeyRange) KeyRange {
+	childRange := nodeRange
+
+	if childIndex >= 1 {
+		childRange.MinKey = nonLeaf.Key(childIndex)
+	}
+
+	if childIndex < nonLeaf.NumberOfChildren()-1 {
+		childRange.MaxKey = nonLeaf.Key(childIndex + 1)
+	}
+
+	return childRange
+}
+
+func (bpt *BPTree) isInRange(key interface{}, keyRange KeyRange) bool {
+	return bpt.compareKeys(keyRange.MinKey, key) <= 0 && bpt.compareKeys(key, keyRange.MaxKey) < 0
+}
+
+// compareKeys is like the key comparer but also accepts KeyMin and
+// KeyMax.
+func (bpt *BPTree) compareKeys(key1, key2 interface{}) int64 {
+	x, ok1 := key1.(keyMinMax)
+	y, ok2 := key2.(keyMinMax)
+
+	switch {
+	case ok1 && ok2:
+		return int64(x) - int64(y)
+	case ok1:
+		return int64(x)
+	case ok2:
+		return -int64(y)
+	default:
+		return bpt.keyComparer(key1, key2)
+	}
+}
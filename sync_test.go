@@ -0,0 +1,118 @@
+package bptree_test
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeSync(t *testing.T) {
+	remote := new(bptree.BPTree).InitWithKeyKind(8, bptree.Int64Keys, nil)
+	remote.EnableHashing(nil, nil)
+
+	for i := int64(0); i < 10000; i++ {
+		remote.AddRecord(i*2, strconv.Itoa(int(i)))
+	}
+
+	transport := MakeSyncTransport(remote)
+	local := new(bptree.BPTree).InitWithKeyKind(6, bptree.Int64Keys, nil)
+	local.EnableHashing(nil, nil)
+	stats, err := local.Sync(transport)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, 10000, stats.NumberOfRecordsTransferred)
+	assert.True(t, local.Equal(remote, nil))
+	assert.NoError(t, local.Check())
+
+	stats, err = local.Sync(transport)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, bptree.SyncStats{NumberOfRoundTrips: 1, NumberOfRangesCompared: 1}, stats)
+	}
+
+	changedKeys := map[int64]struct{}{}
+
+	for i := 0; i < 20; i++ {
+		k := int64(rand.Intn(20000))
+		changedKeys[k] = struct{}{}
+
+		switch rand.Intn(4) {
+		case 0:
+			remote.DeleteRecord(k)
+		case 1:
+			local.DeleteRecord(k)
+		case 2:
+			remote.AddOrUpdateRecord(k, "remote")
+		default:
+			local.AddOrUpdateRecord(k, "local")
+		}
+	}
+
+	stats, err = local.Sync(transport)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.True(t, local.Equal(remote, nil))
+	assert.NoError(t, local.Check())
+	t.Logf("sync stats: %+v", stats)
+	// only the records in the narrowed down ranges are transferred.
+	assert.True(t, stats.NumberOfRecordsTransferred <= len(changedKeys)*8, "%v", stats.NumberOfRecordsTransferred)
+
+	for i := int64(0); i < 20000; i++ {
+		remote.DeleteRecord(i)
+	}
+
+	_, err = local.Sync(transport)
+
+	if assert.NoError(t, err) {
+		assert.True(t, local.IsEmpty())
+	}
+}
+
+func TestBPTreeSyncError(t *testing.T) {
+	remote := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	remote.EnableHashing(nil, nil)
+
+	for i, k := range Keywords[:100] {
+		remote.AddRecord(k, strconv.Itoa(i))
+	}
+
+	local := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	local.EnableHashing(nil, nil)
+	errTransport := errors.New("transport failure")
+	_, err := local.Sync(bptree.SyncTransportFunc(func(*bptree.SyncRequest) (*bptree.SyncResponse, error) {
+		return nil, errTransport
+	}))
+	assert.Equal(t, errTransport, err)
+
+	_, err = local.Sync(bptree.SyncTransportFunc(func(request *bptree.SyncRequest) (*bptree.SyncResponse, error) {
+		response := remote.ServeSync(request)
+
+		for _, records := range response.Records {
+			for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+				records[i], records[j] = records[j], records[i]
+			}
+		}
+
+		return response, nil
+	}))
+	assert.Error(t, err)
+
+	local.DisableHashing()
+	assert.Panics(t, func() { local.Sync(MakeSyncTransport(remote)) })
+}
+
+func MakeSyncTransport(remote *bptree.BPTree) bptree.SyncTransport {
+	return bptree.SyncTransportFunc(func(request *bptree.SyncRequest) (*bptree.SyncResponse, error) {
+		return remote.ServeSync(request), nil
+	})
+}
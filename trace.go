@@ -0,0 +1,505 @@
+package bptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// StartTrace starts recording the operations on the B+ tree to the
+// given writer, with keys and values encoded by the given encoder,
+// for replaying them with Replay. It records the options of the B+
+// tree first, then the present records as additions in key order.
+// Operations are recorded before they are carried out, each in one
+// write, so a trace is complete up to an operation which crashes.
+// Recording stops on the first write error, which is returned by
+// StopTrace.
+func (bpt *BPTree) StartTrace(w io.Writer, encoder MutationEncoder) error {
+	bpt.lazyInit()
+	var buffer bytes.Buffer
+	buffer.WriteString(traceMagic)
+	writeUvarint(&buffer, uint64(bpt.options.LeafCapacity))
+	writeUvarint(&buffer, uint64(bpt.options.NonLeafCapacity))
+	writeFloat64(&buffer, bpt.options.MinFillFactor)
+
+	if bpt.options.DisableSiblingShifting {
+		buffer.WriteByte(1)
+	} else {
+		buffer.WriteByte(0)
+	}
+
+	buffer.WriteByte(byte(bpt.keyKind))
+
+	if _, err := w.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+
+	tracer := tracer{
+		Writer:  w,
+		Encoder: encoder,
+	}
+
+	for leaf, recordIndex, ok := bpt.nextRecord(bpt.leafList.Head(), 0); ok; leaf, recordIndex, ok = bpt.nextRecord(leaf, recordIndex+1) {
+		tracer.Record(TraceAddRecord, leaf.Key(recordIndex), leaf.Value(recordIndex))
+
+		if tracer.Err != nil {
+			return tracer.Err
+		}
+	}
+
+	bpt.tracer = &tracer
+	return nil
+}
+
+// StopTrace stops recording the operations on the B+ tree and
+// returns the first error in recording.
+func (bpt *BPTree) StopTrace() error {
+	tracer := bpt.tracer
+
+	if tracer == nil {
+		return nil
+	}
+
+	bpt.tracer = nil
+	return tracer.Err
+}
+
+// TraceOp is the kind of a traced operation.
+type TraceOp int
+
+const (
+	// TraceAddRecord means AddRecord(key, value).
+	TraceAddRecord = TraceOp(1 + iota)
+
+	// TraceUpdateRecord means UpdateRecord(key, value).
+	TraceUpdateRecord
+
+	// TraceAddOrUpdateRecord means AddOrUpdateRecord(key, value).
+	TraceAddOrUpdateRecord
+
+	// TraceDeleteRecord means DeleteRecord(key).
+	TraceDeleteRecord
+
+	// TraceHasRecord means HasRecord(key).
+	TraceHasRecord
+
+	// TraceFloor means Floor(key).
+	TraceFloor
+
+	// TraceCeiling means Ceiling(key).
+	TraceCeiling
+
+	// TraceSearchForward means SearchForward(key1, key2), followed
+	// by the iteration to the end.
+	TraceSearchForward
+
+	// TraceSearchBackward means SearchBackward(key1, key2), followed
+	// by the iteration to the end.
+	TraceSearchBackward
+
+	// TraceClear means Clear().
+	TraceClear
+
+	// TraceCompact means Compact(targetFillFactor).
+	TraceCompact
+
+	// TraceChangeDegree means ChangeDegree(maxDegree).
+	TraceChangeDegree
+)
+
+// String returns the name of the traced operation.
+func (to TraceOp) String() string {
+	switch to {
+	case TraceAddRecord:
+		return "AddRecord"
+	case TraceUpdateRecord:
+		return "UpdateRecord"
+	case TraceAddOrUpdateRecord:
+		return "AddOrUpdateRecord"
+	case TraceDeleteRecord:
+		return "DeleteRecord"
+	case TraceHasRecord:
+		return "HasRecord"
+	case TraceFloor:
+		return "Floor"
+	case TraceCeiling:
+		return "Ceiling"
+	case TraceSearchForward:
+		return "SearchForward"
+	case TraceSearchBackward:
+		return "SearchBackward"
+	case TraceClear:
+		return "Clear"
+	case TraceCompact:
+		return "Compact"
+	case TraceChangeDegree:
+		return "ChangeDegree"
+	default:
+		return "Unknown"
+	}
+}
+
+// TraceStep represents an operation in a trace.
+type TraceStep struct {
+	Op   TraceOp
+	Args []interface{}
+}
+
+// String returns the call of the operation.
+func (ts TraceStep) String() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "%v(", ts.Op)
+
+	for i, arg := range ts.Args {
+		if i >= 1 {
+			buffer.WriteString(", ")
+		}
+
+		switch arg {
+		case KeyMin:
+			buffer.WriteString("KeyMin")
+		case KeyMax:
+			buffer.WriteString("KeyMax")
+		default:
+			fmt.Fprintf(&buffer, "%#v", arg)
+		}
+	}
+
+	buffer.WriteByte(')')
+	return buffer.String()
+}
+
+// ReplayError is returned by Replay for the first step after which
+// the B+ tree is corrupted, or which panics.
+type ReplayError struct {
+	// StepIndex is the index of the step, from 0.
+	StepIndex int
+
+	Step TraceStep
+	Err  error
+}
+
+// Error implements error.Error.
+func (re *ReplayError) Error() string {
+	return fmt.Sprintf("bptree: replay step %d: %v: %v", re.StepIndex, re.Step, re.Err)
+}
+
+// Replay reads the trace recorded by StartTrace from the given
+// reader, with keys and values decoded by the given encoder, and
+// re-runs the operations against a fresh B+ tree, calling Check
+// after each step. The given key comparer is used only for generic
+// keys, whose comparer is not recorded, and defaults to the default
+// key comparer (see Options.KeyComparer) if it is nil.
+// It stops at the first step after which the B+ tree is corrupted,
+// or which panics, and returns a *ReplayError. Otherwise it returns
+// the B+ tree and the number of steps when the trace ends.
+func Replay(r io.Reader, encoder MutationEncoder, keyComparer KeyComparer) (*BPTree, int, error) {
+	byteReader, ok := r.(io.ByteReader)
+
+	if !ok {
+		br := bufio.NewReader(r)
+		r, byteReader = br, br
+	}
+
+	tr := traceReader{r, byteReader, encoder}
+	options, err := tr.ReadOptions()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if options.KeyKind == GenericKeys {
+		options.KeyComparer = keyComparer
+	}
+
+	bpt := new(BPTree).InitWithOptions(options)
+
+	for stepIndex := 0; ; stepIndex++ {
+		step, err := tr.ReadStep()
+
+		if err != nil {
+			if err == io.EOF {
+				return bpt, stepIndex, nil
+			}
+
+			return bpt, stepIndex, err
+		}
+
+		if err := bpt.replayStep(step); err != nil {
+			return bpt, stepIndex, &ReplayError{stepIndex, step, err}
+		}
+	}
+}
+
+const traceMagic = "bptrace\x01"
+
+const (
+	traceArgKey = 1 + iota
+	traceArgValue
+	traceArgKeyMin
+	traceArgKeyMax
+	traceArgNumber
+)
+
+type tracer struct {
+	Writer  io.Writer
+	Encoder MutationEncoder
+	Err     error
+}
+
+// Record records the operation with the given arguments, in the
+// order of the parameters of the method.
+func (t *tracer) Record(op TraceOp, args ...interface{}) {
+	if t.Err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteByte(byte(op))
+	writeUvarint(&buffer, uint64(len(args)))
+
+	for i, arg := range args {
+		switch {
+		case op == TraceCompact:
+			buffer.WriteByte(traceArgNumber)
+			writeFloat64(&buffer, arg.(float64))
+		case op == TraceChangeDegree:
+			buffer.WriteByte(traceArgNumber)
+			writeFloat64(&buffer, float64(arg.(int)))
+		case arg == KeyMin:
+			buffer.WriteByte(traceArgKeyMin)
+		case arg == KeyMax:
+			buffer.WriteByte(traceArgKeyMax)
+		default:
+			var mutation Mutation
+			argType := byte(traceArgKey)
+
+			if isValueArg(op, i) {
+				mutation.Value = arg
+				argType = traceArgValue
+			} else {
+				mutation.Key = arg
+			}
+
+			data, err := t.Encoder.EncodeMutation(&mutation)
+
+			if err != nil {
+				t.Err = err
+				return
+			}
+
+			buffer.WriteByte(argType)
+			writeUvarint(&buffer, uint64(len(data)))
+			buffer.Write(data)
+		}
+	}
+
+	_, t.Err = t.Writer.Write(buffer.Bytes())
+}
+
+func isValueArg(op TraceOp, argIndex int) bool {
+	switch op {
+	case TraceAddRecord, TraceUpdateRecord, TraceAddOrUpdateRecord:
+		return argIndex == 1
+	default:
+		return false
+	}
+}
+
+type traceReader struct {
+	Reader     io.Reader
+	ByteReader io.ByteReader
+	Encoder    MutationEncoder
+}
+
+func (tr *traceReader) ReadOptions() (Options, error) {
+	var magic [len(traceMagic)]byte
+
+	if _, err := io.ReadFull(tr.Reader, magic[:]); err != nil || string(magic[:]) != traceMagic {
+		return Options{}, errors.New("bptree: invalid trace")
+	}
+
+	var options Options
+	var header [2]uint64
+
+	for i := range header {
+		x, err := binary.ReadUvarint(tr.ByteReader)
+
+		if err != nil {
+			return Options{}, unexpectedEOF(err)
+		}
+
+		header[i] = x
+	}
+
+	options.LeafCapacity, options.NonLeafCapacity = int(header[0]), int(header[1])
+	minFillFactor, err := tr.readFloat64()
+
+	if err != nil {
+		return Options{}, err
+	}
+
+	options.MinFillFactor = minFillFactor
+	var flags [2]byte
+
+	if _, err := io.ReadFull(tr.Reader, flags[:]); err != nil {
+		return Options{}, unexpectedEOF(err)
+	}
+
+	options.DisableSiblingShifting = flags[0] == 1
+	options.KeyKind = KeyKind(flags[1])
+
+	if options.LeafCapacity < 2 || options.NonLeafCapacity < 4 || !(options.MinFillFactor > 0 && options.MinFillFactor <= 0.5) || options.KeyKind > StringKeys {
+		return Options{}, errors.New("bptree: invalid trace")
+	}
+
+	return options, nil
+}
+
+func (tr *traceReader) ReadStep() (TraceStep, error) {
+	op, err := tr.ByteReader.ReadByte()
+
+	if err != nil {
+		// io.EOF at the start of a step is the end.
+		return TraceStep{}, err
+	}
+
+	numberOfArgs, err := binary.ReadUvarint(tr.ByteReader)
+
+	if err != nil {
+		return TraceStep{}, unexpectedEOF(err)
+	}
+
+	if op < byte(TraceAddRecord) || op > byte(TraceChangeDegree) || numberOfArgs > 2 {
+		return TraceStep{}, errors.New("bptree: invalid trace")
+	}
+
+	step := TraceStep{Op: TraceOp(op)}
+
+	for i := uint64(0); i < numberOfArgs; i++ {
+		arg, err := tr.readArg()
+
+		if err != nil {
+			return TraceStep{}, err
+		}
+
+		step.Args = append(step.Args, arg)
+	}
+
+	return step, nil
+}
+
+func (tr *traceReader) readArg() (interface{}, error) {
+	argType, err := tr.ByteReader.ReadByte()
+
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	switch argType {
+	case traceArgKeyMin:
+		return KeyMin, nil
+	case traceArgKeyMax:
+		return KeyMax, nil
+	case traceArgNumber:
+		return tr.readFloat64()
+	case traceArgKey, traceArgValue:
+		n, err := binary.ReadUvarint(tr.ByteReader)
+
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		if n > 1<<30 {
+			return nil, errors.New("bptree: invalid trace")
+		}
+
+		data, err := readData(tr.Reader, n)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var mutation Mutation
+
+		if err := tr.Encoder.DecodeMutation(data, &mutation); err != nil {
+			return nil, err
+		}
+
+		if argType == traceArgValue {
+			return mutation.Value, nil
+		}
+
+		return mutation.Key, nil
+	default:
+		return nil, errors.New("bptree: invalid trace")
+	}
+}
+
+func (tr *traceReader) readFloat64() (float64, error) {
+	var data [8]byte
+
+	if _, err := io.ReadFull(tr.Reader, data[:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+
+	return math.Float64frombits(binary.BigEndian.Uint64(data[:])), nil
+}
+
+func (bpt *BPTree) replayStep(step TraceStep) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+
+	args := step.Args
+	arg := func(i int) interface{} {
+		if i >= len(args) {
+			panic(errors.New("bptree: missing argument"))
+		}
+
+		return args[i]
+	}
+
+	switch step.Op {
+	case TraceAddRecord:
+		bpt.AddRecord(arg(0), arg(1))
+	case TraceUpdateRecord:
+		bpt.UpdateRecord(arg(0), arg(1))
+	case TraceAddOrUpdateRecord:
+		bpt.AddOrUpdateRecord(arg(0), arg(1))
+	case TraceDeleteRecord:
+		bpt.DeleteRecord(arg(0))
+	case TraceHasRecord:
+		bpt.HasRecord(arg(0))
+	case TraceFloor:
+		bpt.Floor(arg(0))
+	case TraceCeiling:
+		bpt.Ceiling(arg(0))
+	case TraceSearchForward:
+		for it := bpt.SearchForward(arg(0), arg(1)); !it.IsAtEnd(); it.Advance() {
+		}
+	case TraceSearchBackward:
+		for it := bpt.SearchBackward(arg(0), arg(1)); !it.IsAtEnd(); it.Advance() {
+		}
+	case TraceClear:
+		bpt.Clear()
+	case TraceCompact:
+		bpt.Compact(arg(0).(float64))
+	case TraceChangeDegree:
+		bpt.ChangeDegree(int(arg(0).(float64)))
+	}
+
+	return bpt.Check()
+}
+
+func writeFloat64(buffer *bytes.Buffer, x float64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], math.Float64bits(x))
+	buffer.Write(data[:])
+}
@@ -0,0 +1,192 @@
+package bptree_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBPTreeTraceAndReplay(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithOptions(bptree.Options{
+		LeafCapacity:    6,
+		NonLeafCapacity: 5,
+		MinFillFactor:   0.4,
+		KeyKind:         bptree.Int64Keys,
+	})
+
+	for i := int64(0); i < 50; i++ {
+		bpt.AddRecord(i*3, int(i))
+	}
+
+	var trace bytes.Buffer
+
+	if !assert.NoError(t, bpt.StartTrace(&trace, bptree.GobMutationEncoder{})) {
+		t.FailNow()
+	}
+
+	numberOfSteps := 50
+
+	for i := 0; i < 2000; i++ {
+		k := int64(rand.Intn(1000))
+
+		switch rand.Intn(8) {
+		case 0:
+			bpt.AddRecord(k, i)
+		case 1:
+			bpt.UpdateRecord(k, i)
+		case 2:
+			bpt.AddOrUpdateRecord(k, i)
+		case 3:
+			bpt.DeleteRecord(k)
+		case 4:
+			bpt.HasRecord(k)
+		case 5:
+			bpt.Floor(k)
+		case 6:
+			bpt.Ceiling(k)
+		default:
+			bpt.SearchForward(k, bptree.KeyMax)
+			bpt.SearchBackward(bptree.KeyMin, k)
+			numberOfSteps++
+		}
+
+		numberOfSteps++
+	}
+
+	bpt.Compact(0.8)
+	bpt.ChangeDegree(7)
+	numberOfSteps += 2
+	assert.NoError(t, bpt.StopTrace())
+
+	bpt2, n, err := bptree.Replay(bytes.NewReader(trace.Bytes()), bptree.GobMutationEncoder{}, nil)
+
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, numberOfSteps, n)
+	assert.Equal(t, bptree.Options{LeafCapacity: 7, NonLeafCapacity: 7, MinFillFactor: 0.4, KeyKind: bptree.Int64Keys}, ClearKeyComparer(bpt2.Options()))
+	assert.True(t, bpt.Equal(bpt2, nil))
+	assert.True(t, bpt.EqualShape(bpt2))
+}
+
+func TestBPTreeReplayCorruption(t *testing.T) {
+	var trace bytes.Buffer
+	bpt := new(bptree.BPTree).Init(4, compareInts)
+	bpt.StartTrace(&trace, bptree.GobMutationEncoder{})
+
+	for i := 0; i < 100; i++ {
+		bpt.AddRecord(i, nil)
+		bpt.HasRecord(i)
+	}
+
+	bpt.StopTrace()
+
+	for _, keyComparer := range []bptree.KeyComparer{nil, compareInts} {
+		bpt2, n, err := bptree.Replay(bytes.NewReader(trace.Bytes()), bptree.GobMutationEncoder{}, keyComparer)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, 200, n)
+			assert.True(t, bpt.Equal(bpt2, nil))
+		}
+	}
+
+	// 13 is less than any other key, and any other key is less
+	// than 13.
+	_, _, err := bptree.Replay(bytes.NewReader(trace.Bytes()), bptree.GobMutationEncoder{}, func(key1, key2 interface{}) int64 {
+		if key1 == 13 && key2 != 13 || key1 != 13 && key2 == 13 {
+			return -1
+		}
+
+		return compareInts(key1, key2)
+	})
+
+	var replayError *bptree.ReplayError
+
+	if assert.True(t, errors.As(err, &replayError), "%v", err) {
+		assert.True(t, replayError.StepIndex >= 26, "%v", replayError.StepIndex)
+		t.Log(replayError)
+	}
+
+	assert.Equal(t, "SearchForward(13, KeyMax)", bptree.TraceStep{Op: bptree.TraceSearchForward, Args: []interface{}{13, bptree.KeyMax}}.String())
+}
+
+func TestBPTreeReplayHugeLength(t *testing.T) {
+	var trace bytes.Buffer
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	bpt.StartTrace(&trace, bptree.GobMutationEncoder{})
+	bpt.StopTrace()
+	// a step with one key claiming 1 GiB of data which is missing.
+	data := append(trace.Bytes(), byte(bptree.TraceHasRecord), 1, 1)
+	var length [binary.MaxVarintLen64]byte
+	data = append(data, length[:binary.PutUvarint(length[:], 1<<30)]...)
+	var memStats1, memStats2 runtime.MemStats
+	runtime.ReadMemStats(&memStats1)
+	_, n, err := bptree.Replay(bytes.NewReader(data), bptree.GobMutationEncoder{}, nil)
+	runtime.ReadMemStats(&memStats2)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 0, n)
+	assert.True(t, memStats2.TotalAlloc-memStats1.TotalAlloc < 1<<20, "%v", memStats2.TotalAlloc-memStats1.TotalAlloc)
+}
+
+func TestBPTreeTraceErrors(t *testing.T) {
+	bpt := new(bptree.BPTree).InitWithKeyKind(4, bptree.StringKeys, nil)
+	bpt.AddRecord("foo", "bar")
+	errWrite := errors.New("write failure")
+	w := &FailingWriter{N: 2, Err: errWrite}
+
+	if !assert.NoError(t, bpt.StartTrace(w, bptree.GobMutationEncoder{})) {
+		t.FailNow()
+	}
+
+	bpt.AddRecord("a", "b")
+	bpt.AddRecord("c", "d")
+	bpt.AddRecord("e", "f")
+	assert.Equal(t, errWrite, bpt.StopTrace())
+	assert.Equal(t, 3, w.NumberOfWrites)
+	assert.NoError(t, bpt.StopTrace())
+
+	_, _, err := bptree.Replay(strings.NewReader("bptrace\x02"), bptree.GobMutationEncoder{}, nil)
+	assert.Error(t, err)
+
+	var trace bytes.Buffer
+	bpt.StartTrace(&trace, bptree.GobMutationEncoder{})
+	bpt.DeleteRecord("a")
+	bpt.StopTrace()
+	_, n, err := bptree.Replay(bytes.NewReader(trace.Bytes()[:trace.Len()-1]), bptree.GobMutationEncoder{}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 4, n)
+}
+
+type FailingWriter struct {
+	N              int
+	Err            error
+	NumberOfWrites int
+}
+
+func (fw *FailingWriter) Write(data []byte) (int, error) {
+	fw.NumberOfWrites++
+
+	if fw.NumberOfWrites > fw.N {
+		return 0, fw.Err
+	}
+
+	return len(data), nil
+}
+
+func ClearKeyComparer(options bptree.Options) bptree.Options {
+	options.KeyComparer = nil
+	return options
+}
+
+func compareInts(key1, key2 interface{}) int64 {
+	return int64(key1.(int) - key2.(int))
+}
@@ -0,0 +1,450 @@
+package bptree
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"unsafe"
+)
+
+// int64Keys, uint64Keys, float64Keys and stringKeys store keys
+// unboxed and search them without key comparers.
+type int64Keys []int64
+
+func (k *int64Keys) Len() int {
+	return len(*k)
+}
+
+func (k *int64Keys) Get(i int) interface{} {
+	return (*k)[i]
+}
+
+func (k *int64Keys) Set(i int, key interface{}) {
+	(*k)[i] = key.(int64)
+}
+
+func (k *int64Keys) SetFrom(i int, other keys, j int) {
+	(*k)[i] = (*other.(*int64Keys))[j]
+}
+
+func (k *int64Keys) Locate(key interface{}, _ KeyComparer) (int, bool) {
+	key2 := key.(int64)
+	i, j := 0, len(*k)
+
+	for i < j {
+		m := int(uint(i+j) >> 1)
+		// i <= m < j
+
+		if (*k)[m] < key2 {
+			i = m + 1
+		} else {
+			j = m
+		}
+	}
+	// i == j
+
+	return i, i < len(*k) && (*k)[i] == key2
+}
+
+func (k *int64Keys) Insert(i int, key interface{}) {
+	k.insert(i, key.(int64))
+}
+
+func (k *int64Keys) InsertFrom(i int, other keys, j int) {
+	k.insert(i, (*other.(*int64Keys))[j])
+}
+
+func (k *int64Keys) Remove(i int) {
+	copy((*k)[i:], (*k)[i+1:])
+	(*k)[len(*k)-1] = 0
+	*k = (*k)[:len(*k)-1]
+}
+
+func (k *int64Keys) RemoveRange(i, j int) {
+	copy((*k)[i:], (*k)[j:])
+	k.Truncate(len(*k) - (j - i))
+}
+
+func (k *int64Keys) AppendFrom(other keys, i, j int) {
+	*k = append(*k, (*other.(*int64Keys))[i:j]...)
+}
+
+func (k *int64Keys) Truncate(i int) {
+	for j := len(*k) - 1; j >= i; j-- {
+		(*k)[j] = 0
+	}
+
+	*k = (*k)[:i]
+}
+
+func (k *int64Keys) Separator(prev keys) interface{} {
+	return (*k)[0]
+}
+
+func (k *int64Keys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*k)) + int64(cap(*k))*8
+}
+
+func (k *int64Keys) insert(i int, key int64) {
+	*k = append(*k, 0)
+	copy((*k)[i+1:], (*k)[i:])
+	(*k)[i] = key
+}
+
+type uint64Keys []uint64
+
+func (k *uint64Keys) Len() int {
+	return len(*k)
+}
+
+func (k *uint64Keys) Get(i int) interface{} {
+	return (*k)[i]
+}
+
+func (k *uint64Keys) Set(i int, key interface{}) {
+	(*k)[i] = key.(uint64)
+}
+
+func (k *uint64Keys) SetFrom(i int, other keys, j int) {
+	(*k)[i] = (*other.(*uint64Keys))[j]
+}
+
+func (k *uint64Keys) Locate(key interface{}, _ KeyComparer) (int, bool) {
+	key2 := key.(uint64)
+	i, j := 0, len(*k)
+
+	for i < j {
+		m := int(uint(i+j) >> 1)
+		// i <= m < j
+
+		if (*k)[m] < key2 {
+			i = m + 1
+		} else {
+			j = m
+		}
+	}
+	// i == j
+
+	return i, i < len(*k) && (*k)[i] == key2
+}
+
+func (k *uint64Keys) Insert(i int, key interface{}) {
+	k.insert(i, key.(uint64))
+}
+
+func (k *uint64Keys) InsertFrom(i int, other keys, j int) {
+	k.insert(i, (*other.(*uint64Keys))[j])
+}
+
+func (k *uint64Keys) Remove(i int) {
+	copy((*k)[i:], (*k)[i+1:])
+	(*k)[len(*k)-1] = 0
+	*k = (*k)[:len(*k)-1]
+}
+
+func (k *uint64Keys) RemoveRange(i, j int) {
+	copy((*k)[i:], (*k)[j:])
+	k.Truncate(len(*k) - (j - i))
+}
+
+func (k *uint64Keys) AppendFrom(other keys, i, j int) {
+	*k = append(*k, (*other.(*uint64Keys))[i:j]...)
+}
+
+func (k *uint64Keys) Truncate(i int) {
+	for j := len(*k) - 1; j >= i; j-- {
+		(*k)[j] = 0
+	}
+
+	*k = (*k)[:i]
+}
+
+func (k *uint64Keys) Separator(prev keys) interface{} {
+	return (*k)[0]
+}
+
+func (k *uint64Keys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*k)) + int64(cap(*k))*8
+}
+
+func (k *uint64Keys) insert(i int, key uint64) {
+	*k = append(*k, 0)
+	copy((*k)[i+1:], (*k)[i:])
+	(*k)[i] = key
+}
+
+type float64Keys []float64
+
+func (k *float64Keys) Len() int {
+	return len(*k)
+}
+
+func (k *float64Keys) Get(i int) interface{} {
+	return (*k)[i]
+}
+
+func (k *float64Keys) Set(i int, key interface{}) {
+	(*k)[i] = checkFloat64Key(key.(float64))
+}
+
+func (k *float64Keys) SetFrom(i int, other keys, j int) {
+	(*k)[i] = (*other.(*float64Keys))[j]
+}
+
+func (k *float64Keys) Locate(key interface{}, _ KeyComparer) (int, bool) {
+	key2 := key.(float64)
+	i, j := 0, len(*k)
+
+	for i < j {
+		m := int(uint(i+j) >> 1)
+		// i <= m < j
+
+		if (*k)[m] < key2 {
+			i = m + 1
+		} else {
+			j = m
+		}
+	}
+	// i == j
+
+	return i, i < len(*k) && (*k)[i] == key2
+}
+
+func (k *float64Keys) Insert(i int, key interface{}) {
+	k.insert(i, checkFloat64Key(key.(float64)))
+}
+
+func (k *float64Keys) InsertFrom(i int, other keys, j int) {
+	k.insert(i, (*other.(*float64Keys))[j])
+}
+
+func (k *float64Keys) Remove(i int) {
+	copy((*k)[i:], (*k)[i+1:])
+	(*k)[len(*k)-1] = 0
+	*k = (*k)[:len(*k)-1]
+}
+
+func (k *float64Keys) RemoveRange(i, j int) {
+	copy((*k)[i:], (*k)[j:])
+	k.Truncate(len(*k) - (j - i))
+}
+
+func (k *float64Keys) AppendFrom(other keys, i, j int) {
+	*k = append(*k, (*other.(*float64Keys))[i:j]...)
+}
+
+func (k *float64Keys) Truncate(i int) {
+	for j := len(*k) - 1; j >= i; j-- {
+		(*k)[j] = 0
+	}
+
+	*k = (*k)[:i]
+}
+
+func (k *float64Keys) Separator(prev keys) interface{} {
+	return (*k)[0]
+}
+
+func (k *float64Keys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*k)) + int64(cap(*k))*8
+}
+
+func (k *float64Keys) insert(i int, key float64) {
+	*k = append(*k, 0)
+	copy((*k)[i+1:], (*k)[i:])
+	(*k)[i] = key
+}
+
+type stringKeys []string
+
+func (k *stringKeys) Len() int {
+	return len(*k)
+}
+
+func (k *stringKeys) Get(i int) interface{} {
+	return (*k)[i]
+}
+
+func (k *stringKeys) Set(i int, key interface{}) {
+	(*k)[i] = key.(string)
+}
+
+func (k *stringKeys) SetFrom(i int, other keys, j int) {
+	(*k)[i] = (*other.(*stringKeys))[j]
+}
+
+func (k *stringKeys) Locate(key interface{}, _ KeyComparer) (int, bool) {
+	key2 := key.(string)
+	i, j := 0, len(*k)
+
+	for i < j {
+		m := int(uint(i+j) >> 1)
+		// i <= m < j
+
+		if (*k)[m] < key2 {
+			i = m + 1
+		} else {
+			j = m
+		}
+	}
+	// i == j
+
+	return i, i < len(*k) && (*k)[i] == key2
+}
+
+func (k *stringKeys) Insert(i int, key interface{}) {
+	k.insert(i, key.(string))
+}
+
+func (k *stringKeys) InsertFrom(i int, other keys, j int) {
+	k.insert(i, (*other.(*stringKeys))[j])
+}
+
+func (k *stringKeys) Remove(i int) {
+	copy((*k)[i:], (*k)[i+1:])
+	(*k)[len(*k)-1] = ""
+	*k = (*k)[:len(*k)-1]
+}
+
+func (k *stringKeys) RemoveRange(i, j int) {
+	copy((*k)[i:], (*k)[j:])
+	k.Truncate(len(*k) - (j - i))
+}
+
+func (k *stringKeys) AppendFrom(other keys, i, j int) {
+	*k = append(*k, (*other.(*stringKeys))[i:j]...)
+}
+
+func (k *stringKeys) Truncate(i int) {
+	for j := len(*k) - 1; j >= i; j-- {
+		(*k)[j] = ""
+	}
+
+	*k = (*k)[:i]
+}
+
+// Separator returns the shortest prefix of the first key which is
+// greater than the last key of the given keys.
+func (k *stringKeys) Separator(prev keys) interface{} {
+	prevKeys := *prev.(*stringKeys)
+	last, first := prevKeys[len(prevKeys)-1], (*k)[0]
+	n := len(last)
+
+	if n > len(first) {
+		n = len(first)
+	}
+
+	i := 0
+
+	for i < n && last[i] == first[i] {
+		i++
+	}
+
+	return first[:i+1]
+}
+
+func (k *stringKeys) MemoryUsage() int64 {
+	return int64(unsafe.Sizeof(*k)) + int64(cap(*k))*int64(unsafe.Sizeof(""))
+}
+
+func (k *stringKeys) insert(i int, key string) {
+	*k = append(*k, "")
+	copy((*k)[i+1:], (*k)[i:])
+	(*k)[i] = key
+}
+
+func checkFloat64Key(key float64) float64 {
+	if math.IsNaN(key) {
+		panic(errors.New("bptree: NaN key"))
+	}
+
+	return key
+}
+
+func compareInt64s(key1, key2 interface{}) int64 {
+	return compareInt64(key1.(int64), key2.(int64))
+}
+
+func compareInt64(x, y int64) int64 {
+	switch {
+	case x < y:
+		return -1
+	case x == y:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func compareUint64s(key1, key2 interface{}) int64 {
+	return compareUint64(key1.(uint64), key2.(uint64))
+}
+
+func compareUint64(x, y uint64) int64 {
+	switch {
+	case x < y:
+		return -1
+	case x == y:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func compareFloat64s(key1, key2 interface{}) int64 {
+	return compareFloat64(key1.(float64), key2.(float64))
+}
+
+func compareFloat64(x, y float64) int64 {
+	switch {
+	case x < y:
+		return -1
+	case x == y:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func compareStrings(key1, key2 interface{}) int64 {
+	return int64(strings.Compare(key1.(string), key2.(string)))
+}
+
+// compareWellKnownKeys is the default key comparer for generic
+// keys, which compares keys of the same integer, floating-point,
+// string or []byte type.
+func compareWellKnownKeys(key1, key2 interface{}) int64 {
+	switch x := key1.(type) {
+	case int:
+		return compareInt64(int64(x), int64(key2.(int)))
+	case int8:
+		return compareInt64(int64(x), int64(key2.(int8)))
+	case int16:
+		return compareInt64(int64(x), int64(key2.(int16)))
+	case int32:
+		return compareInt64(int64(x), int64(key2.(int32)))
+	case int64:
+		return compareInt64(x, key2.(int64))
+	case uint:
+		return compareUint64(uint64(x), uint64(key2.(uint)))
+	case uint8:
+		return compareUint64(uint64(x), uint64(key2.(uint8)))
+	case uint16:
+		return compareUint64(uint64(x), uint64(key2.(uint16)))
+	case uint32:
+		return compareUint64(uint64(x), uint64(key2.(uint32)))
+	case uint64:
+		return compareUint64(x, key2.(uint64))
+	case float32:
+		return compareFloat64(float64(x), float64(key2.(float32)))
+	case float64:
+		return compareFloat64(x, key2.(float64))
+	case string:
+		return int64(strings.Compare(x, key2.(string)))
+	case []byte:
+		return int64(bytes.Compare(x, key2.([]byte)))
+	default:
+		panic(errors.New("bptree: key comparer required"))
+	}
+}
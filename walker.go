@@ -1,42 +1,251 @@
 package bptree
 
-import "unsafe"
+import (
+	"context"
+	"errors"
+	"unsafe"
+)
+
+// SkipSubtree is used as a return value from walkers to indicate
+// that the rest of the subtree of the node being visited is to be
+// skipped. It is not returned as an error by any function.
+var SkipSubtree = errors.New("bptree: skip subtree")
 
 // Walk walks the B+ tree by calling the given walker function
 // for each node in the tree.
+// The first error returned by any walker, including the ones
+// invoked through AccessChild, stops the walk and is returned.
 func (bpt *BPTree) Walk(walker Walker) error {
-	return bpt.doWalk(walker, bpt.root, 1)
+	return bpt.WalkContext(context.Background(), walker)
 }
 
-func (bpt *BPTree) doWalk(walker Walker, node unsafe.Pointer, nodeDepth int) error {
-	var err error
+// WalkContext is like Walk but stops walking and returns the
+// error of the given context once the context is done.
+func (bpt *BPTree) WalkContext(ctx context.Context, walker Walker) error {
+	bpt.lazyInit()
 
-	if nodeDepth == bpt.height {
-		err = walker(&leafAccessor{bpt, (*leaf)(node)})
-	} else {
-		err = walker(&nonLeafAccessor{bpt, (*nonLeaf)(node), nodeDepth})
+	walking := walking{
+		bpt: bpt,
+		ctx: ctx,
+	}
+
+	return walking.Visit(walker, bpt.root, 1, nil)
+}
+
+// Traverse traverses the B+ tree in the given order by calling
+// the given walker function for each node in the tree.
+// Unlike Walk, the traversal is driven by the B+ tree itself,
+// AccessChild of node accessors does nothing and returns nil.
+// Returning SkipSubtree from the walker prevents the children of
+// the node from being visited in pre-order and breadth-first
+// traversals, and has no effect in post-order traversals.
+func (bpt *BPTree) Traverse(ctx context.Context, traversalOrder TraversalOrder, walker Walker) error {
+	bpt.lazyInit()
+
+	walking := walking{
+		bpt:         bpt,
+		ctx:         ctx,
+		isTraversal: true,
+	}
+
+	switch traversalOrder {
+	case PreOrder:
+		walking.VisitInPreOrder(walker, bpt.root, 1, nil)
+	case PostOrder:
+		walking.VisitInPostOrder(walker, bpt.root, 1, nil)
+	case BreadthFirst:
+		walking.VisitInBreadthFirstOrder(walker)
+	default:
+		panic(errors.New("bptree: invalid traversal order"))
 	}
 
-	return err
+	return walking.err
 }
 
 // Walker is the type of the function called while walking
 // a B+ tree.
+// If the function returns SkipSubtree, the walk goes on with
+// the next node without visiting the rest of the subtree.
 type Walker func(nodeAccessor NodeAccessor) (err error)
 
 // NodeAccessor presents a node accessor for walking a B+
-// tree.
+// tree. It is implemented only by this package, and may gain
+// methods over time, so it is not meant to be implemented by users.
 type NodeAccessor interface {
 	IsLeaf() bool
 	NumberOfKeys() int
 	GetKey(keyIndex int) (key interface{})
 	GetValue(keyIndex int) (value interface{})
 	AccessChild(walker Walker, childIndex int) (err error)
+
+	// Depth returns the depth of the node, the root is at depth 1.
+	Depth() (nodeDepth int)
+
+	// ID returns the ID of the node, which is derived from the
+	// address of the node. It is only valid within one walk, as
+	// the address of a node removed from the B+ tree may be reused
+	// by a new node later, especially with node pooling (see
+	// EnableNodePooling).
+	ID() (nodeID NodeID)
+
+	// ParentID returns the ID of the parent of the node, or 0
+	// for the root.
+	ParentID() (nodeID NodeID)
+
+	// NumberOfChildren returns the number of children of the
+	// node, which is 0 for leaves.
+	NumberOfChildren() int
+
+	// FillRatio returns the number of records of the leaf, or
+	// the number of children of the non-leaf, divided by the
+	// maximum degree of the B+ tree.
+	FillRatio() float64
+
+	// PrevLeafID returns the ID of the previous leaf in the leaf
+	// list, or 0 for the first leaf and non-leaves.
+	PrevLeafID() (nodeID NodeID)
+
+	// NextLeafID returns the ID of the next leaf in the leaf
+	// list, or 0 for the last leaf and non-leaves.
+	NextLeafID() (nodeID NodeID)
+}
+
+// NodeID is the ID of a node in a B+ tree, which is only valid
+// within one walk or export of the B+ tree.
+type NodeID uintptr
+
+// TraversalOrder represents an order to traverse a B+ tree.
+type TraversalOrder int
+
+const (
+	// PreOrder visits each node before its children.
+	PreOrder TraversalOrder = iota
+
+	// PostOrder visits each node after its children.
+	PostOrder
+
+	// BreadthFirst visits nodes level by level from the root.
+	BreadthFirst
+)
+
+type walking struct {
+	bpt         *BPTree
+	ctx         context.Context
+	isTraversal bool
+	err         error
+}
+
+func (w *walking) Visit(walker Walker, node unsafe.Pointer, nodeDepth int, parent unsafe.Pointer) error {
+	w.visitNode(walker, node, nodeDepth, parent)
+	return w.err
+}
+
+func (w *walking) VisitInPreOrder(walker Walker, node unsafe.Pointer, nodeDepth int, parent unsafe.Pointer) {
+	if !w.visitNode(walker, node, nodeDepth, parent) || nodeDepth == w.bpt.height {
+		return
+	}
+
+	for _, child := range (*nonLeaf)(node).children {
+		w.VisitInPreOrder(walker, child, nodeDepth+1, node)
+
+		if w.err != nil {
+			return
+		}
+	}
+}
+
+func (w *walking) VisitInPostOrder(walker Walker, node unsafe.Pointer, nodeDepth int, parent unsafe.Pointer) {
+	if nodeDepth < w.bpt.height {
+		for _, child := range (*nonLeaf)(node).children {
+			w.VisitInPostOrder(walker, child, nodeDepth+1, node)
+
+			if w.err != nil {
+				return
+			}
+		}
+	}
+
+	w.visitNode(walker, node, nodeDepth, parent)
+}
+
+func (w *walking) VisitInBreadthFirstOrder(walker Walker) {
+	nodes := []unsafe.Pointer{w.bpt.root}
+	parents := []unsafe.Pointer{nil}
+
+	for nodeDepth := 1; len(nodes) >= 1; nodeDepth++ {
+		var childNodes, childParents []unsafe.Pointer
+
+		for i, node := range nodes {
+			if !w.visitNode(walker, node, nodeDepth, parents[i]) {
+				if w.err != nil {
+					return
+				}
+
+				continue
+			}
+
+			if nodeDepth < w.bpt.height {
+				for _, child := range (*nonLeaf)(node).children {
+					childNodes = append(childNodes, child)
+					childParents = append(childParents, node)
+				}
+			}
+		}
+
+		nodes, parents = childNodes, childParents
+	}
+}
+
+func (w *walking) visitNode(walker Walker, node unsafe.Pointer, nodeDepth int, parent unsafe.Pointer) bool {
+	if w.err != nil {
+		return false
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return false
+	}
+
+	var err error
+
+	if nodeDepth == w.bpt.height {
+		err = walker(&leafAccessor{nodeAccessor{w, node, nodeDepth, parent}})
+	} else {
+		err = walker(&nonLeafAccessor{nodeAccessor{w, node, nodeDepth, parent}})
+	}
+
+	if err == SkipSubtree {
+		return false
+	}
+
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+
+	return w.err == nil
+}
+
+type nodeAccessor struct {
+	w      *walking
+	node   unsafe.Pointer
+	depth  int
+	parent unsafe.Pointer
+}
+
+func (na *nodeAccessor) Depth() int {
+	return na.depth
+}
+
+func (na *nodeAccessor) ID() NodeID {
+	return NodeID(uintptr(na.node))
+}
+
+func (na *nodeAccessor) ParentID() NodeID {
+	return NodeID(uintptr(na.parent))
 }
 
 type leafAccessor struct {
-	bpt *BPTree
-	l   *leaf
+	nodeAccessor
 }
 
 func (li *leafAccessor) IsLeaf() bool {
@@ -44,23 +253,47 @@ func (li *leafAccessor) IsLeaf() bool {
 }
 
 func (li *leafAccessor) NumberOfKeys() int {
-	return len(li.l.Records())
+	return li.leaf().NumberOfRecords()
 }
 
 func (li *leafAccessor) GetKey(keyIndex int) interface{} {
-	return li.l.Records()[keyIndex].Key
+	return li.leaf().Key(keyIndex)
 }
 
 func (li *leafAccessor) GetValue(keyIndex int) interface{} {
-	return li.l.Records()[keyIndex].Value
+	return li.leaf().Value(keyIndex)
 }
 
 func (li *leafAccessor) AccessChild(Walker, int) (_ error) { return }
 
+func (li *leafAccessor) NumberOfChildren() (_ int) { return }
+
+func (li *leafAccessor) FillRatio() float64 {
+	return float64(li.leaf().NumberOfRecords()) / float64(li.w.bpt.options.LeafCapacity)
+}
+
+func (li *leafAccessor) PrevLeafID() NodeID {
+	if leaf := li.leaf(); leaf != li.w.bpt.leafList.Head() {
+		return NodeID(uintptr(unsafe.Pointer(leaf.Prev)))
+	}
+
+	return 0
+}
+
+func (li *leafAccessor) NextLeafID() NodeID {
+	if leaf := li.leaf(); leaf != li.w.bpt.leafList.Tail() {
+		return NodeID(uintptr(unsafe.Pointer(leaf.Next)))
+	}
+
+	return 0
+}
+
+func (li *leafAccessor) leaf() *leaf {
+	return (*leaf)(li.node)
+}
+
 type nonLeafAccessor struct {
-	bpt   *BPTree
-	nl    *nonLeaf
-	depth int
+	nodeAccessor
 }
 
 func (nli *nonLeafAccessor) IsLeaf() bool {
@@ -68,17 +301,36 @@ func (nli *nonLeafAccessor) IsLeaf() bool {
 }
 
 func (nli *nonLeafAccessor) NumberOfKeys() int {
-	return len(nli.nl.Children()) - 1
+	return nli.nonLeaf().NumberOfChildren() - 1
 }
 
 func (nli *nonLeafAccessor) GetKey(keyIndex int) interface{} {
-	return nli.nl.Children()[keyIndex+1].Key
+	return nli.nonLeaf().Key(keyIndex + 1)
 }
 
 func (nli *nonLeafAccessor) AccessChild(walker Walker, childIndex int) error {
-	child := nli.nl.Children()[childIndex].Value
-	nli.bpt.doWalk(walker, child, nli.depth+1)
-	return nil
+	if nli.w.isTraversal {
+		return nil
+	}
+
+	child := nli.nonLeaf().Child(childIndex)
+	return nli.w.Visit(walker, child, nli.depth+1, nli.node)
 }
 
 func (nli *nonLeafAccessor) GetValue(int) (_ interface{}) { return }
+
+func (nli *nonLeafAccessor) NumberOfChildren() int {
+	return nli.nonLeaf().NumberOfChildren()
+}
+
+func (nli *nonLeafAccessor) FillRatio() float64 {
+	return float64(nli.nonLeaf().NumberOfChildren()) / float64(nli.w.bpt.options.NonLeafCapacity)
+}
+
+func (nli *nonLeafAccessor) PrevLeafID() (_ NodeID) { return }
+
+func (nli *nonLeafAccessor) NextLeafID() (_ NodeID) { return }
+
+func (nli *nonLeafAccessor) nonLeaf() *nonLeaf {
+	return (*nonLeaf)(nli.node)
+}
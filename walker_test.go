@@ -0,0 +1,243 @@
+package bptree_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/roy2220/bptree"
+	"github.com/stretchr/testify/assert"
+)
+
+type BrokenWriter struct {
+	N int
+}
+
+func (bw *BrokenWriter) Write(p []byte) (int, error) {
+	if bw.N == 0 {
+		return 0, errors.New("broken pipe")
+	}
+
+	bw.N--
+	return len(p), nil
+}
+
+func TestBPTreeWalkError(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	err := bpt.Fprint(&BrokenWriter{100})
+	assert.EqualError(t, err, "broken pipe")
+
+	n := 0
+	err = bpt.Walk(func(nodeAccessor bptree.NodeAccessor) error {
+		n++
+
+		if nodeAccessor.IsLeaf() {
+			return errors.New("leaf reached")
+		}
+
+		for i := 0; i <= nodeAccessor.NumberOfKeys(); i++ {
+			nodeAccessor.AccessChild(func(nodeAccessor bptree.NodeAccessor) error {
+				n++
+				return errors.New("child reached")
+			}, i) // error ignored deliberately
+		}
+
+		return nil
+	})
+
+	assert.EqualError(t, err, "child reached")
+	assert.Equal(t, 2, n)
+}
+
+func TestBPTreeWalkContext(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	var walker bptree.Walker
+
+	walker = func(nodeAccessor bptree.NodeAccessor) error {
+		n++
+
+		if n == 10 {
+			cancel()
+		}
+
+		if nodeAccessor.IsLeaf() {
+			return nil
+		}
+
+		for i := 0; i <= nodeAccessor.NumberOfKeys(); i++ {
+			if err := nodeAccessor.AccessChild(walker, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := bpt.WalkContext(ctx, walker)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 10, n)
+}
+
+func TestBPTreeWalkSkipSubtree(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	numberOfLeaves := 0
+	var walker bptree.Walker
+
+	walker = func(nodeAccessor bptree.NodeAccessor) error {
+		if nodeAccessor.IsLeaf() {
+			numberOfLeaves++
+			return nil
+		}
+
+		for i := 0; i <= nodeAccessor.NumberOfKeys(); i++ {
+			if err := nodeAccessor.AccessChild(walker, i); err != nil {
+				return err
+			}
+
+			if i == 0 {
+				return bptree.SkipSubtree
+			}
+		}
+
+		return nil
+	}
+
+	err := bpt.Walk(walker)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numberOfLeaves)
+}
+
+func TestBPTreeNodeAccessor(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	var leafIDs []bptree.NodeID
+	prevLeafIDs := map[bptree.NodeID]bptree.NodeID{}
+	nextLeafIDs := map[bptree.NodeID]bptree.NodeID{}
+	var walker bptree.Walker
+
+	walker = func(nodeAccessor bptree.NodeAccessor) error {
+		assert.NotEqual(t, bptree.NodeID(0), nodeAccessor.ID())
+		assert.True(t, nodeAccessor.FillRatio() > 0 && nodeAccessor.FillRatio() <= 1)
+
+		if nodeAccessor.IsLeaf() {
+			assert.Equal(t, bpt.Height(), nodeAccessor.Depth())
+			assert.Equal(t, 0, nodeAccessor.NumberOfChildren())
+			leafIDs = append(leafIDs, nodeAccessor.ID())
+			prevLeafIDs[nodeAccessor.ID()] = nodeAccessor.PrevLeafID()
+			nextLeafIDs[nodeAccessor.ID()] = nodeAccessor.NextLeafID()
+			return nil
+		}
+
+		assert.Equal(t, nodeAccessor.NumberOfKeys()+1, nodeAccessor.NumberOfChildren())
+
+		for i := 0; i < nodeAccessor.NumberOfChildren(); i++ {
+			err := nodeAccessor.AccessChild(func(childAccessor bptree.NodeAccessor) error {
+				assert.Equal(t, nodeAccessor.ID(), childAccessor.ParentID())
+				assert.Equal(t, nodeAccessor.Depth()+1, childAccessor.Depth())
+				return walker(childAccessor)
+			}, i)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if !assert.NoError(t, bpt.Walk(walker)) {
+		t.FailNow()
+	}
+
+	for i, leafID := range leafIDs {
+		if i == 0 {
+			assert.Equal(t, bptree.NodeID(0), prevLeafIDs[leafID])
+		} else {
+			assert.Equal(t, leafIDs[i-1], prevLeafIDs[leafID])
+		}
+
+		if i == len(leafIDs)-1 {
+			assert.Equal(t, bptree.NodeID(0), nextLeafIDs[leafID])
+		} else {
+			assert.Equal(t, leafIDs[i+1], nextLeafIDs[leafID])
+		}
+	}
+}
+
+func TestBPTreeTraverse(t *testing.T) {
+	bpt := MakeBPTree(t, 5)
+	numberOfNodes := 0
+	var walker bptree.Walker
+
+	walker = func(nodeAccessor bptree.NodeAccessor) error {
+		numberOfNodes++
+
+		for i := 0; i < nodeAccessor.NumberOfChildren(); i++ {
+			if err := nodeAccessor.AccessChild(walker, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	assert.NoError(t, bpt.Walk(walker))
+
+	for _, traversalOrder := range []bptree.TraversalOrder{bptree.PreOrder, bptree.PostOrder, bptree.BreadthFirst} {
+		var traversedNodeIDs []bptree.NodeID
+		visited := map[bptree.NodeID]struct{}{}
+		lastDepth := 0
+
+		err := bpt.Traverse(context.Background(), traversalOrder, func(nodeAccessor bptree.NodeAccessor) error {
+			traversedNodeIDs = append(traversedNodeIDs, nodeAccessor.ID())
+			visited[nodeAccessor.ID()] = struct{}{}
+
+			switch traversalOrder {
+			case bptree.PreOrder:
+				if nodeAccessor.ParentID() != 0 {
+					_, ok := visited[nodeAccessor.ParentID()]
+					assert.True(t, ok)
+				}
+			case bptree.PostOrder:
+				if nodeAccessor.ParentID() != 0 {
+					_, ok := visited[nodeAccessor.ParentID()]
+					assert.False(t, ok)
+				}
+			case bptree.BreadthFirst:
+				assert.True(t, nodeAccessor.Depth() >= lastDepth)
+				lastDepth = nodeAccessor.Depth()
+			}
+
+			return nil
+		})
+
+		if assert.NoError(t, err) {
+			assert.Len(t, traversedNodeIDs, numberOfNodes)
+			assert.Len(t, visited, numberOfNodes)
+		}
+	}
+
+	n := 0
+
+	err := bpt.Traverse(context.Background(), bptree.BreadthFirst, func(nodeAccessor bptree.NodeAccessor) error {
+		n++
+
+		if nodeAccessor.Depth() == 2 {
+			return bptree.SkipSubtree
+		}
+
+		return nil
+	})
+
+	if assert.NoError(t, err) {
+		numberOfRootChildren := 0
+
+		assert.NoError(t, bpt.Walk(func(nodeAccessor bptree.NodeAccessor) error {
+			numberOfRootChildren = nodeAccessor.NumberOfChildren()
+			return nil
+		}))
+
+		assert.Equal(t, 1+numberOfRootChildren, n)
+	}
+}